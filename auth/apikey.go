@@ -0,0 +1,156 @@
+package auth
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "github.com/garyburd/redigo/redis"
+    "github.com/gin-gonic/gin"
+    "github.com/marxn/vasc/database"
+    "github.com/marxn/vasc/global"
+    "github.com/marxn/vasc/portal"
+    vredis "github.com/marxn/vasc/redis"
+    "time"
+    "xorm.io/xorm"
+)
+
+const APIKeyStorageRedis    = "redis"
+const APIKeyStorageDatabase = "database"
+
+// API keys are stored by their SHA-256 digest, see HashAPIKey.
+type VascAPIKeyDB struct {
+    KeyID             int64     `xorm:"BIGINT PK AUTOINCR 'API_KEY_ID'"`
+    KeyHash           string    `xorm:"VARCHAR(64) NOT NULL UNIQUE 'API_KEY_HASH'"`
+    Subject           string    `xorm:"VARCHAR(128) NOT NULL 'API_KEY_SUBJECT'"`
+    Claims            string    `xorm:"TEXT 'API_KEY_CLAIMS'"`
+    Enabled           bool      `xorm:"BOOL NOT NULL 'API_KEY_ENABLED'"`
+    ExpireTime        time.Time `xorm:"DATETIME 'API_KEY_EXPIRE_TIME'"`
+    CreatedTime       time.Time `xorm:"CREATED 'API_KEY_CREATED_TIME'"`
+    UpdatedTime       time.Time `xorm:"UPDATED 'API_KEY_UPDATED_TIME'"`
+}
+
+func (this *VascAPIKeyDB) TableName() string {
+    return "VASC_API_KEY"
+}
+
+// Redis value of an API key: either a plain subject or a JSON object with "sub" and other claims.
+type APIKeyProvider struct {
+    Header        string
+    Query         string
+    Storage       string
+    RedisConn    *redis.Pool
+    RedisPrefix   string
+    DBConn       *xorm.Engine
+}
+
+func NewAPIKeyProvider(config *global.AuthProviderConfig, redisPoolList *vredis.VascRedis, dbList *database.VascDataBase, projectName string) (*APIKeyProvider, error) {
+    result := &APIKeyProvider{
+        Header:      config.Header,
+        Query:       config.Query,
+        Storage:     config.Storage,
+        RedisPrefix: config.KeyPrefix,
+    }
+    if result.Header == "" && result.Query == "" {
+        result.Header = "X-Api-Key"
+    }
+    if result.RedisPrefix == "" {
+        result.RedisPrefix = fmt.Sprintf("VASC:%s:APIKEY:", projectName)
+    }
+
+    switch config.Storage {
+        case APIKeyStorageRedis:
+            if redisPoolList == nil || redisPoolList.Get(config.Redis) == nil {
+                return nil, errors.New("cannot get redis instance for api key: " + config.Redis)
+            }
+            result.RedisConn = redisPoolList.Get(config.Redis)
+        case APIKeyStorageDatabase:
+            if dbList == nil {
+                return nil, errors.New("cannot get database for api key: " + config.Database)
+            }
+            dbEngine, err := dbList.GetEngine(config.Database)
+            if err != nil {
+                return nil, err
+            }
+            result.DBConn = dbEngine
+        default:
+            return nil, errors.New("invalid api key storage: " + config.Storage)
+    }
+
+    return result, nil
+}
+
+func HashAPIKey(key string) string {
+    digest := sha256.Sum256([]byte(key))
+    return hex.EncodeToString(digest[:])
+}
+
+func (this *APIKeyProvider) Authenticate(c *gin.Context) (*portal.Identity, error) {
+    key := ""
+    if this.Header != "" {
+        key = c.Request.Header.Get(this.Header)
+    }
+    if key == "" && this.Query != "" {
+        key = c.Query(this.Query)
+    }
+    if key == "" {
+        return nil, errors.New("missing api key")
+    }
+
+    if this.RedisConn != nil {
+        return this.lookupRedis(HashAPIKey(key))
+    }
+    return this.lookupDB(HashAPIKey(key))
+}
+
+func (this *APIKeyProvider) lookupRedis(keyHash string) (*portal.Identity, error) {
+    redisConn := this.RedisConn.Get()
+    defer redisConn.Close()
+
+    value, err := redis.String(redisConn.Do("GET", this.RedisPrefix + keyHash))
+    if err == redis.ErrNil {
+        return nil, errors.New("invalid api key")
+    } else if err != nil {
+        return nil, errors.New("cannot verify api key")
+    }
+
+    identity := &portal.Identity{Scheme: AuthTypeAPIKey, Subject: value}
+
+    claims := make(map[string]interface{})
+    if json.Unmarshal([]byte(value), &claims) == nil {
+        identity.Subject, _ = claims["sub"].(string)
+        identity.Claims     = claims
+    }
+
+    return identity, nil
+}
+
+func (this *APIKeyProvider) lookupDB(keyHash string) (*portal.Identity, error) {
+    record := &VascAPIKeyDB{KeyHash: keyHash}
+    exists, err := this.DBConn.Get(record)
+    if err != nil {
+        return nil, errors.New("cannot verify api key")
+    }
+
+    if !exists || !record.Enabled || (!record.ExpireTime.IsZero() && time.Now().After(record.ExpireTime)) {
+        return nil, errors.New("invalid api key")
+    }
+
+    identity := &portal.Identity{Scheme: AuthTypeAPIKey, Subject: record.Subject}
+    if record.Claims != "" {
+        claims := make(map[string]interface{})
+        if json.Unmarshal([]byte(record.Claims), &claims) == nil {
+            identity.Claims = claims
+        }
+    }
+
+    return identity, nil
+}
+
+func (this *APIKeyProvider) Bootstrap() error {
+    if this.DBConn == nil {
+        return nil
+    }
+    return this.DBConn.Sync2(new(VascAPIKeyDB))
+}
@@ -0,0 +1,102 @@
+/*
+ * Pluggable authentication for webserver routes.
+ * Providers are declared in webserver config and referenced by name from routes and groups.
+ */
+
+package auth
+
+import (
+    "errors"
+    "github.com/gin-gonic/gin"
+    "github.com/marxn/vasc/database"
+    "github.com/marxn/vasc/global"
+    "github.com/marxn/vasc/portal"
+    vredis "github.com/marxn/vasc/redis"
+    "github.com/marxn/vasc/verror"
+)
+
+const AuthTypeJWT    = "jwt"
+const AuthTypeAPIKey = "apikey"
+const AuthTypeHMAC   = "hmac"
+
+type Authenticator interface {
+    Authenticate(c *gin.Context) (*portal.Identity, error)
+}
+
+type VascAuth struct {
+    ProjectName   string
+    Providers     map[string]Authenticator
+}
+
+func (this *VascAuth) LoadConfig(config *global.AuthConfig, redisPoolList *vredis.VascRedis, dbList *database.VascDataBase, projectName string) error {
+    this.ProjectName = projectName
+    this.Providers   = make(map[string]Authenticator)
+
+    for index := range config.ProviderList {
+        providerConfig := &config.ProviderList[index]
+        if providerConfig.Name == "" {
+            return errors.New("empty name for auth provider")
+        }
+        if this.Providers[providerConfig.Name] != nil {
+            return errors.New("duplicated auth provider: " + providerConfig.Name)
+        }
+
+        var provider Authenticator
+        var err error
+
+        switch providerConfig.Type {
+            case AuthTypeJWT:
+                provider, err = NewJWTProvider(providerConfig)
+            case AuthTypeAPIKey:
+                provider, err = NewAPIKeyProvider(providerConfig, redisPoolList, dbList, projectName)
+            case AuthTypeHMAC:
+                provider, err = NewHMACProvider(providerConfig, redisPoolList, projectName)
+            default:
+                err = errors.New("invalid auth provider type: " + providerConfig.Type)
+        }
+
+        if err != nil {
+            return errors.New("cannot load auth provider " + providerConfig.Name + ": " + err.Error())
+        }
+        this.Providers[providerConfig.Name] = provider
+    }
+
+    return nil
+}
+
+// Create a gin middleware which rejects requests that cannot be verified by the named provider.
+// Create the tables of the providers keeping their credentials in a database. Run in bootstrap mode.
+func (this *VascAuth) Bootstrap() error {
+    for name, provider := range this.Providers {
+        if bootstrapper, ok := provider.(interface{ Bootstrap() error }); ok {
+            if err := bootstrapper.Bootstrap(); err != nil {
+                return errors.New("cannot bootstrap auth provider " + name + ": " + err.Error())
+            }
+        }
+    }
+    return nil
+}
+
+func (this *VascAuth) Middleware(name string) (gin.HandlerFunc, error) {
+    provider := this.Providers[name]
+    if provider == nil {
+        return nil, errors.New("cannot find auth provider: " + name)
+    }
+
+    return func(c *gin.Context) {
+        identity, err := provider.Authenticate(c)
+        if err != nil {
+            // Providers may fail with their own status, e.g. a body too large to verify
+            var vascError *verror.VascError
+            if !errors.As(err, &vascError) {
+                vascError = verror.Unauthorized(err.Error())
+            }
+            verror.Render(c, vascError)
+            return
+        }
+
+        identity.Provider = name
+        portal.SetIdentity(c, identity)
+        c.Next()
+    }, nil
+}
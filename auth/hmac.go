@@ -0,0 +1,182 @@
+package auth
+
+import (
+    "bytes"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "github.com/garyburd/redigo/redis"
+    "github.com/gin-gonic/gin"
+    "github.com/marxn/vasc/global"
+    "github.com/marxn/vasc/portal"
+    vredis "github.com/marxn/vasc/redis"
+    "github.com/marxn/vasc/verror"
+    "io"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const HMACKeyIDHeader     = "X-Vasc-Key-Id"
+const HMACTimestampHeader = "X-Vasc-Timestamp"
+const HMACNonceHeader     = "X-Vasc-Nonce"
+const HMACSignatureHeader = "X-Vasc-Signature"
+
+// Requests are signed with HMAC-SHA256 over:
+//   METHOD \n PATH \n RAW_QUERY \n TIMESTAMP \n NONCE \n hex(SHA256(BODY))
+// Secrets come from config, or from redis when storage is "redis".
+type HMACProvider struct {
+    Secrets          map[string]string
+    MaxSkew          time.Duration
+    MaxBodySize      int64
+    RedisConn       *redis.Pool
+    RedisPrefix      string
+    SecretFromRedis  bool
+}
+
+func NewHMACProvider(config *global.AuthProviderConfig, redisPoolList *vredis.VascRedis, projectName string) (*HMACProvider, error) {
+    if redisPoolList == nil || redisPoolList.Get(config.Redis) == nil {
+        return nil, errors.New("cannot get redis instance for nonce check: " + config.Redis)
+    }
+
+    result := &HMACProvider{
+        Secrets:         config.Secrets,
+        MaxSkew:         time.Duration(config.MaxSkew) * time.Second,
+        MaxBodySize:     config.MaxBodySize,
+        RedisConn:       redisPoolList.Get(config.Redis),
+        RedisPrefix:     config.KeyPrefix,
+        SecretFromRedis: config.Storage == APIKeyStorageRedis,
+    }
+    if result.MaxSkew <= 0 {
+        result.MaxSkew = 5 * time.Minute
+    }
+    if result.MaxBodySize <= 0 {
+        result.MaxBodySize = 1 << 20
+    }
+    if result.RedisPrefix == "" {
+        result.RedisPrefix = fmt.Sprintf("VASC:%s:HMAC:", projectName)
+    }
+    if len(result.Secrets) == 0 && !result.SecretFromRedis {
+        return nil, errors.New("no secret configured for hmac")
+    }
+
+    return result, nil
+}
+
+func (this *HMACProvider) Authenticate(c *gin.Context) (*portal.Identity, error) {
+    keyID     := c.Request.Header.Get(HMACKeyIDHeader)
+    timestamp := c.Request.Header.Get(HMACTimestampHeader)
+    nonce     := c.Request.Header.Get(HMACNonceHeader)
+    signature := c.Request.Header.Get(HMACSignatureHeader)
+
+    if keyID == "" || timestamp == "" || nonce == "" || signature == "" {
+        return nil, errors.New("missing signature headers")
+    }
+
+    seconds, err := strconv.ParseInt(timestamp, 10, 64)
+    if err != nil {
+        return nil, errors.New("invalid signature timestamp")
+    }
+    skew := time.Since(time.Unix(seconds, 0))
+    if skew > this.MaxSkew || skew < -this.MaxSkew {
+        return nil, errors.New("signature timestamp out of range")
+    }
+
+    secret, err := this.secret(keyID)
+    if err != nil {
+        return nil, err
+    }
+
+    body, err := readBody(c, this.MaxBodySize)
+    if err != nil {
+        var tooLarge *http.MaxBytesError
+        if errors.As(err, &tooLarge) {
+            return nil, verror.Newf(http.StatusRequestEntityTooLarge, http.StatusRequestEntityTooLarge, "request body exceeds %d bytes", tooLarge.Limit)
+        }
+        return nil, errors.New("cannot read request body")
+    }
+    bodyHash := sha256.Sum256(body)
+
+    content := strings.Join([]string{
+        c.Request.Method,
+        c.Request.URL.Path,
+        c.Request.URL.RawQuery,
+        timestamp,
+        nonce,
+        hex.EncodeToString(bodyHash[:]),
+    }, "\n")
+
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write([]byte(content))
+    expected := mac.Sum(nil)
+
+    if !hmac.Equal(expected, decodeSignature(signature)) {
+        return nil, errors.New("invalid signature")
+    }
+
+    // A nonce can be used only once within the accepted time window
+    redisConn := this.RedisConn.Get()
+    defer redisConn.Close()
+
+    ttl := int64(2 * this.MaxSkew / time.Second)
+    _, err = redis.String(redisConn.Do("SET", this.RedisPrefix + "NONCE:" + keyID + ":" + nonce, timestamp, "EX", ttl, "NX"))
+    if err == redis.ErrNil {
+        return nil, errors.New("replayed request")
+    } else if err != nil {
+        return nil, errors.New("cannot verify nonce")
+    }
+
+    return &portal.Identity{Scheme: AuthTypeHMAC, Subject: keyID}, nil
+}
+
+func (this *HMACProvider) secret(keyID string) (string, error) {
+    if secret := this.Secrets[keyID]; secret != "" {
+        return secret, nil
+    }
+
+    if this.SecretFromRedis {
+        redisConn := this.RedisConn.Get()
+        defer redisConn.Close()
+
+        secret, err := redis.String(redisConn.Do("GET", this.RedisPrefix + "SECRET:" + keyID))
+        if err == nil && secret != "" {
+            return secret, nil
+        } else if err != nil && err != redis.ErrNil {
+            return "", errors.New("cannot load signing secret")
+        }
+    }
+
+    return "", errors.New("unknown key id")
+}
+
+// Accept hex or base64 encoded signatures.
+func decodeSignature(signature string) []byte {
+    if result, err := hex.DecodeString(signature); err == nil {
+        return result
+    }
+    if result, err := base64.StdEncoding.DecodeString(signature); err == nil {
+        return result
+    }
+    return nil
+}
+
+// Read the whole body, up to maxBytes since the caller is not authenticated yet,
+// and put it back for the handler.
+func readBody(c *gin.Context, maxBytes int64) ([]byte, error) {
+    if c.Request.Body == nil {
+        return nil, nil
+    }
+
+    body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes))
+    _ = c.Request.Body.Close()
+    if err != nil {
+        return nil, err
+    }
+
+    c.Request.Body = io.NopCloser(bytes.NewReader(body))
+    return body, nil
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+    "errors"
+    "github.com/gin-gonic/gin"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func bodyContext(body string) *gin.Context {
+    c, _ := gin.CreateTestContext(httptest.NewRecorder())
+    c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+    return c
+}
+
+func TestReadBodyPutsBodyBack(t *testing.T) {
+    c := bodyContext("signed content")
+
+    body, err := readBody(c, 1024)
+    if err != nil || string(body) != "signed content" {
+        t.Fatalf("unexpected body %q, error %v", body, err)
+    }
+
+    again, _ := io.ReadAll(c.Request.Body)
+    if string(again) != "signed content" {
+        t.Fatalf("handler would read %q", again)
+    }
+}
+
+func TestReadBodyLimit(t *testing.T) {
+    _, err := readBody(bodyContext(strings.Repeat("x", 2048)), 1024)
+
+    var tooLarge *http.MaxBytesError
+    if !errors.As(err, &tooLarge) {
+        t.Fatalf("expected the body to be refused, got %v", err)
+    }
+}
@@ -0,0 +1,350 @@
+package auth
+
+import (
+    "crypto"
+    "crypto/hmac"
+    "crypto/rsa"
+    _ "crypto/sha256"
+    _ "crypto/sha512"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/json"
+    "encoding/pem"
+    "errors"
+    "github.com/gin-gonic/gin"
+    "github.com/marxn/vasc/global"
+    "github.com/marxn/vasc/portal"
+    "math/big"
+    "os"
+    "strings"
+    "time"
+)
+
+type jwtKey struct {
+    KeyID       string
+    PublicKey  *rsa.PublicKey
+}
+
+type JWTProvider struct {
+    Header        string
+    Query         string
+    Algorithms    map[string]bool
+    Secret      []byte
+    Keys        []jwtKey
+    Issuer        string
+    Audience      string
+    Leeway        time.Duration
+}
+
+type jwtHeader struct {
+    Algorithm     string   `json:"alg"`
+    KeyID         string   `json:"kid"`
+}
+
+type jwksFile struct {
+    Keys []struct {
+        KeyType   string   `json:"kty"`
+        KeyID     string   `json:"kid"`
+        Use       string   `json:"use"`
+        N         string   `json:"n"`
+        E         string   `json:"e"`
+    } `json:"keys"`
+}
+
+func NewJWTProvider(config *global.AuthProviderConfig) (*JWTProvider, error) {
+    result := &JWTProvider{
+        Header:     config.Header,
+        Query:      config.Query,
+        Algorithms: make(map[string]bool),
+        Secret:     []byte(config.Secret),
+        Issuer:     config.Issuer,
+        Audience:   config.Audience,
+        Leeway:     time.Duration(config.Leeway) * time.Second,
+    }
+    if result.Header == "" {
+        result.Header = "Authorization"
+    }
+
+    if config.PublicKeyFile != "" {
+        key, err := loadPublicKey(config.PublicKeyFile)
+        if err != nil {
+            return nil, err
+        }
+        result.Keys = append(result.Keys, jwtKey{PublicKey: key})
+    }
+
+    if config.JwksFile != "" {
+        keys, err := loadJwks(config.JwksFile)
+        if err != nil {
+            return nil, err
+        }
+        result.Keys = append(result.Keys, keys...)
+    }
+
+    algorithms := config.Algorithms
+    if len(algorithms) == 0 {
+        if len(result.Secret) > 0 {
+            algorithms = append(algorithms, "HS256", "HS384", "HS512")
+        }
+        if len(result.Keys) > 0 {
+            algorithms = append(algorithms, "RS256", "RS384", "RS512")
+        }
+    }
+
+    for _, value := range algorithms {
+        value = strings.ToUpper(value)
+        if _, err := hashForAlgorithm(value); err != nil {
+            return nil, err
+        }
+        if strings.HasPrefix(value, "HS") && len(result.Secret) == 0 {
+            return nil, errors.New("secret is required for " + value)
+        }
+        if strings.HasPrefix(value, "RS") && len(result.Keys) == 0 {
+            return nil, errors.New("public key is required for " + value)
+        }
+        result.Algorithms[value] = true
+    }
+
+    if len(result.Algorithms) == 0 {
+        return nil, errors.New("no key configured for jwt")
+    }
+
+    return result, nil
+}
+
+func (this *JWTProvider) Authenticate(c *gin.Context) (*portal.Identity, error) {
+    token := c.Request.Header.Get(this.Header)
+    if token != "" && strings.EqualFold(this.Header, "Authorization") {
+        if len(token) < 7 || !strings.EqualFold(token[0:7], "Bearer ") {
+            return nil, errors.New("invalid authorization scheme")
+        }
+        token = strings.TrimSpace(token[7:])
+    }
+    if token == "" && this.Query != "" {
+        token = c.Query(this.Query)
+    }
+    if token == "" {
+        return nil, errors.New("missing token")
+    }
+
+    claims, err := this.Verify(token)
+    if err != nil {
+        return nil, err
+    }
+
+    subject, _ := claims["sub"].(string)
+    return &portal.Identity{Scheme: AuthTypeJWT, Subject: subject, Claims: claims}, nil
+}
+
+// Verify signature and registered claims of a compact JWS token.
+func (this *JWTProvider) Verify(token string) (map[string]interface{}, error) {
+    parts := strings.Split(token, ".")
+    if len(parts) != 3 {
+        return nil, errors.New("malformed token")
+    }
+
+    headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+    if err != nil {
+        return nil, errors.New("malformed token header")
+    }
+
+    var header jwtHeader
+    if err := json.Unmarshal(headerBytes, &header); err != nil {
+        return nil, errors.New("malformed token header")
+    }
+
+    if !this.Algorithms[header.Algorithm] {
+        return nil, errors.New("unexpected signing algorithm: " + header.Algorithm)
+    }
+
+    signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+    if err != nil {
+        return nil, errors.New("malformed token signature")
+    }
+
+    if err := this.verifySignature(header, []byte(parts[0] + "." + parts[1]), signature); err != nil {
+        return nil, err
+    }
+
+    payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+    if err != nil {
+        return nil, errors.New("malformed token payload")
+    }
+
+    claims := make(map[string]interface{})
+    decoder := json.NewDecoder(strings.NewReader(string(payload)))
+    decoder.UseNumber()
+    if err := decoder.Decode(&claims); err != nil {
+        return nil, errors.New("malformed token payload")
+    }
+
+    if err := this.verifyClaims(claims); err != nil {
+        return nil, err
+    }
+
+    return claims, nil
+}
+
+func (this *JWTProvider) verifySignature(header jwtHeader, signed []byte, signature []byte) error {
+    hashFunc, _ := hashForAlgorithm(header.Algorithm)
+
+    if strings.HasPrefix(header.Algorithm, "HS") {
+        mac := hmac.New(hashFunc.New, this.Secret)
+        mac.Write(signed)
+        if !hmac.Equal(mac.Sum(nil), signature) {
+            return errors.New("invalid token signature")
+        }
+        return nil
+    }
+
+    hasher := hashFunc.New()
+    hasher.Write(signed)
+    digest := hasher.Sum(nil)
+
+    for _, key := range this.Keys {
+        if header.KeyID != "" && key.KeyID != "" && header.KeyID != key.KeyID {
+            continue
+        }
+        if rsa.VerifyPKCS1v15(key.PublicKey, hashFunc, digest, signature) == nil {
+            return nil
+        }
+    }
+
+    return errors.New("invalid token signature")
+}
+
+func (this *JWTProvider) verifyClaims(claims map[string]interface{}) error {
+    now := time.Now()
+
+    if exp, exists := numericClaim(claims, "exp"); exists && now.After(time.Unix(exp, 0).Add(this.Leeway)) {
+        return errors.New("token expired")
+    }
+    if nbf, exists := numericClaim(claims, "nbf"); exists && now.Add(this.Leeway).Before(time.Unix(nbf, 0)) {
+        return errors.New("token not valid yet")
+    }
+
+    if this.Issuer != "" {
+        if issuer, _ := claims["iss"].(string); issuer != this.Issuer {
+            return errors.New("unexpected token issuer")
+        }
+    }
+
+    if this.Audience != "" {
+        matched := false
+        switch audience := claims["aud"].(type) {
+            case string:
+                matched = audience == this.Audience
+            case []interface{}:
+                for _, value := range audience {
+                    if value == this.Audience {
+                        matched = true
+                        break
+                    }
+                }
+        }
+        if !matched {
+            return errors.New("unexpected token audience")
+        }
+    }
+
+    return nil
+}
+
+func numericClaim(claims map[string]interface{}, name string) (int64, bool) {
+    value, ok := claims[name].(json.Number)
+    if !ok {
+        return 0, false
+    }
+
+    result, err := value.Float64()
+    if err != nil {
+        return 0, false
+    }
+    return int64(result), true
+}
+
+func hashForAlgorithm(algorithm string) (crypto.Hash, error) {
+    switch algorithm {
+        case "HS256", "RS256":
+            return crypto.SHA256, nil
+        case "HS384", "RS384":
+            return crypto.SHA384, nil
+        case "HS512", "RS512":
+            return crypto.SHA512, nil
+        default:
+            return 0, errors.New("unsupported signing algorithm: " + algorithm)
+    }
+}
+
+func loadPublicKey(path string) (*rsa.PublicKey, error) {
+    content, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+
+    block, _ := pem.Decode(content)
+    if block == nil {
+        return nil, errors.New("invalid PEM file: " + path)
+    }
+
+    var key interface{}
+    switch block.Type {
+        case "CERTIFICATE":
+            cert, err := x509.ParseCertificate(block.Bytes)
+            if err != nil {
+                return nil, err
+            }
+            key = cert.PublicKey
+        case "RSA PUBLIC KEY":
+            key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+        default:
+            key, err = x509.ParsePKIXPublicKey(block.Bytes)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    result, ok := key.(*rsa.PublicKey)
+    if !ok {
+        return nil, errors.New("not a RSA public key: " + path)
+    }
+    return result, nil
+}
+
+func loadJwks(path string) ([]jwtKey, error) {
+    content, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+
+    var jwks jwksFile
+    if err := json.Unmarshal(content, &jwks); err != nil {
+        return nil, errors.New("invalid JWKS file: " + path)
+    }
+
+    result := make([]jwtKey, 0, len(jwks.Keys))
+    for _, value := range jwks.Keys {
+        if value.KeyType != "RSA" || (value.Use != "" && value.Use != "sig") {
+            continue
+        }
+
+        n, err := base64.RawURLEncoding.DecodeString(value.N)
+        if err != nil {
+            return nil, errors.New("invalid modulus for key: " + value.KeyID)
+        }
+        e, err := base64.RawURLEncoding.DecodeString(value.E)
+        if err != nil {
+            return nil, errors.New("invalid exponent for key: " + value.KeyID)
+        }
+
+        result = append(result, jwtKey{
+            KeyID:     value.KeyID,
+            PublicKey: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())},
+        })
+    }
+
+    if len(result) == 0 {
+        return nil, errors.New("no RSA signing key in JWKS file: " + path)
+    }
+    return result, nil
+}
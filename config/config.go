@@ -0,0 +1,394 @@
+/*
+ * Configuration files for VascApplication. A configuration is read from JSON, YAML or TOML files,
+ * may include other files and is overlaid by the file of the running environment. The result is
+ * handed over as JSON, as if it had been written in a single file.
+ */
+
+package config
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "github.com/goccy/go-yaml"
+    "github.com/goccy/go-yaml/ast"
+    "github.com/goccy/go-yaml/parser"
+    "github.com/goccy/go-yaml/token"
+    "github.com/pelletier/go-toml/v2"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strings"
+)
+
+// Key listing the files a configuration file includes, relative to it
+const IncludeKey = "include"
+
+// Base file of a configuration directory
+const BaseName = "base"
+
+var extensions = []string{".json", ".yaml", ".yml", ".toml"}
+
+var variablePattern  = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+var referencePattern = regexp.MustCompile(`^\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}$`)
+
+// Marks a variable written as a whole unquoted scalar, e.g. read_timeout: ${RT}. Its value is typed
+// the way it would be if written in the file, so that it can supply a number or a bool.
+const bareMark = "\x00"
+
+// Load the configuration at path for environment, which may be empty.
+// path is either a file, overlaid by <name>.<environment>.<ext> next to it when it exists,
+// or a directory holding base.<ext> overlaid by <environment>.<ext>, e.g. base.json and online.json.
+func Load(path string, environment string) (string, error) {
+    info, err := os.Stat(path)
+    if err != nil {
+        return "", err
+    }
+
+    var base string
+    var overlay string
+    if info.IsDir() {
+        if base = find(filepath.Join(path, BaseName)); base == "" {
+            return "", errors.New("no base configuration file in " + path)
+        }
+        if environment != "" {
+            overlay = find(filepath.Join(path, environment))
+        }
+    } else {
+        base = path
+        if environment != "" {
+            overlay = find(strings.TrimSuffix(path, filepath.Ext(path)) + "." + environment)
+        }
+    }
+
+    result, err := loadFile(base, nil)
+    if err != nil {
+        return "", err
+    }
+
+    if overlay != "" {
+        values, err := loadFile(overlay, nil)
+        if err != nil {
+            return "", err
+        }
+        result = merge(result, values)
+    }
+
+    content, err := json.Marshal(result)
+    if err != nil {
+        return "", fmt.Errorf("cannot encode configuration %s: %v", path, err)
+    }
+    return string(content), nil
+}
+
+// The file named stem with any supported extension.
+func find(stem string) string {
+    for _, extension := range extensions {
+        if info, err := os.Stat(stem + extension); err == nil && !info.IsDir() {
+            return stem + extension
+        }
+    }
+    return ""
+}
+
+// Read filename with the files it includes merged under it. visiting guards against include cycles.
+func loadFile(filename string, visiting []string) (map[string]interface{}, error) {
+    filename, err := filepath.Abs(filename)
+    if err != nil {
+        return nil, err
+    }
+    for _, value := range visiting {
+        if value == filename {
+            return nil, errors.New("configuration includes itself: " + filename)
+        }
+    }
+    visiting = append(visiting, filename)
+
+    content, err := os.ReadFile(filename)
+    if err != nil {
+        return nil, err
+    }
+
+    values, err := parse(content, filepath.Ext(filename))
+    if err != nil {
+        return nil, fmt.Errorf("cannot parse configuration %s: %v", filename, err)
+    }
+
+    var missing []string
+    values = substituteValues(values, &missing).(map[string]interface{})
+    if len(missing) > 0 {
+        return nil, fmt.Errorf("%s: environment variable not set: %s", filename, strings.Join(missing, ", "))
+    }
+
+    includes, err := includeList(values[IncludeKey])
+    if err != nil {
+        return nil, fmt.Errorf("%s: %v", filename, err)
+    }
+    delete(values, IncludeKey)
+
+    result := make(map[string]interface{})
+    for _, value := range includes {
+        if !filepath.IsAbs(value) {
+            value = filepath.Join(filepath.Dir(filename), value)
+        }
+        included, err := loadFile(value, visiting)
+        if err != nil {
+            return nil, err
+        }
+        result = merge(result, included)
+    }
+
+    return merge(result, values), nil
+}
+
+func includeList(value interface{}) ([]string, error) {
+    switch value := value.(type) {
+        case nil:
+            return nil, nil
+        case string:
+            return []string{value}, nil
+        case []interface{}:
+            result := make([]string, 0, len(value))
+            for _, item := range value {
+                name, ok := item.(string)
+                if !ok {
+                    return nil, errors.New("include must list file names")
+                }
+                result = append(result, name)
+            }
+            return result, nil
+        default:
+            return nil, errors.New("include must list file names")
+    }
+}
+
+// Replace ${NAME} by the environment variable NAME, or by default in ${NAME:-default} when it is
+// not set. $$ stands for $. It returns the names of the variables which are neither set nor defaulted.
+func Substitute(value string) (string, []string) {
+    var missing []string
+    result := variablePattern.ReplaceAllStringFunc(value, func(match string) string {
+        if match == "$$" {
+            return "$"
+        }
+
+        groups := variablePattern.FindStringSubmatch(match)
+        if value, exists := os.LookupEnv(groups[1]); exists {
+            return value
+        }
+        if groups[2] != "" {
+            return groups[3]
+        }
+        missing = append(missing, groups[1])
+        return match
+    })
+    return result, missing
+}
+
+// Substitute variables in the string values of a parsed configuration. Only values are touched,
+// so a variable can neither break the file nor add keys to it, and a variable within a comment
+// is never looked at. A variable yields a string, unless it is a whole unquoted scalar and its
+// value reads as a JSON number, bool or null.
+func substituteValues(value interface{}, missing *[]string) interface{} {
+    switch value := value.(type) {
+        case string:
+            bare := strings.HasPrefix(value, bareMark)
+            result, names := Substitute(strings.TrimPrefix(value, bareMark))
+            *missing = append(*missing, names...)
+            if bare {
+                return scalar(result)
+            }
+            return result
+        case map[string]interface{}:
+            for key, item := range value {
+                value[key] = substituteValues(item, missing)
+            }
+            return value
+        case []interface{}:
+            for index, item := range value {
+                value[index] = substituteValues(item, missing)
+            }
+            return value
+        default:
+            return value
+    }
+}
+
+// Never an object or a list, which would let a variable add keys.
+func scalar(text string) interface{} {
+    var result interface{}
+    if json.Unmarshal([]byte(text), &result) != nil {
+        return text
+    }
+    switch result.(type) {
+        case float64, bool, nil:
+            return result
+        default:
+            return text
+    }
+}
+
+// Decode content according to the file extension. Variables written as a whole unquoted scalar
+// are marked with bareMark, which is removed by substituteValues.
+func parse(content []byte, extension string) (map[string]interface{}, error) {
+    result := make(map[string]interface{})
+
+    var err error
+    switch strings.ToLower(extension) {
+        case ".json":
+            err = json.Unmarshal(markBareReferences(content, false), &result)
+        case ".yaml", ".yml":
+            result, err = parseYAML(content)
+        case ".toml":
+            err = toml.Unmarshal(markBareReferences(content, true), &result)
+        default:
+            return nil, errors.New("unsupported configuration format: " + extension)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    if result == nil {
+        result = make(map[string]interface{})
+    }
+    return normalize(result).(map[string]interface{}), nil
+}
+
+// JSON and TOML do not allow an unquoted ${VAR}, so each one outside strings and comments
+// is turned into a marked string.
+func markBareReferences(content []byte, isTOML bool) []byte {
+    var result bytes.Buffer
+    for index := 0; index < len(content); {
+        switch char := content[index]; {
+            case char == '"' || (isTOML && char == '\''):
+                end := stringEnd(content, index, isTOML)
+                result.Write(content[index:end])
+                index = end
+            case isTOML && char == '#':
+                end := bytes.IndexByte(content[index:], '\n')
+                if end < 0 {
+                    end = len(content) - index
+                }
+                result.Write(content[index:index + end])
+                index += end
+            case char == '$':
+                location := variablePattern.FindIndex(content[index:])
+                if location != nil && location[0] == 0 && content[index + 1] == '{' {
+                    quoted, _ := json.Marshal(bareMark + string(content[index:index + location[1]]))
+                    result.Write(quoted)
+                    index += location[1]
+                    continue
+                }
+                result.WriteByte(char)
+                index++
+            default:
+                result.WriteByte(char)
+                index++
+        }
+    }
+    return result.Bytes()
+}
+
+// Offset just past the string starting at start, including TOML multi-line and literal strings.
+func stringEnd(content []byte, start int, isTOML bool) int {
+    quote := content[start]
+    if isTOML && bytes.HasPrefix(content[start:], []byte{quote, quote, quote}) {
+        end := bytes.Index(content[start + 3:], []byte{quote, quote, quote})
+        if end < 0 {
+            return len(content)
+        }
+        return start + 3 + end + 3
+    }
+
+    for index := start + 1; index < len(content); index++ {
+        switch content[index] {
+            case '\\':
+                // Literal strings have no escapes
+                if quote == '"' {
+                    index++
+                }
+            case quote:
+                return index + 1
+        }
+    }
+    return len(content)
+}
+
+// A plain YAML scalar ${VAR} parses as a string like a quoted one, so the syntax tree tells them apart.
+func parseYAML(content []byte) (map[string]interface{}, error) {
+    file, err := parser.ParseBytes(content, 0)
+    if err != nil {
+        return nil, err
+    }
+
+    result := make(map[string]interface{})
+    if len(file.Docs) == 0 || file.Docs[0].Body == nil {
+        return result, nil
+    }
+
+    ast.Walk(bareMarker{}, file.Docs[0].Body)
+    if err := yaml.NodeToValue(file.Docs[0].Body, &result); err != nil {
+        return nil, err
+    }
+    return result, nil
+}
+
+type bareMarker struct{}
+
+// Values of mappings and items of sequences, keys are left alone.
+func (this bareMarker) Visit(node ast.Node) ast.Visitor {
+    switch node := node.(type) {
+        case *ast.MappingValueNode:
+            markBareNode(node.Value)
+        case *ast.SequenceNode:
+            for _, value := range node.Values {
+                markBareNode(value)
+            }
+    }
+    return this
+}
+
+func markBareNode(node ast.Node) {
+    value, ok := node.(*ast.StringNode)
+    if ok && value.Token != nil && value.Token.Type == token.StringType && referencePattern.MatchString(value.Value) {
+        value.Value = bareMark + value.Value
+    }
+}
+
+// YAML may decode mappings with keys of any type, which JSON cannot encode.
+func normalize(value interface{}) interface{} {
+    switch value := value.(type) {
+        case map[string]interface{}:
+            for key, item := range value {
+                value[key] = normalize(item)
+            }
+            return value
+        case map[interface{}]interface{}:
+            result := make(map[string]interface{}, len(value))
+            for key, item := range value {
+                result[fmt.Sprint(key)] = normalize(item)
+            }
+            return result
+        case []interface{}:
+            for index, item := range value {
+                value[index] = normalize(item)
+            }
+            return value
+        default:
+            return value
+    }
+}
+
+// Overlay values on base: objects are merged key by key, anything else is replaced.
+func merge(base map[string]interface{}, values map[string]interface{}) map[string]interface{} {
+    for key, value := range values {
+        current, isMap := base[key].(map[string]interface{})
+        overlay, overlayIsMap := value.(map[string]interface{})
+        if isMap && overlayIsMap {
+            base[key] = merge(current, overlay)
+        } else {
+            base[key] = value
+        }
+    }
+    return base
+}
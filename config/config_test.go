@@ -0,0 +1,200 @@
+package config
+
+import (
+    "encoding/json"
+    "github.com/marxn/vasc/global"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+    dir := t.TempDir()
+    for name, content := range files {
+        path := filepath.Join(dir, name)
+        if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+            t.Fatal(err)
+        }
+        if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+    return dir
+}
+
+func load(t *testing.T, path string, environment string) map[string]interface{} {
+    content, err := Load(path, environment)
+    if err != nil {
+        t.Fatal(err)
+    }
+    result := make(map[string]interface{})
+    if err := json.Unmarshal([]byte(content), &result); err != nil {
+        t.Fatal(err)
+    }
+    return result
+}
+
+func TestDirectoryOverlay(t *testing.T) {
+    dir := writeFiles(t, map[string]string{
+        "base.yaml":   "webserver:\n  enable: true\n  listen_address: tcp:0.0.0.0:80\nredis:\n  enable: false\n",
+        "online.json": `{"webserver": {"listen_address": "tcp:0.0.0.0:8080"}}`,
+    })
+
+    result := load(t, dir, "online")
+    webserver := result["webserver"].(map[string]interface{})
+    if webserver["listen_address"] != "tcp:0.0.0.0:8080" || webserver["enable"] != true {
+        t.Fatalf("expected the overlay to be merged into base, got %v", webserver)
+    }
+    if result["redis"].(map[string]interface{})["enable"] != false {
+        t.Fatalf("expected untouched keys of base, got %v", result["redis"])
+    }
+
+    // Without an environment file the base is used as is
+    if load(t, dir, "test")["webserver"].(map[string]interface{})["listen_address"] != "tcp:0.0.0.0:80" {
+        t.Fatal("expected the base configuration")
+    }
+}
+
+func TestFileOverlay(t *testing.T) {
+    dir := writeFiles(t, map[string]string{
+        "app.toml":        "[scheduler]\nenable = true\nlist = [1, 2]\n",
+        "app.online.toml": "[scheduler]\nlist = [3]\n",
+    })
+
+    result := load(t, filepath.Join(dir, "app.toml"), "online")
+    scheduler := result["scheduler"].(map[string]interface{})
+    if scheduler["enable"] != true || !reflect.DeepEqual(scheduler["list"], []interface{}{float64(3)}) {
+        t.Fatalf("expected lists to be replaced and maps merged, got %v", scheduler)
+    }
+}
+
+func TestMissingBase(t *testing.T) {
+    if _, err := Load(writeFiles(t, map[string]string{"online.json": "{}"}), "online"); err == nil {
+        t.Fatal("expected an error without a base file")
+    }
+}
+
+func TestIncludes(t *testing.T) {
+    dir := writeFiles(t, map[string]string{
+        "base.json":        `{"include": ["parts/db.yaml", "parts/cache.json"], "db": {"name": "main"}}`,
+        "parts/db.yaml":    "include: common.yaml\ndb:\n  name: included\n  user: vasc\n",
+        "parts/common.yaml": "log: debug\n",
+        "parts/cache.json": `{"cache": {"enable": true}}`,
+    })
+
+    result := load(t, dir, "")
+    if _, exists := result[IncludeKey]; exists {
+        t.Fatal("include must not be part of the configuration")
+    }
+    db := result["db"].(map[string]interface{})
+    if db["name"] != "main" || db["user"] != "vasc" {
+        t.Fatalf("expected the including file to win over included ones, got %v", db)
+    }
+    if result["log"] != "debug" || result["cache"].(map[string]interface{})["enable"] != true {
+        t.Fatalf("expected nested includes relative to their file, got %v", result)
+    }
+}
+
+func TestIncludeCycle(t *testing.T) {
+    dir := writeFiles(t, map[string]string{
+        "base.yaml": "include: other.yaml\n",
+        "other.yaml": "include: base.yaml\n",
+    })
+    if _, err := Load(dir, ""); err == nil || !strings.Contains(err.Error(), "includes itself") {
+        t.Fatalf("expected an include cycle error, got %v", err)
+    }
+}
+
+func TestSubstituteValues(t *testing.T) {
+    t.Setenv("VASC_TEST_HOST", "db.local")
+    t.Setenv("VASC_TEST_PASSWORD", `p"ss", "admin": true`)
+
+    dir := writeFiles(t, map[string]string{
+        "base.yaml": strings.Join([]string{
+            "# address: ${VASC_TEST_UNSET}",
+            "address: ${VASC_TEST_HOST}:${VASC_TEST_PORT:-3306}",
+            "password: ${VASC_TEST_PASSWORD}",
+            "price: $$5",
+            "list: [\"${VASC_TEST_HOST}\"]",
+            "",
+        }, "\n"),
+    })
+
+    result := load(t, dir, "")
+    if result["address"] != "db.local:3306" || result["price"] != "$5" {
+        t.Fatalf("unexpected substitution: %v", result)
+    }
+    if result["password"] != `p"ss", "admin": true` || result["admin"] != nil {
+        t.Fatalf("a value must stay within its string, got %v", result)
+    }
+    if result["list"].([]interface{})[0] != "db.local" {
+        t.Fatalf("expected substitution within lists, got %v", result["list"])
+    }
+}
+
+func TestSubstituteTypedValues(t *testing.T) {
+    t.Setenv("VASC_TEST_TIMEOUT", "15")
+    t.Setenv("VASC_TEST_ENABLE", "true")
+    t.Setenv("VASC_TEST_PASSWORD", "123456")
+
+    files := map[string]string{
+        "yaml/base.yaml": strings.Join([]string{
+            "enable: ${VASC_TEST_ENABLE}",
+            "read_timeout: ${VASC_TEST_TIMEOUT}",
+            "write_timeout: ${VASC_TEST_UNSET:-30}",
+            "listen_address: \"${VASC_TEST_PASSWORD}\"",
+            "",
+        }, "\n"),
+        "json/base.json": `{"enable": ${VASC_TEST_ENABLE}, "read_timeout": ${VASC_TEST_TIMEOUT}, ` +
+            `"write_timeout": ${VASC_TEST_UNSET:-30}, "listen_address": "${VASC_TEST_PASSWORD}"}`,
+        "toml/base.toml": strings.Join([]string{
+            "# read_timeout = ${VASC_TEST_UNSET}",
+            "enable = ${VASC_TEST_ENABLE}",
+            "read_timeout = ${VASC_TEST_TIMEOUT}",
+            "write_timeout = ${VASC_TEST_UNSET:-30}",
+            "listen_address = '${VASC_TEST_PASSWORD}'",
+            "",
+        }, "\n"),
+    }
+    root := writeFiles(t, files)
+
+    for _, dir := range []string{"yaml", "json", "toml"} {
+        content, err := Load(filepath.Join(root, dir), "")
+        if err != nil {
+            t.Fatalf("%s: %v", dir, err)
+        }
+        var config global.WebServerConfig
+        if err := json.Unmarshal([]byte(content), &config); err != nil {
+            t.Fatalf("%s: expected typed values, got %v in %s", dir, err, content)
+        }
+        if !config.Enable || config.ReadTimeout != 15 || config.WriteTimeout != 30 {
+            t.Fatalf("%s: unexpected values %+v", dir, config)
+        }
+        // A quoted variable stays a string whatever it holds
+        if config.ListenAddr != "123456" {
+            t.Fatalf("%s: expected a string, got %q", dir, config.ListenAddr)
+        }
+    }
+}
+
+func TestSubstituteMissing(t *testing.T) {
+    dir := writeFiles(t, map[string]string{"base.json": `{"password": "${VASC_TEST_UNSET}"}`})
+    if _, err := Load(dir, ""); err == nil || !strings.Contains(err.Error(), "VASC_TEST_UNSET") {
+        t.Fatalf("expected the missing variable to be reported, got %v", err)
+    }
+}
+
+func TestParseNormalizesKeys(t *testing.T) {
+    values, err := parse([]byte("1: one\nnested:\n  true: yes\n"), ".yml")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := json.Marshal(values); err != nil {
+        t.Fatalf("expected values encodable as JSON: %v", err)
+    }
+    if _, err := parse([]byte("{}"), ".ini"); err == nil {
+        t.Fatal("expected an error for an unsupported format")
+    }
+}
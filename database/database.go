@@ -4,6 +4,7 @@ import (
     "errors"
     "fmt"
     "github.com/marxn/vasc/global"
+    "github.com/marxn/vasc/tracing"
     "log/syslog"
     "time"
     "xorm.io/xorm"
@@ -16,6 +17,7 @@ type VascDBEngine struct {
 
 type VascDataBase struct {
     Engine map[string]*xorm.Engine
+    Config *global.DatabaseConfig
 }
 
 func (this *VascDataBase) LoadConfig(config *global.DatabaseConfig, projectName string) error {
@@ -24,7 +26,9 @@ func (this *VascDataBase) LoadConfig(config *global.DatabaseConfig, projectName
         return errors.New("empty database config")
     }
     
-    var logger *log.SimpleLogger
+    this.Config = config
+    
+    var logger *sqlLogger
 
     if config.EnableLogger {
         logWriter, err := syslog.New(syslog.LOG_INFO|syslog.LOG_LOCAL6, projectName + "/_xorm")
@@ -32,7 +36,7 @@ func (this *VascDataBase) LoadConfig(config *global.DatabaseConfig, projectName
             return err
         }
         
-        logger = log.NewSimpleLogger(logWriter)
+        logger = &sqlLogger{log.NewLoggerAdapter(log.NewSimpleLogger(logWriter))}
         logger.ShowSQL(true)
     }
     
@@ -73,6 +77,10 @@ func (this *VascDataBase) LoadConfig(config *global.DatabaseConfig, projectName
         if config.EnableLogger {
             this.Engine[value.Key].SetLogger(logger)
         }
+        
+        if tracing.Enabled() {
+            this.Engine[value.Key].AddHook(tracing.NewXormHook(value.Key, this.Engine[value.Key].DriverName()))
+        }
     }
 
     return this.InitDatabase()
@@ -0,0 +1,26 @@
+package database
+
+import (
+    "github.com/marxn/vasc/logger"
+    "xorm.io/xorm/log"
+)
+
+// SQL logger which puts the TxID of the statement's context in front, so that statements
+// issued through a portal can be matched with the handler's log lines.
+type sqlLogger struct {
+    log.ContextLogger
+}
+
+func (this *sqlLogger) AfterSQL(ctx log.LogContext) {
+    txID, ok := logger.TxIDFromContext(ctx.Ctx)
+    if !ok {
+        this.ContextLogger.AfterSQL(ctx)
+        return
+    }
+    
+    if ctx.ExecuteTime > 0 {
+        this.Infof("tid[%016x] [SQL] %s %v - %v", txID, ctx.SQL, ctx.Args, ctx.ExecuteTime)
+    } else {
+        this.Infof("tid[%016x] [SQL] %s %v", txID, ctx.SQL, ctx.Args)
+    }
+}
@@ -0,0 +1,29 @@
+package database
+
+import (
+    "errors"
+    "strings"
+)
+
+// Tell whether err means the transaction was aborted by a deadlock or a serialization
+// failure, so that running it again may succeed. The driver is chosen by the application,
+// so SQLSTATE is used when the error exposes it and the message otherwise.
+func IsRetryable(err error) bool {
+    if err == nil {
+        return false
+    }
+    
+    var stateError interface{ SQLState() string }
+    if errors.As(err, &stateError) {
+        state := stateError.SQLState()
+        return state == "40001" || state == "40P01"
+    }
+    
+    message := err.Error()
+    for _, value := range []string{"Error 1213", "(40001)", "Deadlock found", "deadlock detected", "could not serialize access"} {
+        if strings.Contains(message, value) {
+            return true
+        }
+    }
+    return false
+}
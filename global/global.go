@@ -1,6 +1,121 @@
 package global
 
-import "github.com/gin-gonic/gin"
+import (
+    "github.com/gin-gonic/gin"
+    "google.golang.org/grpc"
+)
+
+type ListenerConfig struct {
+    Key               string         `json:"key"`
+    ListenAddr        string         `json:"listen_address"`
+    ListenRetry       int            `json:"listen_retry"`
+    ReadTimeout       int            `json:"read_timeout"`
+    WriteTimeout      int            `json:"write_timeout"`
+    IdleTimeout       int            `json:"idle_timeout"`
+    EnableH2C         bool           `json:"enable_h2c"`
+}
+
+type CorsConfig struct {
+    AllowOrigins      []string       `json:"allow_origins"`
+    AllowMethods      []string       `json:"allow_methods"`
+    AllowHeaders      []string       `json:"allow_headers"`
+    ExposeHeaders     []string       `json:"expose_headers"`
+    AllowCredentials    bool         `json:"allow_credentials"`
+    MaxAge              int          `json:"max_age"`
+}
+
+type CompressConfig struct {
+    Level               int          `json:"level"`
+    MinLength           int          `json:"min_length"`
+    ContentTypes      []string       `json:"content_types"`
+    DisableBrotli       bool         `json:"disable_brotli"`
+}
+
+type BodyLimitConfig struct {
+    MaxBytes            int64        `json:"max_bytes"`
+}
+
+type RealIPConfig struct {
+    TrustedProxies    []string       `json:"trusted_proxies"`
+    Headers           []string       `json:"headers"`
+}
+
+type RequestIDConfig struct {
+    Header              string       `json:"header"`
+}
+
+type SecurityHeadersConfig struct {
+    FrameOptions           string    `json:"frame_options"`
+    ReferrerPolicy         string    `json:"referrer_policy"`
+    ContentSecurityPolicy  string    `json:"content_security_policy"`
+    HSTSMaxAge             int       `json:"hsts_max_age"`
+    HSTSIncludeSubdomains  bool      `json:"hsts_include_subdomains"`
+}
+
+type MiddlewareConfig struct {
+    Cors              *CorsConfig            `json:"cors"`
+    Compress          *CompressConfig        `json:"compress"`
+    BodyLimit         *BodyLimitConfig       `json:"body_limit"`
+    RealIP            *RealIPConfig          `json:"real_ip"`
+    RequestID         *RequestIDConfig       `json:"request_id"`
+    SecurityHeaders   *SecurityHeadersConfig `json:"security_headers"`
+}
+
+type AuthProviderConfig struct {
+    Name              string             `json:"name"`
+    Type              string             `json:"type"`
+    Header            string             `json:"header"`
+    Query             string             `json:"query"`
+    Algorithms      []string             `json:"algorithms"`
+    Secret            string             `json:"secret"`
+    PublicKeyFile     string             `json:"public_key_file"`
+    JwksFile          string             `json:"jwks_file"`
+    Issuer            string             `json:"issuer"`
+    Audience          string             `json:"audience"`
+    Leeway            int                `json:"leeway"`
+    Storage           string             `json:"storage"`
+    Redis             string             `json:"redis"`
+    Database          string             `json:"database"`
+    KeyPrefix         string             `json:"key_prefix"`
+    Secrets           map[string]string  `json:"secrets"`
+    MaxSkew           int                `json:"max_skew"`
+    MaxBodySize       int64              `json:"max_body_size"`
+}
+
+type AuthConfig struct {
+    ProviderList    []AuthProviderConfig `json:"provider_list"`
+}
+
+type ErrorResponseConfig struct {
+    Envelope          string             `json:"envelope"`
+    CodeField         string             `json:"code_field"`
+    MessageField      string             `json:"message_field"`
+    DetailsField      string             `json:"details_field"`
+    TraceField        string             `json:"trace_field"`
+}
+
+type OpenAPIConfig struct {
+    Enable            bool               `json:"enable"`
+    Path              string             `json:"path"`
+    DocsPath          string             `json:"docs_path"`
+    DisableDocs       bool               `json:"disable_docs"`
+    DocsAssets        string             `json:"docs_assets"`
+    Auth              string             `json:"auth"`
+    Title             string             `json:"title"`
+    Version           string             `json:"version"`
+    Description       string             `json:"description"`
+    ServerList      []string             `json:"server_list"`
+}
+
+type StreamConfig struct {
+    PingInterval      int                `json:"ping_interval"`
+    PongTimeout       int                `json:"pong_timeout"`
+    WriteTimeout      int                `json:"write_timeout"`
+    MaxMessageSize    int64              `json:"max_message_size"`
+    SendBuffer        int                `json:"send_buffer"`
+    AllowedOrigins  []string             `json:"allowed_origins"`
+    Redis             string             `json:"redis"`
+}
 
 type WebServerConfig struct {
     Enable            bool           `json:"enable"`
@@ -10,6 +125,78 @@ type WebServerConfig struct {
     ReadTimeout       int            `json:"read_timeout"`
     WriteTimeout      int            `json:"write_timeout"`
     Monitor           bool           `json:"monitor"`
+    ListenerList    []ListenerConfig `json:"listener_list"`
+    Middlewares     []string         `json:"middleware_list"`
+    Middleware       *MiddlewareConfig `json:"middleware"`
+    Auth             *AuthConfig       `json:"auth"`
+    ErrorResponse    *ErrorResponseConfig `json:"error_response"`
+    OpenAPI          *OpenAPIConfig       `json:"openapi"`
+    Stream           *StreamConfig        `json:"stream"`
+    Health           *HealthConfig        `json:"health"`
+    Reload           *ReloadConfig        `json:"reload"`
+}
+
+type HealthConfig struct {
+    Enable            bool               `json:"enable"`
+    Path              string             `json:"path"`
+    Auth              string             `json:"auth"`
+}
+
+type ReloadConfig struct {
+    Enable            bool               `json:"enable"`
+    Path              string             `json:"path"`
+    Auth              string             `json:"auth"`
+}
+
+type RateLimitConfig struct {
+    Rate           int64              `json:"rate"`
+    Period         int64              `json:"period"`
+    Burst          int64              `json:"burst"`
+    KeyBy          string             `json:"key_by"`
+    Mode           string             `json:"mode"`
+    Redis          string             `json:"redis"`
+    Algorithm      string             `json:"algorithm"`
+}
+
+type StaticConfig struct {
+    DisableListing    bool               `json:"disable_listing"`
+    CacheControl      string             `json:"cache_control"`
+    ETag              bool               `json:"etag"`
+    Precompressed     bool               `json:"precompressed"`
+    SPAFallback       bool               `json:"spa_fallback"`
+    Index             string             `json:"index"`
+    FileSystem        string             `json:"file_system"`
+}
+
+type ProxyRewriteRule struct {
+    From              string             `json:"from"`
+    To                string             `json:"to"`
+}
+
+type ProxyConfig struct {
+    UpstreamList    []string             `json:"upstream_list"`
+    Balance           string             `json:"balance"`
+    StripPrefix       string             `json:"strip_prefix"`
+    Rewrite         []ProxyRewriteRule   `json:"rewrite"`
+    SetHeaders        map[string]string  `json:"set_headers"`
+    RemoveHeaders   []string             `json:"remove_headers"`
+    PreserveHost      bool               `json:"preserve_host"`
+    ConnectTimeout    int                `json:"connect_timeout"`
+    Timeout           int                `json:"timeout"`
+    Retries           int                `json:"retries"`
+    RetryBodyLimit    int64              `json:"retry_body_limit"`
+    MaxFails          int                `json:"max_fails"`
+    FailTimeout       int                `json:"fail_timeout"`
+}
+
+type ResponseCacheConfig struct {
+    Name              string             `json:"name"`
+    TTL               int                `json:"ttl"`
+    VaryQuery       []string             `json:"vary_query"`
+    VaryHeaders     []string             `json:"vary_headers"`
+    Storage           string             `json:"storage"`
+    Redis             string             `json:"redis"`
+    MaxBodySize       int64              `json:"max_body_size"`
 }
 
 type VascRoute struct {
@@ -20,11 +207,22 @@ type VascRoute struct {
     RouteHandler   gin.HandlerFunc    `json:"-"`
     LocalFilePath  string             `json:"local_file_path"`
     Timeout        int                `json:"timeout"`
+    Auth           string             `json:"auth"`
+    RateLimit     *RateLimitConfig    `json:"rate_limit"`
+    Middlewares  []string             `json:"middleware_list"`
+    Disable        bool               `json:"disable"`
+    Static        *StaticConfig       `json:"static"`
+    Proxy         *ProxyConfig        `json:"proxy"`
+    Cache         *ResponseCacheConfig `json:"cache"`
 }
 
 type VascRouteGroup struct {
     Group          string             `json:"group"`
+    Name           string             `json:"name"`
+    Parent         string             `json:"parent"`
     MiddlewareName string             `json:"middleware"`
+    Auth           string             `json:"auth"`
+    Middlewares  []string             `json:"middleware_list"`
 }
 
 type ControllerConfig struct {
@@ -35,9 +233,13 @@ type ControllerConfig struct {
 }
 
 type VascApplication struct {
-    FuncMap            map[string]interface{}
-    Configuration      string
-    AppConfiguration   string
+    FuncMap                  map[string]interface{}
+    Configuration            string
+    AppConfiguration         string
+    ConfigurationFile        string
+    AppConfigurationFile     string
+    AppConfigurationLoader   func() (string, error)
+    GrpcRegister             func(grpc.ServiceRegistrar)
 }
 
 type TaskConfig struct {
@@ -96,6 +298,84 @@ type CacheConfigFile struct {
     CacheSourceRedis  string         `json:"cache_source_redis"`
 }
 
+type GrpcConfig struct {
+    Enable            bool           `json:"enable"`
+    EnableLogger      bool           `json:"enable_logger"`
+    ListenAddr        string         `json:"listen_address"`
+    ListenRetry       int            `json:"listen_retry"`
+    Timeout           int            `json:"timeout"`
+    MaxRecvMsgSize    int            `json:"max_recv_msg_size"`
+    MaxSendMsgSize    int            `json:"max_send_msg_size"`
+}
+
+type TracingConfig struct {
+    Enable            bool               `json:"enable"`
+    ServiceName       string             `json:"service_name"`
+    Endpoint          string             `json:"endpoint"`
+    Protocol          string             `json:"protocol"`
+    Insecure          bool               `json:"insecure"`
+    SampleRatio      *float64            `json:"sample_ratio"`
+    Timeout           int                `json:"timeout"`
+    Headers           map[string]string  `json:"headers"`
+}
+
+type TenantItem struct {
+    ID                string             `json:"id"`
+    HostList        []string             `json:"host_list"`
+    Database          map[string]string  `json:"database"`
+    Redis             map[string]string  `json:"redis"`
+    RedisPrefix       string             `json:"redis_prefix"`
+}
+
+type TenantConfig struct {
+    Enable            bool               `json:"enable"`
+    Resolve         []string             `json:"resolve"`
+    Header            string             `json:"header"`
+    Claim             string             `json:"claim"`
+    Default           string             `json:"default"`
+    Required          bool               `json:"required"`
+    TenantList      []TenantItem         `json:"tenant_list"`
+}
+
+type CircuitBreakerConfig struct {
+    FailureThreshold  int                `json:"failure_threshold"`
+    OpenTimeout       int                `json:"open_timeout"`
+    HalfOpenRequests  int                `json:"half_open_requests"`
+}
+
+type UpstreamConfig struct {
+    Name              string             `json:"name"`
+    BaseURL           string             `json:"base_url"`
+    Timeout           int                `json:"timeout"`
+    ConnectTimeout    int                `json:"connect_timeout"`
+    MaxIdleConns      int                `json:"max_idle_conns"`
+    Retries           int                `json:"retries"`
+    RetryBackoff      int                `json:"retry_backoff"`
+    MaxRetryBackoff   int                `json:"max_retry_backoff"`
+    RetryStatus     []int                `json:"retry_status"`
+    Headers           map[string]string  `json:"headers"`
+    CircuitBreaker   *CircuitBreakerConfig `json:"circuit_breaker"`
+}
+
+type HttpClientConfig struct {
+    Enable            bool               `json:"enable"`
+    EnableLogger      bool               `json:"enable_logger"`
+    UpstreamList    []UpstreamConfig     `json:"upstream_list"`
+}
+
+type ResiliencePolicyConfig struct {
+    Name              string             `json:"name"`
+    Timeout           int                `json:"timeout"`
+    MaxConcurrent     int                `json:"max_concurrent"`
+    MaxWait           int                `json:"max_wait"`
+    CircuitBreaker   *CircuitBreakerConfig `json:"circuit_breaker"`
+}
+
+type ResilienceConfig struct {
+    Enable            bool               `json:"enable"`
+    PolicyList      []ResiliencePolicyConfig `json:"policy_list"`
+}
+
 type VascConfig struct {
     Database    *DatabaseConfig     `json:"database"`
     Redis       *RedisConfig        `json:"redis"`
@@ -103,6 +383,11 @@ type VascConfig struct {
     LocalCache  *CacheConfigFile    `json:"localcache"`
     Scheduler   *ScheduleConfig     `json:"scheduler"`
     Task        *TaskConfig         `json:"task"`
+    Grpc        *GrpcConfig         `json:"grpc"`
+    Tracing     *TracingConfig      `json:"tracing"`
+    Tenant      *TenantConfig       `json:"tenant"`
+    HttpClient  *HttpClientConfig   `json:"http_client"`
+    Resilience  *ResilienceConfig   `json:"resilience"`
 }
 
 type dbConfigItem struct {
@@ -117,4 +402,6 @@ type DatabaseConfig struct {
     Enable             bool          `json:"enable"`
     EnableLogger       bool          `json:"enable_logger"`
     InstanceList     []dbConfigItem  `json:"instance_list"`
+    TxRetries          int           `json:"tx_retries"`
+    TxRetryInterval    int           `json:"tx_retry_interval"`
 }
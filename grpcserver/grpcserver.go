@@ -0,0 +1,131 @@
+/*
+ * gRPC server hosted next to the webserver.
+ * Services are registered by VascApplication.GrpcRegister and handled with a portal
+ * which can be taken from the call context with portal.FromContext.
+ */
+
+package grpcserver
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "github.com/marxn/vasc/global"
+    "github.com/marxn/vasc/webserver"
+    "google.golang.org/grpc"
+    "net"
+    "os"
+    "time"
+)
+
+// Name of the gRPC socket among inherited listeners, e.g. FileDescriptorName= of a systemd socket unit
+const ListenerKey = "grpc"
+
+type VascGrpcServer struct {
+    ProjectName     string
+    Config         *global.GrpcConfig
+    Server         *grpc.Server
+    listener        net.Listener
+    Done            chan struct{}
+}
+
+func (this *VascGrpcServer) LoadConfig(config *global.GrpcConfig, projectName string) error {
+    if config.ListenAddr == "" {
+        return errors.New("no listen address configured for grpc server")
+    }
+    if _, _, err := webserver.ParseListenAddr(config.ListenAddr); err != nil {
+        return err
+    }
+
+    this.ProjectName = projectName
+    this.Config      = config
+    this.Done        = make(chan struct{})
+
+    options := []grpc.ServerOption{
+        grpc.ChainUnaryInterceptor(this.unaryInterceptor),
+        grpc.ChainStreamInterceptor(this.streamInterceptor),
+    }
+    if config.MaxRecvMsgSize > 0 {
+        options = append(options, grpc.MaxRecvMsgSize(config.MaxRecvMsgSize))
+    }
+    if config.MaxSendMsgSize > 0 {
+        options = append(options, grpc.MaxSendMsgSize(config.MaxSendMsgSize))
+    }
+    this.Server = grpc.NewServer(options...)
+
+    return nil
+}
+
+func (this *VascGrpcServer) LoadServices(app *global.VascApplication) error {
+    if app.GrpcRegister == nil {
+        return errors.New("grpc server is enabled but no service is registered for project: " + this.ProjectName)
+    }
+
+    app.GrpcRegister(this.Server)
+    if len(this.Server.GetServiceInfo()) == 0 {
+        return errors.New("no grpc service registered for project: " + this.ProjectName)
+    }
+    return nil
+}
+
+func (this *VascGrpcServer) Start() error {
+    network, location, err := webserver.ParseListenAddr(this.Config.ListenAddr)
+    if err != nil {
+        return err
+    }
+
+    // Prefer the socket handed over by systemd or the previous process, as the webserver does
+    listener, err := webserver.InheritListener(ListenerKey, network, location)
+    if err != nil {
+        return err
+    }
+    if listener == nil {
+        listener, err = webserver.Listen(network, location, this.Config.ListenRetry)
+        if err != nil {
+            return err
+        }
+    }
+    this.listener = listener
+
+    go func() {
+        if err := this.Server.Serve(listener); err != nil && err != grpc.ErrServerStopped {
+            fmt.Printf("serve grpc %s failed: %v\n", this.Config.ListenAddr, err)
+        }
+        <-this.Done
+    }()
+
+    return nil
+}
+
+// Duplicate the listening socket so that it can be passed to a new process.
+func (this *VascGrpcServer) ListenerFiles() ([]*os.File, []string, error) {
+    if this.listener == nil {
+        return nil, nil, nil
+    }
+
+    file, err := webserver.ListenerFile(this.listener)
+    if err != nil || file == nil {
+        return nil, nil, err
+    }
+    return []*os.File{file}, []string{ListenerKey}, nil
+}
+
+// Wait for running calls to finish, for 2 seconds at most like the webserver.
+func (this *VascGrpcServer) Close() {
+    ctx, cancel := context.WithTimeout(context.Background(), 2 * time.Second)
+    defer cancel()
+
+    stopped := make(chan struct{})
+    go func() {
+        this.Server.GracefulStop()
+        close(stopped)
+    }()
+
+    select {
+        case <-stopped:
+        case <-ctx.Done():
+            this.Server.Stop()
+            <-stopped
+    }
+    close(this.Done)
+}
@@ -0,0 +1,146 @@
+package grpcserver
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "github.com/marxn/vasc/portal"
+    "github.com/marxn/vasc/verror"
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/metadata"
+    "google.golang.org/grpc/status"
+    "net/http"
+    "strconv"
+    "time"
+)
+
+// Metadata keys are lower case in gRPC
+const tracerKey = "x-vasc-request-tracer"
+
+var statusCodes = map[int]codes.Code{
+    http.StatusBadRequest:            codes.InvalidArgument,
+    http.StatusUnauthorized:          codes.Unauthenticated,
+    http.StatusForbidden:             codes.PermissionDenied,
+    http.StatusNotFound:              codes.NotFound,
+    http.StatusConflict:              codes.AlreadyExists,
+    http.StatusPreconditionFailed:    codes.FailedPrecondition,
+    http.StatusRequestEntityTooLarge: codes.ResourceExhausted,
+    http.StatusTooManyRequests:       codes.ResourceExhausted,
+    http.StatusNotImplemented:        codes.Unimplemented,
+    http.StatusServiceUnavailable:    codes.Unavailable,
+    http.StatusGatewayTimeout:        codes.DeadlineExceeded,
+}
+
+type serverStream struct {
+    grpc.ServerStream
+    ctx     context.Context
+}
+
+func (this *serverStream) Context() context.Context {
+    return this.ctx
+}
+
+func (this *VascGrpcServer) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (response interface{}, err error) {
+    vContext, ctx, finish := this.newPortal(ctx, info.FullMethod)
+    defer func() {
+        err = finish(recover(), err)
+    }()
+
+    _ = grpc.SetHeader(ctx, metadata.Pairs(tracerKey, fmt.Sprintf("%016x", vContext.TxID)))
+    return handler(ctx, req)
+}
+
+func (this *VascGrpcServer) streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+    vContext, ctx, finish := this.newPortal(stream.Context(), info.FullMethod)
+    defer func() {
+        err = finish(recover(), err)
+    }()
+
+    _ = stream.SetHeader(metadata.Pairs(tracerKey, fmt.Sprintf("%016x", vContext.TxID)))
+    return handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+}
+
+// Build the portal of a call the same way as for http requests: the tracer from metadata,
+// the configured timeout and the per-handler loggers. finish turns a panic or a handler
+// error into a gRPC status and releases the portal.
+func (this *VascGrpcServer) newPortal(parent context.Context, method string) (*portal.Portal, context.Context, func(interface{}, error) error) {
+    var ctx context.Context
+    var cancelFunc context.CancelFunc
+
+    if this.Config.Timeout > 0 {
+        ctx, cancelFunc = context.WithTimeout(parent, time.Second * time.Duration(this.Config.Timeout))
+    } else {
+        ctx, cancelFunc = context.WithCancel(parent)
+    }
+
+    vContext := portal.NewVascContext(this.ProjectName)
+    vContext.HandlerName = method
+    vContext.LogSelector = "grpc"
+
+    if md, ok := metadata.FromIncomingContext(parent); ok {
+        if values := md.Get(tracerKey); len(values) > 0 && values[0] != "" {
+            txID, _ := strconv.ParseUint(values[0], 16, 64)
+            vContext.SetTID(txID)
+        }
+    }
+
+    ctx = portal.NewContext(ctx, vContext)
+    vContext.Context = ctx
+
+    startTime := time.Now()
+    finish := func(panicValue interface{}, err error) error {
+        defer func() {
+            cancelFunc()
+            vContext.Close()
+        }()
+
+        if panicValue != nil {
+            vContext.Logger("_grpc").ErrorLog("Panic:[%v]", panicValue)
+            err = verror.Internal(fmt.Errorf("panic: %v", panicValue))
+        }
+        err = toStatus(vContext, err)
+
+        if this.Config.EnableLogger {
+            code := status.Code(err)
+            cost := time.Since(startTime).Milliseconds()
+            if code == codes.OK || code == codes.Canceled {
+                vContext.Logger("_grpc").InfoLog("%s: cost[%d ms], code[%s]", method, cost, code)
+            } else {
+                vContext.Logger("_grpc").ErrorLog("%s: cost[%d ms], code[%s], error[%v]", method, cost, code, err)
+            }
+        }
+        return err
+    }
+
+    return vContext, ctx, finish
+}
+
+// Convert a handler error to a gRPC status. Statuses are kept, VascErrors are mapped by
+// their HTTP status and anything else becomes an internal error whose cause is only logged.
+func toStatus(vContext *portal.Portal, err error) error {
+    if err == nil {
+        return nil
+    }
+    if _, ok := status.FromError(err); ok {
+        return err
+    }
+    if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+        return status.FromContextError(err).Err()
+    }
+
+    vascError := verror.From(err)
+    if vascError.Status >= http.StatusInternalServerError {
+        vContext.DefaultErrorLog("%v", vascError)
+    }
+
+    code, exists := statusCodes[vascError.Status]
+    if !exists {
+        if vascError.Status >= http.StatusInternalServerError {
+            code = codes.Internal
+        } else {
+            code = codes.Unknown
+        }
+    }
+    return status.Error(code, vascError.Message)
+}
@@ -0,0 +1,321 @@
+/*
+ * Client for the HTTP upstreams a service depends on. Requests are retried with backoff,
+ * stopped by a circuit breaker per upstream and traced as part of the caller.
+ */
+
+package httpclient
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "github.com/marxn/vasc/global"
+    "github.com/marxn/vasc/logger"
+    "github.com/marxn/vasc/resilience"
+    "github.com/marxn/vasc/tracing"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/trace"
+    "io"
+    "math/rand"
+    "net"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+)
+
+const tracerHeader = "X-Vasc-Request-Tracer"
+
+var idempotentMethods = map[string]bool{
+    http.MethodGet:     true,
+    http.MethodHead:    true,
+    http.MethodOptions: true,
+    http.MethodPut:     true,
+    http.MethodDelete:  true,
+}
+
+var defaultRetryStatus = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+type VascHttpClient struct {
+    ProjectName     string
+    Config         *global.HttpClientConfig
+    upstreams       map[string]*Upstream
+}
+
+type Upstream struct {
+    Name            string
+    Config         *global.UpstreamConfig
+    BaseURL        *url.URL
+    Client         *http.Client
+    Breaker        *resilience.CircuitBreaker
+    retryStatus     map[int]bool
+    enableLogger    bool
+}
+
+func (this *VascHttpClient) LoadConfig(config *global.HttpClientConfig, projectName string) error {
+    this.ProjectName = projectName
+    this.Config      = config
+    this.upstreams   = make(map[string]*Upstream)
+
+    for index := range config.UpstreamList {
+        value := &config.UpstreamList[index]
+        if value.Name == "" {
+            return errors.New("empty upstream name")
+        }
+        if this.upstreams[value.Name] != nil {
+            return errors.New("duplicated upstream: " + value.Name)
+        }
+
+        baseURL, err := url.Parse(value.BaseURL)
+        if err != nil || baseURL.Scheme == "" || baseURL.Host == "" {
+            return errors.New("invalid base url of upstream " + value.Name + ": " + value.BaseURL)
+        }
+
+        upstream := &Upstream{
+            Name:         value.Name,
+            Config:       value,
+            BaseURL:      baseURL,
+            Client:       newClient(value),
+            Breaker:      resilience.NewCircuitBreaker(value.Name, value.CircuitBreaker),
+            retryStatus:  make(map[int]bool),
+            enableLogger: config.EnableLogger,
+        }
+
+        retryStatus := value.RetryStatus
+        if len(retryStatus) == 0 {
+            retryStatus = defaultRetryStatus
+        }
+        for _, status := range retryStatus {
+            upstream.retryStatus[status] = true
+        }
+
+        this.upstreams[value.Name] = upstream
+    }
+
+    return nil
+}
+
+func newClient(config *global.UpstreamConfig) *http.Client {
+    connectTimeout := time.Duration(config.ConnectTimeout) * time.Second
+    if connectTimeout <= 0 {
+        connectTimeout = 5 * time.Second
+    }
+    maxIdleConns := config.MaxIdleConns
+    if maxIdleConns <= 0 {
+        maxIdleConns = 64
+    }
+
+    return &http.Client{
+        Timeout: time.Duration(config.Timeout) * time.Second,
+        Transport: &http.Transport{
+            Proxy:               http.ProxyFromEnvironment,
+            DialContext:         (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext,
+            MaxIdleConnsPerHost: maxIdleConns,
+            IdleConnTimeout:     90 * time.Second,
+            TLSHandshakeTimeout: connectTimeout,
+        },
+    }
+}
+
+func (this *VascHttpClient) Upstream(name string) (*Upstream, error) {
+    result := this.upstreams[name]
+    if result == nil {
+        return nil, errors.New("unknown upstream: " + name)
+    }
+    return result, nil
+}
+
+// Report the state of the circuit breaker of every upstream.
+func (this *VascHttpClient) Breakers() map[string]resilience.State {
+    result := make(map[string]resilience.State)
+    for name, value := range this.upstreams {
+        result[name] = value.Breaker.State()
+    }
+    return result
+}
+
+func (this *VascHttpClient) Close() {
+    for _, value := range this.upstreams {
+        value.Client.CloseIdleConnections()
+    }
+}
+
+// Return a client whose requests end with ctx, carry tracer and are logged to log.
+// log may be nil.
+func (this *Upstream) Bind(ctx context.Context, tracer string, log *logger.VascLogger) *Client {
+    if log == nil {
+        log = logger.EmptyLogger()
+    }
+    return &Client{upstream: this, ctx: ctx, tracer: tracer, logger: log}
+}
+
+type Client struct {
+    upstream       *Upstream
+    ctx             context.Context
+    tracer          string
+    logger         *logger.VascLogger
+}
+
+// Build a request to path relative to the base url of the upstream. path may carry a query.
+func (this *Client) NewRequest(method string, path string, body []byte) (*http.Request, error) {
+    reference, err := url.Parse(path)
+    if err != nil {
+        return nil, err
+    }
+    if reference.IsAbs() {
+        return nil, errors.New("path must be relative to upstream " + this.upstream.Name + ": " + path)
+    }
+
+    target := *this.upstream.BaseURL
+    target.Path     = strings.TrimSuffix(target.Path, "/") + "/" + strings.TrimPrefix(reference.Path, "/")
+    target.RawPath  = ""
+    target.RawQuery = reference.RawQuery
+
+    var requestBody io.Reader
+    if body != nil {
+        requestBody = bytes.NewReader(body)
+    }
+    return http.NewRequestWithContext(this.ctx, method, target.String(), requestBody)
+}
+
+func (this *Client) Get(path string) (*http.Response, error) {
+    request, err := this.NewRequest(http.MethodGet, path, nil)
+    if err != nil {
+        return nil, err
+    }
+    return this.Do(request)
+}
+
+func (this *Client) Post(path string, contentType string, body []byte) (*http.Response, error) {
+    request, err := this.NewRequest(http.MethodPost, path, body)
+    if err != nil {
+        return nil, err
+    }
+    request.Header.Set("Content-Type", contentType)
+    return this.Do(request)
+}
+
+// Send request, retrying failed attempts of idempotent ones, and those carrying an Idempotency-Key,
+// as long as the body can be sent again. The response of the last attempt is returned as is,
+// even with a retryable status. Nothing is sent while the circuit breaker is open.
+func (this *Client) Do(request *http.Request) (*http.Response, error) {
+    retries := 0
+    if idempotentMethods[request.Method] || request.Header.Get("Idempotency-Key") != "" {
+        retries = this.upstream.Config.Retries
+    }
+    if request.Body != nil && request.Body != http.NoBody && request.GetBody == nil {
+        retries = 0
+    }
+
+    for attempt := 0; ; attempt++ {
+        if attempt > 0 {
+            timer := time.NewTimer(this.backoff(attempt))
+            select {
+                case <-this.ctx.Done():
+                    timer.Stop()
+                    return nil, this.ctx.Err()
+                case <-timer.C:
+            }
+        }
+
+        response, err := this.send(request, attempt)
+        retryable := (err != nil && this.ctx.Err() == nil && !errors.Is(err, resilience.ErrOpen)) ||
+            (err == nil && this.upstream.retryStatus[response.StatusCode])
+
+        if !retryable || attempt >= retries {
+            return response, err
+        }
+        if response != nil {
+            io.Copy(io.Discard, io.LimitReader(response.Body, 64 * 1024))
+            response.Body.Close()
+        }
+    }
+}
+
+// Exponential backoff with jitter, 100ms doubling up to 2s unless configured.
+func (this *Client) backoff(attempt int) time.Duration {
+    base := time.Duration(this.upstream.Config.RetryBackoff) * time.Millisecond
+    if base <= 0 {
+        base = 100 * time.Millisecond
+    }
+    limit := time.Duration(this.upstream.Config.MaxRetryBackoff) * time.Millisecond
+    if limit <= 0 {
+        limit = 2 * time.Second
+    }
+
+    delay := limit
+    if attempt < 16 && base << (attempt - 1) < limit {
+        delay = base << (attempt - 1)
+    }
+    return delay / 2 + time.Duration(rand.Int63n(int64(delay / 2) + 1))
+}
+
+func (this *Client) send(request *http.Request, attempt int) (*http.Response, error) {
+    upstream := this.upstream
+    if err := this.ctx.Err(); err != nil {
+        return nil, err
+    }
+    if err := upstream.Breaker.Allow(); err != nil {
+        this.logger.WarnLog("%s %s: upstream %s: %v", request.Method, request.URL.Path, upstream.Name, err)
+        return nil, fmt.Errorf("upstream %s: %w", upstream.Name, err)
+    }
+
+    ctx, span := tracing.Tracer().Start(this.ctx, "HTTP " + request.Method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+        attribute.String("http.request.method", request.Method),
+        attribute.String("url.full", request.URL.String()),
+        attribute.String("server.address", request.URL.Host),
+        attribute.String("vasc.upstream", upstream.Name),
+        attribute.Int("http.request.resend_count", attempt),
+    ))
+    defer span.End()
+
+    outgoing := request.Clone(ctx)
+    if attempt > 0 && request.GetBody != nil {
+        body, err := request.GetBody()
+        if err != nil {
+            upstream.Breaker.Discard()
+            return nil, err
+        }
+        outgoing.Body = body
+    }
+
+    for key, value := range upstream.Config.Headers {
+        if outgoing.Header.Get(key) == "" {
+            outgoing.Header.Set(key, value)
+        }
+    }
+    if this.tracer != "" && outgoing.Header.Get(tracerHeader) == "" {
+        outgoing.Header.Set(tracerHeader, this.tracer)
+    }
+    tracing.InjectContext(ctx, outgoing.Header)
+
+    start := time.Now()
+    response, err := upstream.Client.Do(outgoing)
+    cost := time.Since(start).Milliseconds()
+
+    if err != nil {
+        tracing.RecordError(span, err)
+        if this.ctx.Err() != nil {
+            upstream.Breaker.Discard()
+        } else {
+            upstream.Breaker.Report(false)
+        }
+        this.logger.ErrorLog("%s %s: upstream %s attempt %d failed after %dms: %v", request.Method, request.URL.Path, upstream.Name, attempt + 1, cost, err)
+        return nil, err
+    }
+
+    span.SetAttributes(attribute.Int("http.response.status_code", response.StatusCode))
+    if response.StatusCode >= http.StatusInternalServerError {
+        span.SetStatus(codes.Error, http.StatusText(response.StatusCode))
+        upstream.Breaker.Report(false)
+        this.logger.WarnLog("%s %s: upstream %s attempt %d returned %d after %dms", request.Method, request.URL.Path, upstream.Name, attempt + 1, response.StatusCode, cost)
+    } else {
+        upstream.Breaker.Report(true)
+        if upstream.enableLogger {
+            this.logger.InfoLog("%s %s: upstream %s returned %d after %dms", request.Method, request.URL.Path, upstream.Name, response.StatusCode, cost)
+        }
+    }
+    return response, nil
+}
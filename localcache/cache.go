@@ -17,6 +17,7 @@ import (
     "io/ioutil"
     "math/rand"
     "os"
+    "sync"
     "time"
 )
 
@@ -30,6 +31,7 @@ type CacheManager struct {
     RedisConn  *redis.Pool
     RedisPrefix string
     Expiration  map[string]int64
+    mutex       sync.RWMutex
 }
 
 
@@ -78,7 +80,7 @@ func (this * CacheManager) ReadKV(key string, needSync bool) (string, error) {
         if err!=nil {
             return "", err
         }
-        _ = this.SaveToFS(key, value, this.Expiration[key])
+        _ = this.SaveToFS(key, value, this.expiration(key))
     }
 
     return value, err
@@ -108,11 +110,37 @@ func (this * CacheManager) SaveToFS(key string, value string, expiration int64)
 	    return err
 	}
 
+	this.mutex.Lock()
 	this.Expiration[key] = expiration
+	this.mutex.Unlock()
 
 	return nil
 }
 
+func (this * CacheManager) RemoveFromFS(key string) error {
+    keyHash1 := pathHash(key, mod_factor1)
+    keyHash2 := pathHash(key, mod_factor2)
+    keyHash3 := pathHash(key, mod_factor3)
+    keyFile  := fileHash(key)
+
+    err := os.Remove(fmt.Sprintf("%s/%d/%d/%d/%s", this.FSRoot, keyHash1, keyHash2, keyHash3, keyFile))
+    if err != nil && !os.IsNotExist(err) {
+        return err
+    }
+
+    this.mutex.Lock()
+    delete(this.Expiration, key)
+    this.mutex.Unlock()
+
+    return nil
+}
+
+func (this * CacheManager) expiration(key string) int64 {
+    this.mutex.RLock()
+    defer this.mutex.RUnlock()
+    return this.Expiration[key]
+}
+
 func (this * CacheManager) GetFromFS(key string) (string, error) {
     keyHash1 := pathHash(key, mod_factor1)
     keyHash2 := pathHash(key, mod_factor2)
@@ -127,7 +155,7 @@ func (this * CacheManager) GetFromFS(key string) (string, error) {
         return "", errors.New("key/value does not exist")
     }
 
-    keyExprTime := this.Expiration[key]
+    keyExprTime := this.expiration(key)
 
     if keyExprTime != 0 && statRet.ModTime().Unix() - time.Now().Unix() > keyExprTime {
         _ = os.Remove(valueFilePath)
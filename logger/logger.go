@@ -1,5 +1,6 @@
 package logger
 
+import "context"
 import "fmt"
 import "log/syslog"
 import "sync"
@@ -18,9 +19,24 @@ func SetProjectName(name string) {
     projectName = name
 }
 
+type txIDKey struct{}
+
+// Attach txID to parent so that work done under the context, such as SQL statements,
+// is logged with the TxID of the handler which started it.
+func NewContext(parent context.Context, txID uint64) context.Context {
+    return context.WithValue(parent, txIDKey{}, txID)
+}
+
+// Return the TxID attached by NewContext.
+func TxIDFromContext(ctx context.Context) (uint64, bool) {
+    txID, ok := ctx.Value(txIDKey{}).(uint64)
+    return txID, ok
+}
+
 type VascLogger struct {
     LogLevel    int
     TxID        uint64
+    Tenant      string
     Logger     *syslog.Writer
 }
 
@@ -33,6 +49,10 @@ func (this *VascLogger) VLogger(tid uint64, level int, s string) {
         return
     }
     
+    if this.Tenant != "" {
+        s = fmt.Sprintf("tenant[%s] %s", this.Tenant, s)
+    }
+    
     switch level {
         case LOG_DEBUG:
             _ = this.Logger.Debug(fmt.Sprintf("[debug] tid[%016x] %s", tid, s))
@@ -0,0 +1,223 @@
+package middleware
+
+import (
+    "bufio"
+    "compress/gzip"
+    "errors"
+    "github.com/andybalholm/brotli"
+    "github.com/gin-gonic/gin"
+    "github.com/marxn/vasc/global"
+    "io"
+    "net"
+    "net/http"
+    "strconv"
+    "strings"
+)
+
+var defaultCompressTypes = []string{
+    "text/",
+    "application/json",
+    "application/javascript",
+    "application/xml",
+    "image/svg+xml",
+}
+
+type compressPolicy struct {
+    level          int
+    minLength      int
+    contentTypes []string
+    brotli         bool
+}
+
+func newCompress(config *global.MiddlewareConfig) (gin.HandlerFunc, error) {
+    compressConfig := config.Compress
+    if compressConfig == nil {
+        compressConfig = &global.CompressConfig{}
+    }
+
+    policy := &compressPolicy{
+        level        : compressConfig.Level,
+        minLength    : compressConfig.MinLength,
+        contentTypes : compressConfig.ContentTypes,
+        brotli       : !compressConfig.DisableBrotli,
+    }
+    if policy.level == 0 {
+        policy.level = gzip.DefaultCompression
+    }
+    if policy.level < gzip.HuffmanOnly || policy.level > gzip.BestCompression {
+        return nil, errors.New("invalid compress level: " + strconv.Itoa(policy.level))
+    }
+    if policy.minLength <= 0 {
+        policy.minLength = 1024
+    }
+    if len(policy.contentTypes) == 0 {
+        policy.contentTypes = defaultCompressTypes
+    }
+
+    return policy.handle, nil
+}
+
+func (this *compressPolicy) handle(c *gin.Context) {
+    if c.Request.Method == http.MethodHead || c.Request.Header.Get("Upgrade") != "" {
+        c.Next()
+        return
+    }
+
+    encoding := this.negotiate(c.Request.Header.Get("Accept-Encoding"))
+    if encoding == "" {
+        c.Next()
+        return
+    }
+
+    c.Writer.Header().Add("Vary", "Accept-Encoding")
+
+    writer := &compressWriter{ResponseWriter: c.Writer, policy: this, encoding: encoding}
+    c.Writer = writer
+    defer func() {
+        writer.finish()
+        c.Writer = writer.ResponseWriter
+    }()
+
+    c.Next()
+}
+
+func (this *compressPolicy) negotiate(acceptEncoding string) string {
+    gzipAccepted := false
+    for _, item := range strings.Split(acceptEncoding, ",") {
+        parts := strings.Split(strings.TrimSpace(item), ";")
+        name  := strings.ToLower(strings.TrimSpace(parts[0]))
+        if len(parts) > 1 && strings.Replace(strings.TrimSpace(parts[1]), " ", "", -1) == "q=0" {
+            continue
+        }
+        if name == "br" && this.brotli {
+            return "br"
+        }
+        if name == "gzip" || name == "*" {
+            gzipAccepted = true
+        }
+    }
+
+    if gzipAccepted {
+        return "gzip"
+    }
+    return ""
+}
+
+func (this *compressPolicy) compressible(header http.Header) bool {
+    if header.Get("Content-Encoding") != "" {
+        return false
+    }
+
+    contentType := strings.ToLower(header.Get("Content-Type"))
+    if contentType == "" || strings.HasPrefix(contentType, "text/event-stream") {
+        return false
+    }
+
+    for _, value := range this.contentTypes {
+        if strings.HasPrefix(contentType, value) {
+            return true
+        }
+    }
+    return false
+}
+
+// Buffer the head of the response until we know whether it is worth compressing.
+type compressWriter struct {
+    gin.ResponseWriter
+    policy      *compressPolicy
+    encoding     string
+    buffer     []byte
+    decided      bool
+    encoder      io.WriteCloser
+}
+
+func (this *compressWriter) decide(force bool) {
+    if this.decided {
+        return
+    }
+    if !force && len(this.buffer) < this.policy.minLength {
+        return
+    }
+    this.decided = true
+
+    status := this.ResponseWriter.Status()
+    header := this.ResponseWriter.Header()
+    if len(this.buffer) >= this.policy.minLength && status != http.StatusNoContent && status != http.StatusNotModified && status != http.StatusPartialContent && this.policy.compressible(header) {
+        header.Del("Content-Length")
+        header.Set("Content-Encoding", this.encoding)
+        if this.encoding == "br" {
+            this.encoder = brotli.NewWriterLevel(this.ResponseWriter, brotliLevel(this.policy.level))
+        } else {
+            this.encoder, _ = gzip.NewWriterLevel(this.ResponseWriter, this.policy.level)
+        }
+    }
+
+    buffer := this.buffer
+    this.buffer = nil
+    if len(buffer) > 0 {
+        _, _ = this.output(buffer)
+    }
+}
+
+func (this *compressWriter) output(data []byte) (int, error) {
+    if this.encoder != nil {
+        return this.encoder.Write(data)
+    }
+    return this.ResponseWriter.Write(data)
+}
+
+func (this *compressWriter) Write(data []byte) (int, error) {
+    if this.decided {
+        return this.output(data)
+    }
+
+    this.buffer = append(this.buffer, data...)
+    this.decide(false)
+    return len(data), nil
+}
+
+func (this *compressWriter) WriteString(s string) (int, error) {
+    return this.Write([]byte(s))
+}
+
+// Headers are held back until the encoding has been decided
+func (this *compressWriter) WriteHeaderNow() {
+    if this.decided {
+        this.ResponseWriter.WriteHeaderNow()
+    }
+}
+
+func (this *compressWriter) Written() bool {
+    return len(this.buffer) > 0 || this.ResponseWriter.Written()
+}
+
+func (this *compressWriter) Flush() {
+    this.decide(true)
+    if flusher, ok := this.encoder.(interface{ Flush() error }); ok {
+        _ = flusher.Flush()
+    }
+    this.ResponseWriter.Flush()
+}
+
+func (this *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+    this.decide(true)
+    return this.ResponseWriter.Hijack()
+}
+
+func (this *compressWriter) finish() {
+    if !this.decided && len(this.buffer) == 0 {
+        return
+    }
+    this.decide(true)
+    if this.encoder != nil {
+        _ = this.encoder.Close()
+    }
+}
+
+// Map gzip levels onto the brotli range of 0-11.
+func brotliLevel(level int) int {
+    if level < 0 {
+        return brotli.DefaultCompression
+    }
+    return level * brotli.BestCompression / gzip.BestCompression
+}
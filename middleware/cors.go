@@ -0,0 +1,137 @@
+package middleware
+
+import (
+    "errors"
+    "github.com/gin-gonic/gin"
+    "github.com/marxn/vasc/global"
+    "net/http"
+    "strconv"
+    "strings"
+)
+
+var defaultCorsMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
+
+type corsPolicy struct {
+    allowAll          bool
+    origins           map[string]bool
+    suffixes        []string
+    allowMethods      string
+    allowHeaders      string
+    exposeHeaders     string
+    allowCredentials  bool
+    maxAge            string
+}
+
+func newCors(config *global.MiddlewareConfig) (gin.HandlerFunc, error) {
+    // Allowing any origin must be asked for with "*" rather than come from a missing config
+    corsConfig := config.Cors
+    if corsConfig == nil || len(corsConfig.AllowOrigins) == 0 {
+        return nil, errors.New("cors middleware requires middleware.cors.allow_origins")
+    }
+
+    policy := &corsPolicy{
+        origins          : make(map[string]bool),
+        allowHeaders     : strings.Join(corsConfig.AllowHeaders, ", "),
+        exposeHeaders    : strings.Join(corsConfig.ExposeHeaders, ", "),
+        allowCredentials : corsConfig.AllowCredentials,
+        allowMethods     : strings.Join(defaultCorsMethods, ", "),
+    }
+
+    if len(corsConfig.AllowMethods) > 0 {
+        policy.allowMethods = strings.ToUpper(strings.Join(corsConfig.AllowMethods, ", "))
+    }
+    if corsConfig.MaxAge > 0 {
+        policy.maxAge = strconv.Itoa(corsConfig.MaxAge)
+    }
+
+    for _, origin := range corsConfig.AllowOrigins {
+        origin = strings.ToLower(strings.TrimSpace(origin))
+        if origin == "*" {
+            policy.allowAll = true
+        } else if strings.HasPrefix(origin, "*.") {
+            // Wildcard subdomain, e.g. *.example.com
+            policy.suffixes = append(policy.suffixes, origin[1:])
+        } else if origin != "" {
+            policy.origins[origin] = true
+        }
+    }
+
+    // Any site could read responses with the credentials of the user, which browsers refuse for "*"
+    if policy.allowAll && policy.allowCredentials {
+        return nil, errors.New("cors cannot allow credentials for any origin")
+    }
+
+    return policy.handle, nil
+}
+
+func (this *corsPolicy) allowed(origin string) bool {
+    if this.allowAll {
+        return true
+    }
+
+    origin = strings.ToLower(origin)
+    if this.origins[origin] {
+        return true
+    }
+
+    for _, suffix := range this.suffixes {
+        if strings.HasSuffix(origin, suffix) {
+            return true
+        }
+    }
+    return false
+}
+
+func (this *corsPolicy) handle(c *gin.Context) {
+    origin := c.Request.Header.Get("Origin")
+    if origin == "" {
+        c.Next()
+        return
+    }
+
+    header := c.Writer.Header()
+    header.Add("Vary", "Origin")
+
+    preflight := c.Request.Method == http.MethodOptions && c.Request.Header.Get("Access-Control-Request-Method") != ""
+
+    if !this.allowed(origin) {
+        if preflight {
+            c.AbortWithStatus(http.StatusForbidden)
+            return
+        }
+        c.Next()
+        return
+    }
+
+    if this.allowAll {
+        header.Set("Access-Control-Allow-Origin", "*")
+    } else {
+        header.Set("Access-Control-Allow-Origin", origin)
+    }
+    if this.allowCredentials {
+        header.Set("Access-Control-Allow-Credentials", "true")
+    }
+
+    if !preflight {
+        if this.exposeHeaders != "" {
+            header.Set("Access-Control-Expose-Headers", this.exposeHeaders)
+        }
+        c.Next()
+        return
+    }
+
+    header.Add("Vary", "Access-Control-Request-Method")
+    header.Add("Vary", "Access-Control-Request-Headers")
+    header.Set("Access-Control-Allow-Methods", this.allowMethods)
+
+    if this.allowHeaders != "" {
+        header.Set("Access-Control-Allow-Headers", this.allowHeaders)
+    } else if requested := c.Request.Header.Get("Access-Control-Request-Headers"); requested != "" {
+        header.Set("Access-Control-Allow-Headers", requested)
+    }
+    if this.maxAge != "" {
+        header.Set("Access-Control-Max-Age", this.maxAge)
+    }
+
+    c.AbortWithStatus(http.StatusNoContent)
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+    "github.com/gin-gonic/gin"
+    "github.com/marxn/vasc/global"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func corsRequest(t *testing.T, config *global.CorsConfig, method string, origin string) *httptest.ResponseRecorder {
+    handler, err := newCors(&global.MiddlewareConfig{Cors: config})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    gin.SetMode(gin.TestMode)
+    engine := gin.New()
+    engine.Use(handler)
+    engine.Any("/", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+    request := httptest.NewRequest(method, "/", nil)
+    request.Header.Set("Origin", origin)
+    if method == http.MethodOptions {
+        request.Header.Set("Access-Control-Request-Method", http.MethodPost)
+    }
+
+    recorder := httptest.NewRecorder()
+    engine.ServeHTTP(recorder, request)
+    return recorder
+}
+
+func TestCorsRejectsCredentialsForAnyOrigin(t *testing.T) {
+    config := &global.CorsConfig{AllowOrigins: []string{"*"}, AllowCredentials: true}
+    if _, err := newCors(&global.MiddlewareConfig{Cors: config}); err == nil {
+        t.Fatal("expected credentials with any origin to be refused")
+    }
+}
+
+func TestCorsRequiresOrigins(t *testing.T) {
+    if _, err := newCors(&global.MiddlewareConfig{}); err == nil {
+        t.Fatal("expected a missing cors config to be refused")
+    }
+    if _, err := newCors(&global.MiddlewareConfig{Cors: &global.CorsConfig{}}); err == nil {
+        t.Fatal("expected an empty origin list to be refused")
+    }
+}
+
+func TestCorsAnyOrigin(t *testing.T) {
+    recorder := corsRequest(t, &global.CorsConfig{AllowOrigins: []string{"*"}}, http.MethodGet, "https://a.test")
+    if value := recorder.Header().Get("Access-Control-Allow-Origin"); value != "*" {
+        t.Fatalf("expected *, got %q", value)
+    }
+    if value := recorder.Header().Get("Access-Control-Allow-Credentials"); value != "" {
+        t.Fatalf("expected no credentials, got %q", value)
+    }
+}
+
+func TestCorsCredentialsForListedOrigin(t *testing.T) {
+    config := &global.CorsConfig{AllowOrigins: []string{"https://app.test", "*.example.com"}, AllowCredentials: true}
+
+    recorder := corsRequest(t, config, http.MethodGet, "https://app.test")
+    if recorder.Header().Get("Access-Control-Allow-Origin") != "https://app.test" || recorder.Header().Get("Access-Control-Allow-Credentials") != "true" {
+        t.Fatalf("listed origin not allowed with credentials: %v", recorder.Header())
+    }
+
+    recorder = corsRequest(t, config, http.MethodGet, "https://api.example.com")
+    if recorder.Header().Get("Access-Control-Allow-Origin") != "https://api.example.com" {
+        t.Fatalf("subdomain not allowed: %v", recorder.Header())
+    }
+
+    recorder = corsRequest(t, config, http.MethodGet, "https://evil.test")
+    if value := recorder.Header().Get("Access-Control-Allow-Origin"); value != "" {
+        t.Fatalf("unlisted origin allowed: %q", value)
+    }
+
+    recorder = corsRequest(t, config, http.MethodOptions, "https://evil.test")
+    if recorder.Code != http.StatusForbidden {
+        t.Fatalf("expected preflight of unlisted origin to be refused, got %d", recorder.Code)
+    }
+}
@@ -0,0 +1,124 @@
+/*
+ * Built-in gin middlewares which can be referenced by name from route and group configuration
+ * without being registered in FuncMap.
+ */
+
+package middleware
+
+import (
+    "errors"
+    "fmt"
+    "github.com/gin-gonic/gin"
+    "github.com/marxn/vasc/global"
+    "github.com/marxn/vasc/logger"
+    "github.com/marxn/vasc/verror"
+    "net/http"
+    "runtime/debug"
+    "strings"
+)
+
+type builder func(config *global.MiddlewareConfig) (gin.HandlerFunc, error)
+
+var builtinMap = map[string]builder {
+    "cors"             : newCors,
+    "compress"         : newCompress,
+    "body_limit"       : newBodyLimit,
+    "real_ip"          : newRealIP,
+    "request_id"       : newRequestID,
+    "recovery"         : newRecovery,
+    "security_headers" : newSecurityHeaders,
+}
+
+// Tell whether name refers to a built-in middleware.
+func Exists(name string) bool {
+    return builtinMap[name] != nil
+}
+
+// Create a built-in middleware. A nil config means all defaults.
+func New(name string, config *global.MiddlewareConfig) (gin.HandlerFunc, error) {
+    build := builtinMap[name]
+    if build == nil {
+        return nil, errors.New("cannot find built-in middleware: " + name)
+    }
+
+    if config == nil {
+        config = &global.MiddlewareConfig{}
+    }
+
+    return build(config)
+}
+
+func newRecovery(config *global.MiddlewareConfig) (gin.HandlerFunc, error) {
+    return func(c *gin.Context) {
+        defer func() {
+            if r := recover(); r != nil {
+                logger.LogSelector("_gin").ErrorLog("tid[%s] Panic:[%v] %s", c.Request.Header.Get("X-Vasc-Request-Tracer"), r, debug.Stack())
+                if c.Writer.Written() {
+                    c.Abort()
+                } else {
+                    verror.Render(c, verror.Internal(fmt.Errorf("panic: %v", r)))
+                }
+            }
+        }()
+        c.Next()
+    }, nil
+}
+
+func newBodyLimit(config *global.MiddlewareConfig) (gin.HandlerFunc, error) {
+    if config.BodyLimit == nil || config.BodyLimit.MaxBytes <= 0 {
+        return nil, errors.New("body_limit requires a positive max_bytes")
+    }
+    maxBytes := config.BodyLimit.MaxBytes
+
+    return func(c *gin.Context) {
+        if c.Request.ContentLength > maxBytes {
+            verror.Render(c, verror.Newf(http.StatusRequestEntityTooLarge, http.StatusRequestEntityTooLarge, "request body exceeds %d bytes", maxBytes))
+            return
+        }
+
+        // Chunked bodies are cut off while being read
+        if c.Request.Body != nil {
+            c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+        }
+        c.Next()
+    }, nil
+}
+
+func newSecurityHeaders(config *global.MiddlewareConfig) (gin.HandlerFunc, error) {
+    headerConfig := config.SecurityHeaders
+    if headerConfig == nil {
+        headerConfig = &global.SecurityHeadersConfig{}
+    }
+
+    headers := map[string]string {
+        "X-Content-Type-Options": "nosniff",
+        "X-Frame-Options"       : "DENY",
+        "Referrer-Policy"       : "strict-origin-when-cross-origin",
+    }
+    if headerConfig.FrameOptions != "" {
+        headers["X-Frame-Options"] = headerConfig.FrameOptions
+    }
+    if headerConfig.ReferrerPolicy != "" {
+        headers["Referrer-Policy"] = headerConfig.ReferrerPolicy
+    }
+    if headerConfig.ContentSecurityPolicy != "" {
+        headers["Content-Security-Policy"] = headerConfig.ContentSecurityPolicy
+    }
+    if headerConfig.HSTSMaxAge > 0 {
+        hsts := fmt.Sprintf("max-age=%d", headerConfig.HSTSMaxAge)
+        if headerConfig.HSTSIncludeSubdomains {
+            hsts += "; includeSubDomains"
+        }
+        headers["Strict-Transport-Security"] = hsts
+    }
+
+    return func(c *gin.Context) {
+        header := c.Writer.Header()
+        for key, value := range headers {
+            if strings.ToLower(value) != "off" {
+                header.Set(key, value)
+            }
+        }
+        c.Next()
+    }, nil
+}
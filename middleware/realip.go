@@ -0,0 +1,107 @@
+package middleware
+
+import (
+    "errors"
+    "github.com/gin-gonic/gin"
+    "github.com/marxn/vasc/global"
+    "net"
+    "strings"
+)
+
+// Key of the resolved client address in gin.Context
+const RealIPKey = "vasc.real_ip"
+
+func newRealIP(config *global.MiddlewareConfig) (gin.HandlerFunc, error) {
+    realIPConfig := config.RealIP
+    if realIPConfig == nil || len(realIPConfig.TrustedProxies) == 0 {
+        return nil, errors.New("real_ip requires trusted_proxies")
+    }
+
+    trusted := make([]*net.IPNet, 0, len(realIPConfig.TrustedProxies))
+    for _, value := range realIPConfig.TrustedProxies {
+        if !strings.Contains(value, "/") {
+            if strings.Contains(value, ":") {
+                value += "/128"
+            } else {
+                value += "/32"
+            }
+        }
+        _, cidr, err := net.ParseCIDR(value)
+        if err != nil {
+            return nil, errors.New("invalid trusted proxy: " + value)
+        }
+        trusted = append(trusted, cidr)
+    }
+
+    headers := realIPConfig.Headers
+    if len(headers) == 0 {
+        headers = []string{"X-Forwarded-For", "X-Real-IP"}
+    }
+
+    isTrusted := func(ip net.IP) bool {
+        for _, cidr := range trusted {
+            if cidr.Contains(ip) {
+                return true
+            }
+        }
+        return false
+    }
+
+    return func(c *gin.Context) {
+        host, _, err := net.SplitHostPort(strings.TrimSpace(c.Request.RemoteAddr))
+        if err != nil {
+            host = c.Request.RemoteAddr
+        }
+
+        clientIP := net.ParseIP(host)
+        if clientIP != nil && isTrusted(clientIP) {
+            for _, headerName := range headers {
+                if ip := resolveForwarded(c.Request.Header.Get(headerName), isTrusted); ip != nil {
+                    clientIP = ip
+                    break
+                }
+            }
+        }
+
+        // Forwarding headers have been consumed, the remote address is the client from now on
+        for _, headerName := range headers {
+            c.Request.Header.Del(headerName)
+        }
+
+        if clientIP != nil {
+            c.Request.RemoteAddr = net.JoinHostPort(clientIP.String(), "0")
+            c.Set(RealIPKey, clientIP.String())
+        }
+        c.Next()
+    }, nil
+}
+
+// Walk the forwarding chain from the nearest hop and stop at the first untrusted address.
+func resolveForwarded(value string, isTrusted func(net.IP) bool) net.IP {
+    if value == "" {
+        return nil
+    }
+
+    var result net.IP
+    items := strings.Split(value, ",")
+    for i := len(items) - 1; i >= 0; i-- {
+        ip := net.ParseIP(strings.TrimSpace(items[i]))
+        if ip == nil {
+            break
+        }
+        result = ip
+        if !isTrusted(ip) {
+            break
+        }
+    }
+    return result
+}
+
+// Client address resolved by the real_ip middleware, or the remote address otherwise:
+// forwarding headers are only trusted from the proxies configured there.
+func RealIP(c *gin.Context) string {
+    if value, exists := c.Get(RealIPKey); exists {
+        return value.(string)
+    }
+    return c.RemoteIP()
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+    "fmt"
+    "github.com/gin-gonic/gin"
+    "github.com/marxn/vasc/global"
+    "hash/fnv"
+    "math/rand"
+    "strconv"
+)
+
+const TracerHeader = "X-Vasc-Request-Tracer"
+
+func newRequestID(config *global.MiddlewareConfig) (gin.HandlerFunc, error) {
+    headerName := "X-Request-Id"
+    if config.RequestID != nil && config.RequestID.Header != "" {
+        headerName = config.RequestID.Header
+    }
+
+    return func(c *gin.Context) {
+        tracer    := c.Request.Header.Get(TracerHeader)
+        requestID := c.Request.Header.Get(headerName)
+
+        if tracer == "" {
+            tracer = tracerFromRequestID(requestID)
+            c.Request.Header.Set(TracerHeader, tracer)
+        }
+        if requestID == "" {
+            requestID = tracer
+            c.Request.Header.Set(headerName, requestID)
+        }
+
+        c.Writer.Header().Set(TracerHeader, tracer)
+        c.Writer.Header().Set(headerName, requestID)
+        c.Next()
+    }, nil
+}
+
+// Map an upstream request ID onto the 64-bit tracer used by vasc loggers.
+func tracerFromRequestID(requestID string) string {
+    if requestID == "" {
+        return fmt.Sprintf("%016x", rand.Uint64())
+    }
+
+    if len(requestID) <= 16 {
+        if value, err := strconv.ParseUint(requestID, 16, 64); err == nil {
+            return fmt.Sprintf("%016x", value)
+        }
+    }
+
+    hash := fnv.New64a()
+    _, _ = hash.Write([]byte(requestID))
+    return fmt.Sprintf("%016x", hash.Sum64())
+}
@@ -0,0 +1,53 @@
+package openapi
+
+import (
+    "bytes"
+    _ "embed"
+    "encoding/json"
+    "github.com/gin-gonic/gin"
+    "github.com/swaggo/files/v2"
+    "html/template"
+    "net/http"
+)
+
+// Path under the docs page serving the Swagger UI built into the binary, unless docs_assets is configured
+const DocsAssetsPath = "/assets"
+
+//go:embed docs.html
+var docsPage string
+
+var docsTemplate = template.Must(template.New("docs").Parse(docsPage))
+
+// Serve the document as JSON. It is encoded once since routes do not change while serving.
+func SpecHandler(document *Document) (gin.HandlerFunc, error) {
+    body, err := json.MarshalIndent(document, "", "  ")
+    if err != nil {
+        return nil, err
+    }
+
+    return func(c *gin.Context) {
+        c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+    }, nil
+}
+
+// Serve the docs UI rendering the document found at specPath, with the Swagger UI files found at assets.
+func DocsHandler(title string, specPath string, assets string) (gin.HandlerFunc, error) {
+    var page bytes.Buffer
+    err := docsTemplate.Execute(&page, map[string]string{"Title": title, "SpecPath": specPath, "Assets": assets})
+    if err != nil {
+        return nil, err
+    }
+    body := page.Bytes()
+
+    return func(c *gin.Context) {
+        c.Data(http.StatusOK, "text/html; charset=utf-8", body)
+    }, nil
+}
+
+// Serve the embedded Swagger UI files, routed as <docs path>/assets/*filepath.
+func AssetsHandler() gin.HandlerFunc {
+    assets := http.FS(swaggerFiles.FS)
+    return func(c *gin.Context) {
+        c.FileFromFS(c.Param("filepath"), assets)
+    }
+}
@@ -0,0 +1,36 @@
+package openapi
+
+import (
+    "github.com/gin-gonic/gin"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestDocsServeEmbeddedAssets(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+
+    docsHandler, err := DocsHandler("demo", "/openapi.json", DefaultDocsPath + DocsAssetsPath)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    engine := gin.New()
+    engine.GET(DefaultDocsPath, docsHandler)
+    engine.GET(DefaultDocsPath + DocsAssetsPath + "/*filepath", AssetsHandler())
+
+    page := httptest.NewRecorder()
+    engine.ServeHTTP(page, httptest.NewRequest(http.MethodGet, DefaultDocsPath, nil))
+    if page.Code != http.StatusOK || !strings.Contains(page.Body.String(), `src="/docs/assets/swagger-ui-bundle.js"`) {
+        t.Fatalf("unexpected docs page %d: %s", page.Code, page.Body.String())
+    }
+
+    for _, name := range []string{"swagger-ui-bundle.js", "swagger-ui.css"} {
+        recorder := httptest.NewRecorder()
+        engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, DefaultDocsPath + DocsAssetsPath + "/" + name, nil))
+        if recorder.Code != http.StatusOK || recorder.Body.Len() == 0 {
+            t.Fatalf("asset %s not served: %d", name, recorder.Code)
+        }
+    }
+}
@@ -0,0 +1,365 @@
+/*
+ * OpenAPI 3 description generated from the webserver route table.
+ * Typed handlers contribute their request and response types, other handlers are described by path only.
+ */
+
+package openapi
+
+import (
+    "fmt"
+    "github.com/marxn/vasc/auth"
+    "github.com/marxn/vasc/global"
+    "github.com/marxn/vasc/portal"
+    "path"
+    "strings"
+)
+
+const Version = "3.0.3"
+
+const DefaultPath     = "/openapi.json"
+const DefaultDocsPath = "/docs"
+
+type Document struct {
+    OpenAPI        string                `json:"openapi"`
+    Info           Info                  `json:"info"`
+    Servers      []Server                `json:"servers,omitempty"`
+    Paths          map[string]PathItem   `json:"paths"`
+    Components    *Components            `json:"components,omitempty"`
+}
+
+type Info struct {
+    Title          string                `json:"title"`
+    Description    string                `json:"description,omitempty"`
+    Version        string                `json:"version"`
+}
+
+type Server struct {
+    URL            string                `json:"url"`
+}
+
+// Operations keyed by lower case method
+type PathItem map[string]*Operation
+
+type Operation struct {
+    OperationID    string                `json:"operationId,omitempty"`
+    Tags         []string                `json:"tags,omitempty"`
+    Parameters   []*Parameter            `json:"parameters,omitempty"`
+    RequestBody   *RequestBody           `json:"requestBody,omitempty"`
+    Responses      map[string]*Response  `json:"responses"`
+    Security     []map[string][]string   `json:"security,omitempty"`
+}
+
+type Parameter struct {
+    Name           string                `json:"name"`
+    In             string                `json:"in"`
+    Required       bool                  `json:"required,omitempty"`
+    Schema        *Schema                `json:"schema,omitempty"`
+}
+
+type RequestBody struct {
+    Required       bool                  `json:"required,omitempty"`
+    Content        map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+    Description    string                `json:"description"`
+    Content        map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+    Schema        *Schema                `json:"schema,omitempty"`
+}
+
+type Components struct {
+    Schemas          map[string]*Schema         `json:"schemas,omitempty"`
+    SecuritySchemes  map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+    Type           string                `json:"type"`
+    Scheme         string                `json:"scheme,omitempty"`
+    BearerFormat   string                `json:"bearerFormat,omitempty"`
+    Name           string                `json:"name,omitempty"`
+    In             string                `json:"in,omitempty"`
+    Description    string                `json:"description,omitempty"`
+}
+
+var anyMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
+
+// Build the document for routes. config may be nil when the webserver section is absent.
+func Generate(config *global.WebServerConfig, routes []global.VascRoute, groups []global.VascRouteGroup, funcMap map[string]interface{}, projectName string) *Document {
+    if config == nil {
+        config = &global.WebServerConfig{}
+    }
+
+    apiConfig := config.OpenAPI
+    if apiConfig == nil {
+        apiConfig = &global.OpenAPIConfig{}
+    }
+
+    document := &Document{
+        OpenAPI: Version,
+        Info:    Info{Title: apiConfig.Title, Description: apiConfig.Description, Version: apiConfig.Version},
+        Paths:   make(map[string]PathItem),
+    }
+    if document.Info.Title == "" {
+        document.Info.Title = projectName
+    }
+    if document.Info.Version == "" {
+        document.Info.Version = "1.0.0"
+    }
+    for _, value := range apiConfig.ServerList {
+        document.Servers = append(document.Servers, Server{URL: value})
+    }
+
+    builder := newSchemaBuilder()
+    builder.components["Error"] = errorSchema(config.ErrorResponse)
+
+    securitySchemes := loadSecuritySchemes(config.Auth)
+    operationIDs    := make(map[string]bool)
+
+    for _, route := range routes {
+        if route.Disable {
+            continue
+        }
+
+        prefix, tag, groupAuth := resolveGroup(groups, route.Group)
+
+        routePath := joinPaths(prefix, route.Route)
+        methods   := []string{route.Method}
+        switch route.Method {
+            case "ANY", "PROXY":
+                methods = anyMethods
+            case "FILE":
+                routePath = joinPaths(routePath, "/*filepath")
+                methods   = []string{"GET", "HEAD"}
+            case "WS", "SSE":
+                methods = []string{"GET"}
+        }
+
+        openapiPath, pathParams := convertPath(routePath)
+
+        var security []string
+        for _, value := range append(groupAuth, routeAuth(route.Auth, route.Middlewares)...) {
+            if securitySchemes[value] != nil {
+                security = append(security, value)
+            }
+        }
+
+        for _, method := range methods {
+            operation := &Operation{Responses: make(map[string]*Response)}
+            if tag != "" {
+                operation.Tags = []string{tag}
+            }
+            if route.HandlerName != "" {
+                operation.OperationID = uniqueID(operationIDs, route.HandlerName, method)
+            }
+
+            typedHandler, typed := portal.ParseTypedHandler(funcMap[route.HandlerName])
+            if route.Method == "WS" {
+                operation.Responses["101"] = &Response{Description: "Switching to websocket"}
+            } else if route.Method == "SSE" {
+                operation.Responses["200"] = &Response{
+                    Description: "Event stream",
+                    Content:     map[string]*MediaType{"text/event-stream": {Schema: &Schema{Type: "string"}}},
+                }
+            } else if typed {
+                builder.describeRequest(operation, typedHandler.RequestType, method)
+                operation.Responses["200"] = &Response{
+                    Description: "OK",
+                    Content:     map[string]*MediaType{"application/json": {Schema: builder.schema(typedHandler.ResponseType)}},
+                }
+                operation.Responses["400"] = errorResponse("Invalid request")
+            } else {
+                operation.Responses["200"] = &Response{Description: "OK"}
+            }
+
+            // Path parameters which are not declared by the request type are plain strings
+            for _, name := range pathParams {
+                if !hasParameter(operation, name, "path") {
+                    operation.Parameters = append(operation.Parameters, &Parameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+                }
+            }
+
+            if len(security) > 0 {
+                requirement := make(map[string][]string)
+                for _, value := range security {
+                    requirement[value] = []string{}
+                }
+                operation.Security = []map[string][]string{requirement}
+                operation.Responses["401"] = errorResponse("Unauthorized")
+            }
+            if route.RateLimit != nil {
+                operation.Responses["429"] = errorResponse("Too many requests")
+            }
+            operation.Responses["default"] = errorResponse("Error")
+
+            if document.Paths[openapiPath] == nil {
+                document.Paths[openapiPath] = make(PathItem)
+            }
+            document.Paths[openapiPath][strings.ToLower(method)] = operation
+        }
+    }
+
+    document.Components = &Components{Schemas: builder.components}
+    if len(securitySchemes) > 0 {
+        document.Components.SecuritySchemes = securitySchemes
+    }
+
+    return document
+}
+
+func errorResponse(description string) *Response {
+    return &Response{
+        Description: description,
+        Content:     map[string]*MediaType{"application/json": {Schema: &Schema{Ref: "#/components/schemas/Error"}}},
+    }
+}
+
+func loadSecuritySchemes(config *global.AuthConfig) map[string]*SecurityScheme {
+    result := make(map[string]*SecurityScheme)
+    if config == nil {
+        return result
+    }
+
+    for _, provider := range config.ProviderList {
+        switch provider.Type {
+            case auth.AuthTypeJWT:
+                if provider.Header == "" || strings.EqualFold(provider.Header, "Authorization") {
+                    result[provider.Name] = &SecurityScheme{Type: "http", Scheme: "bearer", BearerFormat: "JWT"}
+                } else {
+                    result[provider.Name] = &SecurityScheme{Type: "apiKey", In: "header", Name: provider.Header}
+                }
+            case auth.AuthTypeAPIKey:
+                if provider.Header == "" && provider.Query != "" {
+                    result[provider.Name] = &SecurityScheme{Type: "apiKey", In: "query", Name: provider.Query}
+                } else if provider.Header == "" {
+                    result[provider.Name] = &SecurityScheme{Type: "apiKey", In: "header", Name: "X-Api-Key"}
+                } else {
+                    result[provider.Name] = &SecurityScheme{Type: "apiKey", In: "header", Name: provider.Header}
+                }
+            case auth.AuthTypeHMAC:
+                result[provider.Name] = &SecurityScheme{
+                    Type:        "apiKey",
+                    In:          "header",
+                    Name:        auth.HMACSignatureHeader,
+                    Description: "Also requires " + auth.HMACKeyIDHeader + ", " + auth.HMACTimestampHeader + " and " + auth.HMACNonceHeader + " headers",
+                }
+        }
+    }
+
+    return result
+}
+
+// Auth providers referenced by a route, either directly or as "auth:<name>" middlewares.
+func routeAuth(provider string, middlewares []string) []string {
+    result := make([]string, 0)
+    if provider != "" {
+        result = append(result, provider)
+    }
+    for _, value := range middlewares {
+        if strings.HasPrefix(value, "auth:") {
+            result = append(result, value[len("auth:"):])
+        }
+    }
+    return result
+}
+
+// Walk the group chain from the root, returning the path prefix, the tag and the auth providers on the way.
+func resolveGroup(groups []global.VascRouteGroup, name string) (string, string, []string) {
+    if name == "" {
+        return "", "", nil
+    }
+
+    chain   := make([]*global.VascRouteGroup, 0)
+    visited := make(map[string]bool)
+    prefix  := ""
+
+    for current := name; current != "" && !visited[current]; {
+        visited[current] = true
+
+        groupInfo := findGroup(groups, current)
+        if groupInfo == nil {
+            // An undeclared group is a bare path prefix
+            prefix = current
+            break
+        }
+        chain   = append(chain, groupInfo)
+        current = groupInfo.Parent
+    }
+
+    var security []string
+    for index := len(chain) - 1; index >= 0; index-- {
+        prefix   = joinPaths(prefix, chain[index].Group)
+        security = append(security, routeAuth(chain[index].Auth, chain[index].Middlewares)...)
+    }
+
+    return prefix, name, security
+}
+
+// Same lookup as the webserver: by name first, then by path.
+func findGroup(groups []global.VascRouteGroup, name string) *global.VascRouteGroup {
+    for index := range groups {
+        if groups[index].Name != "" && groups[index].Name == name {
+            return &groups[index]
+        }
+    }
+    for index := range groups {
+        if groups[index].Group == name {
+            return &groups[index]
+        }
+    }
+    return nil
+}
+
+// Join path segments the way gin does, keeping the trailing slash of the last one.
+func joinPaths(absolutePath string, relativePath string) string {
+    if relativePath == "" {
+        return absolutePath
+    }
+
+    result := path.Join(absolutePath, relativePath)
+    if strings.HasSuffix(relativePath, "/") && !strings.HasSuffix(result, "/") {
+        result += "/"
+    }
+    if !strings.HasPrefix(result, "/") {
+        result = "/" + result
+    }
+    return result
+}
+
+// Turn gin parameters ":id" and "*path" into OpenAPI "{id}" and "{path}".
+func convertPath(ginPath string) (string, []string) {
+    segments := strings.Split(ginPath, "/")
+    params   := make([]string, 0)
+
+    for index, value := range segments {
+        if strings.HasPrefix(value, ":") || strings.HasPrefix(value, "*") {
+            params = append(params, value[1:])
+            segments[index] = "{" + value[1:] + "}"
+        }
+    }
+
+    return strings.Join(segments, "/"), params
+}
+
+func hasParameter(operation *Operation, name string, in string) bool {
+    for _, value := range operation.Parameters {
+        if value.Name == name && value.In == in {
+            return true
+        }
+    }
+    return false
+}
+
+func uniqueID(operationIDs map[string]bool, handlerName string, method string) string {
+    result := handlerName
+    if operationIDs[result] {
+        result = handlerName + method[:1] + strings.ToLower(method[1:])
+    }
+    for index := 2; operationIDs[result]; index++ {
+        result = fmt.Sprintf("%s%s%d", handlerName, method[:1] + strings.ToLower(method[1:]), index)
+    }
+    operationIDs[result] = true
+    return result
+}
@@ -0,0 +1,299 @@
+package openapi
+
+import (
+    "github.com/marxn/vasc/global"
+    "github.com/marxn/vasc/verror"
+    "reflect"
+    "strconv"
+    "strings"
+    "time"
+)
+
+type Schema struct {
+    Ref                   string             `json:"$ref,omitempty"`
+    Type                  string             `json:"type,omitempty"`
+    Format                string             `json:"format,omitempty"`
+    Items                *Schema             `json:"items,omitempty"`
+    Properties            map[string]*Schema `json:"properties,omitempty"`
+    AdditionalProperties *Schema             `json:"additionalProperties,omitempty"`
+    Required            []string             `json:"required,omitempty"`
+    Enum                []interface{}        `json:"enum,omitempty"`
+    Minimum              *float64            `json:"minimum,omitempty"`
+    Maximum              *float64            `json:"maximum,omitempty"`
+    ExclusiveMinimum      bool               `json:"exclusiveMinimum,omitempty"`
+    ExclusiveMaximum      bool               `json:"exclusiveMaximum,omitempty"`
+    MinLength            *int64              `json:"minLength,omitempty"`
+    MaxLength            *int64              `json:"maxLength,omitempty"`
+    MinItems             *int64              `json:"minItems,omitempty"`
+    MaxItems             *int64              `json:"maxItems,omitempty"`
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+type schemaBuilder struct {
+    components   map[string]*Schema
+    names        map[reflect.Type]string
+}
+
+func newSchemaBuilder() *schemaBuilder {
+    return &schemaBuilder{
+        components: make(map[string]*Schema),
+        names:      make(map[reflect.Type]string),
+    }
+}
+
+// Error responses follow the shape configured for verror.
+func errorSchema(config *global.ErrorResponseConfig) *Schema {
+    shape := verror.Shape(config)
+
+    result := &Schema{
+        Type: "object",
+        Properties: map[string]*Schema{
+            shape.CodeField:    {Type: "integer"},
+            shape.MessageField: {Type: "string"},
+            shape.DetailsField: {},
+        },
+        Required: []string{shape.CodeField, shape.MessageField},
+    }
+    if shape.TraceField != "" {
+        result.Properties[shape.TraceField] = &Schema{Type: "string"}
+    }
+
+    if shape.Envelope != "" {
+        return &Schema{Type: "object", Properties: map[string]*Schema{shape.Envelope: result}, Required: []string{shape.Envelope}}
+    }
+    return result
+}
+
+// Split the request type into path, query and header parameters and a JSON body, following BindRequest.
+func (this *schemaBuilder) describeRequest(operation *Operation, requestType reflect.Type, method string) {
+    body := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+
+    for _, field := range structFields(requestType) {
+        schema   := this.schema(field.Type)
+        required := applyRules(schema, field.Type, field.Tag.Get("binding"))
+
+        if name, ok := tagName(field, "uri"); ok {
+            operation.Parameters = append(operation.Parameters, &Parameter{Name: name, In: "path", Required: true, Schema: schema})
+        } else if name, ok := tagName(field, "form"); ok {
+            operation.Parameters = append(operation.Parameters, &Parameter{Name: name, In: "query", Required: required, Schema: schema})
+        } else if name, ok := tagName(field, "header"); ok {
+            operation.Parameters = append(operation.Parameters, &Parameter{Name: name, In: "header", Required: required, Schema: schema})
+        } else if name, ok := jsonName(field); ok {
+            body.Properties[name] = schema
+            if required {
+                body.Required = append(body.Required, name)
+            }
+        }
+    }
+
+    if len(body.Properties) == 0 || method == "GET" || method == "HEAD" {
+        return
+    }
+
+    operation.RequestBody = &RequestBody{
+        Required: len(body.Required) > 0,
+        Content:  map[string]*MediaType{"application/json": {Schema: body}},
+    }
+}
+
+// Schema of t. Named structs are put into components and referenced.
+func (this *schemaBuilder) schema(t reflect.Type) *Schema {
+    for t.Kind() == reflect.Ptr {
+        t = t.Elem()
+    }
+
+    if t == timeType {
+        return &Schema{Type: "string", Format: "date-time"}
+    }
+
+    switch t.Kind() {
+        case reflect.Bool:
+            return &Schema{Type: "boolean"}
+        case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+            return &Schema{Type: "integer", Format: "int32"}
+        case reflect.Int64, reflect.Uint64:
+            return &Schema{Type: "integer", Format: "int64"}
+        case reflect.Float32:
+            return &Schema{Type: "number", Format: "float"}
+        case reflect.Float64:
+            return &Schema{Type: "number", Format: "double"}
+        case reflect.String:
+            return &Schema{Type: "string"}
+        case reflect.Slice, reflect.Array:
+            if t.Elem().Kind() == reflect.Uint8 {
+                return &Schema{Type: "string", Format: "byte"}
+            }
+            return &Schema{Type: "array", Items: this.schema(t.Elem())}
+        case reflect.Map:
+            return &Schema{Type: "object", AdditionalProperties: this.schema(t.Elem())}
+        case reflect.Struct:
+            if t.Name() == "" {
+                return this.structSchema(t)
+            }
+            return &Schema{Ref: "#/components/schemas/" + this.register(t)}
+        default:
+            // interface{} and anything else accepts any value
+            return &Schema{}
+    }
+}
+
+func (this *schemaBuilder) register(t reflect.Type) string {
+    if name, ok := this.names[t]; ok {
+        return name
+    }
+
+    name := t.Name()
+    if this.components[name] != nil {
+        // Same name from another package
+        pkgPath := t.PkgPath()
+        name = pkgPath[strings.LastIndex(pkgPath, "/") + 1:] + "." + name
+    }
+
+    // Register before building so that recursive types end in a reference
+    this.names[t]          = name
+    this.components[name]  = &Schema{}
+    *this.components[name] = *this.structSchema(t)
+
+    return name
+}
+
+func (this *schemaBuilder) structSchema(t reflect.Type) *Schema {
+    result := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+
+    for _, field := range structFields(t) {
+        name, ok := jsonName(field)
+        if !ok {
+            continue
+        }
+
+        schema := this.schema(field.Type)
+        if applyRules(schema, field.Type, field.Tag.Get("binding")) {
+            result.Required = append(result.Required, name)
+        }
+        result.Properties[name] = schema
+    }
+
+    return result
+}
+
+// Exported fields of t, with untagged embedded structs flattened as encoding/json does.
+func structFields(t reflect.Type) []reflect.StructField {
+    result := make([]reflect.StructField, 0)
+
+    for index := 0; index < t.NumField(); index++ {
+        field := t.Field(index)
+        if field.Anonymous && field.Tag.Get("json") == "" {
+            fieldType := field.Type
+            if fieldType.Kind() == reflect.Ptr {
+                fieldType = fieldType.Elem()
+            }
+            if fieldType.Kind() == reflect.Struct {
+                result = append(result, structFields(fieldType)...)
+                continue
+            }
+        }
+
+        if field.PkgPath == "" {
+            result = append(result, field)
+        }
+    }
+
+    return result
+}
+
+func tagName(field reflect.StructField, key string) (string, bool) {
+    tag := field.Tag.Get(key)
+    if tag == "" || tag == "-" {
+        return "", false
+    }
+    return strings.Split(tag, ",")[0], true
+}
+
+func jsonName(field reflect.StructField) (string, bool) {
+    tag := field.Tag.Get("json")
+    if tag == "-" {
+        return "", false
+    }
+
+    name := strings.Split(tag, ",")[0]
+    if name == "" {
+        name = field.Name
+    }
+    return name, true
+}
+
+// Translate validator rules into schema constraints, returns whether the field is required.
+func applyRules(schema *Schema, t reflect.Type, rules string) bool {
+    required := false
+
+    for t.Kind() == reflect.Ptr {
+        t = t.Elem()
+    }
+    numeric := schema.Type == "integer" || schema.Type == "number"
+    list    := t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map
+
+    for _, rule := range strings.Split(rules, ",") {
+        name, param := rule, ""
+        if index := strings.Index(rule, "="); index >= 0 {
+            name, param = rule[:index], rule[index + 1:]
+        }
+
+        switch name {
+            case "required":
+                required = true
+            case "oneof":
+                for _, value := range strings.Fields(param) {
+                    schema.Enum = append(schema.Enum, enumValue(schema, value))
+                }
+            case "min", "gte", "gt":
+                value, err := strconv.ParseFloat(param, 64)
+                if err != nil {
+                    continue
+                }
+                if numeric {
+                    schema.Minimum          = &value
+                    schema.ExclusiveMinimum = name == "gt"
+                } else if name != "gt" {
+                    length := int64(value)
+                    if list {
+                        schema.MinItems = &length
+                    } else if schema.Type == "string" {
+                        schema.MinLength = &length
+                    }
+                }
+            case "max", "lte", "lt":
+                value, err := strconv.ParseFloat(param, 64)
+                if err != nil {
+                    continue
+                }
+                if numeric {
+                    schema.Maximum          = &value
+                    schema.ExclusiveMaximum = name == "lt"
+                } else if name != "lt" {
+                    length := int64(value)
+                    if list {
+                        schema.MaxItems = &length
+                    } else if schema.Type == "string" {
+                        schema.MaxLength = &length
+                    }
+                }
+        }
+    }
+
+    return required
+}
+
+func enumValue(schema *Schema, value string) interface{} {
+    switch schema.Type {
+        case "integer":
+            if result, err := strconv.ParseInt(value, 10, 64); err == nil {
+                return result
+            }
+        case "number":
+            if result, err := strconv.ParseFloat(value, 64); err == nil {
+                return result
+            }
+    }
+    return value
+}
@@ -0,0 +1,102 @@
+package portal
+
+import (
+    "github.com/gin-gonic/gin"
+    "sync"
+)
+
+// Key of the attribute bag in gin.Context
+const AttributesKey = "vasc.attributes"
+
+// Typed key of a portal attribute. Keys are told apart by identity rather than by name,
+// so declare each one once, e.g. var UserKey = portal.NewKey[*User]("user").
+type Key[T any] struct {
+    name          string
+}
+
+func NewKey[T any](name string) *Key[T] {
+    return &Key[T]{name: name}
+}
+
+func (this *Key[T]) String() string {
+    return this.name
+}
+
+// Values shared by everything handling the same request, task or schedule run.
+// An HTTP request keeps its bag in gin.Context so that its middlewares and handler see the same one.
+type Attributes struct {
+    mutex         sync.RWMutex
+    values        map[interface{}]interface{}
+}
+
+func (this *Attributes) load(key interface{}) (interface{}, bool) {
+    this.mutex.RLock()
+    defer this.mutex.RUnlock()
+    value, exists := this.values[key]
+    return value, exists
+}
+
+func (this *Attributes) store(key interface{}, value interface{}) {
+    this.mutex.Lock()
+    defer this.mutex.Unlock()
+    if this.values == nil {
+        this.values = make(map[interface{}]interface{})
+    }
+    this.values[key] = value
+}
+
+func (this *Attributes) remove(key interface{}) {
+    this.mutex.Lock()
+    defer this.mutex.Unlock()
+    delete(this.values, key)
+}
+
+// Return the bag of the request, creating it on first use.
+func attributesOf(c *gin.Context) *Attributes {
+    if value, exists := c.Get(AttributesKey); exists {
+        return value.(*Attributes)
+    }
+    result := new(Attributes)
+    c.Set(AttributesKey, result)
+    return result
+}
+
+func (ctx *Portal) attributeBag() *Attributes {
+    ctx.LoggerMapMutex.Lock()
+    defer ctx.LoggerMapMutex.Unlock()
+    if ctx.attributes == nil {
+        ctx.attributes = new(Attributes)
+    }
+    return ctx.attributes
+}
+
+func Set[T any](p *Portal, key *Key[T], value T) {
+    p.attributeBag().store(key, value)
+}
+
+// Return the value of key, or the zero value and false when it has not been set.
+func Get[T any](p *Portal, key *Key[T]) (T, bool) {
+    return lookup(p.attributeBag(), key)
+}
+
+func Delete[T any](p *Portal, key *Key[T]) {
+    p.attributeBag().remove(key)
+}
+
+// Set an attribute from a plain gin middleware which has no portal.
+func SetGin[T any](c *gin.Context, key *Key[T], value T) {
+    attributesOf(c).store(key, value)
+}
+
+func GetGin[T any](c *gin.Context, key *Key[T]) (T, bool) {
+    return lookup(attributesOf(c), key)
+}
+
+func lookup[T any](bag *Attributes, key *Key[T]) (T, bool) {
+    value, exists := bag.load(key)
+    if !exists {
+        var zero T
+        return zero, false
+    }
+    return value.(T), true
+}
@@ -0,0 +1,158 @@
+package portal
+
+import (
+    "encoding"
+    "fmt"
+    "reflect"
+    "strconv"
+    "strings"
+    "time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Set the fields of obj carrying tag from the values found by lookup. Unlike the form mapping of gin,
+// a field without the tag is never bound, so a header or query parameter named after it is ignored.
+// Tags may carry a default, e.g. `form:"page,default=1"`, which only fills a field still holding its zero value.
+func bindTagged(obj interface{}, tag string, lookup func(name string) ([]string, bool)) error {
+    value := reflect.ValueOf(obj)
+    if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+        return fmt.Errorf("cannot bind %T", obj)
+    }
+    return bindStruct(value.Elem(), tag, lookup)
+}
+
+func bindStruct(value reflect.Value, tag string, lookup func(name string) ([]string, bool)) error {
+    valueType := value.Type()
+    for i := 0; i < valueType.NumField(); i++ {
+        field := valueType.Field(i)
+        // An unexported embedded struct still promotes its exported fields
+        if !field.IsExported() && !(field.Anonymous && field.Type.Kind() == reflect.Struct) {
+            continue
+        }
+
+        name, options, _ := strings.Cut(field.Tag.Get(tag), ",")
+        if name == "-" {
+            continue
+        }
+
+        // Embedded structs hold tagged fields of their own
+        if name == "" {
+            if field.Anonymous {
+                if err := bindEmbedded(value.Field(i), tag, lookup); err != nil {
+                    return err
+                }
+            }
+            continue
+        }
+
+        items, exists := lookup(name)
+        if !exists || len(items) == 0 {
+            fallback, ok := strings.CutPrefix(options, "default=")
+            if !ok || !value.Field(i).IsZero() {
+                continue
+            }
+            items = []string{fallback}
+        }
+
+        if err := setField(value.Field(i), items); err != nil {
+            return fmt.Errorf("%s: %v", name, err)
+        }
+    }
+    return nil
+}
+
+func bindEmbedded(value reflect.Value, tag string, lookup func(name string) ([]string, bool)) error {
+    switch {
+        case value.Kind() == reflect.Struct:
+            return bindStruct(value, tag, lookup)
+        case value.Kind() == reflect.Ptr && value.Type().Elem().Kind() == reflect.Struct:
+            if value.IsNil() {
+                value.Set(reflect.New(value.Type().Elem()))
+            }
+            return bindStruct(value.Elem(), tag, lookup)
+        default:
+            return nil
+    }
+}
+
+func setField(value reflect.Value, items []string) error {
+    if value.Kind() == reflect.Slice && !implementsText(value) {
+        result := reflect.MakeSlice(value.Type(), len(items), len(items))
+        for index, item := range items {
+            if err := setValue(result.Index(index), item); err != nil {
+                return err
+            }
+        }
+        value.Set(result)
+        return nil
+    }
+    return setValue(value, items[0])
+}
+
+func implementsText(value reflect.Value) bool {
+    return reflect.PointerTo(value.Type()).Implements(reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem())
+}
+
+func setValue(value reflect.Value, text string) error {
+    if value.Kind() == reflect.Ptr {
+        if value.IsNil() {
+            value.Set(reflect.New(value.Type().Elem()))
+        }
+        return setValue(value.Elem(), text)
+    }
+
+    if unmarshaler, ok := value.Addr().Interface().(encoding.TextUnmarshaler); ok {
+        return unmarshaler.UnmarshalText([]byte(text))
+    }
+
+    if value.Type() == durationType {
+        if text == "" {
+            text = "0"
+        }
+        result, err := time.ParseDuration(text)
+        if err != nil {
+            return err
+        }
+        value.SetInt(int64(result))
+        return nil
+    }
+
+    // An empty number or flag is its zero value, as with gin
+    if text == "" && value.Kind() != reflect.String {
+        value.Set(reflect.Zero(value.Type()))
+        return nil
+    }
+
+    switch value.Kind() {
+        case reflect.String:
+            value.SetString(text)
+        case reflect.Bool:
+            result, err := strconv.ParseBool(text)
+            if err != nil {
+                return err
+            }
+            value.SetBool(result)
+        case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+            result, err := strconv.ParseInt(text, 10, value.Type().Bits())
+            if err != nil {
+                return err
+            }
+            value.SetInt(result)
+        case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+            result, err := strconv.ParseUint(text, 10, value.Type().Bits())
+            if err != nil {
+                return err
+            }
+            value.SetUint(result)
+        case reflect.Float32, reflect.Float64:
+            result, err := strconv.ParseFloat(text, value.Type().Bits())
+            if err != nil {
+                return err
+            }
+            value.SetFloat(result)
+        default:
+            return fmt.Errorf("unsupported type %s", value.Type())
+    }
+    return nil
+}
@@ -0,0 +1,11 @@
+package portal
+
+import (
+    "github.com/marxn/vasc/responsecache"
+)
+
+// Drop the cached responses of the routes whose cache is named name,
+// or only those of the given request paths, e.g. p.InvalidateCache("/items/:id", "/items/42").
+func (ctx *Portal) InvalidateCache(name string, paths ...string) error {
+    return responsecache.Invalidate(name, paths...)
+}
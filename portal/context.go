@@ -6,10 +6,14 @@ import (
     "fmt"
     "github.com/gin-gonic/gin"
     "github.com/marxn/vasc/logger"
+    "github.com/marxn/vasc/tracing"
+    "github.com/marxn/vasc/verror"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/trace"
+    "io"
     "math/rand"
     "net/http"
     "strconv"
-    "strings"
     "sync"
     "time"
 )
@@ -24,30 +28,44 @@ type Portal struct {
     LogSelector     string
     LoggerMap       map[string]*logger.VascLogger
     LoggerMapMutex  sync.Mutex
+    closers       []io.Closer
+    transactions    map[string]*transaction
+    attributes     *Attributes
+    group          *goGroup
 }
 
 type TaskContent struct {
-    ProjectName       string      `json:"project_name"`
-    CreateTime        int64       `json:"create_time"`
-    Content         []byte        `json:"content"`
+    ProjectName       string             `json:"project_name"`
+    CreateTime        int64              `json:"create_time"`
+    Content         []byte               `json:"content"`
+    TraceContext      map[string]string  `json:"trace_context,omitempty"`
+    Tenant            string             `json:"tenant,omitempty"`
+}
+
+type portalKey struct{}
+
+// Attach p to parent for handlers which only get a context.Context, such as gRPC methods.
+func NewContext(parent context.Context, p *Portal) context.Context {
+    return context.WithValue(parent, portalKey{}, p)
+}
+
+// Return the portal attached by NewContext, or nil.
+func FromContext(ctx context.Context) *Portal {
+    result, _ := ctx.Value(portalKey{}).(*Portal)
+    return result
 }
 
 func MakeGinRouteWithContext(projectName string, handlerName string, payload func(*Portal), timeout int) func(c *gin.Context) {
     // return a wrapper for handling http request
     return func(c *gin.Context) {
-        // Return directly if the upper group handler has broke.
-        needBreak := c.Request.Header.Get("X-Vasc-Request-Needbreak")
-        if strings.ToLower(needBreak) == "true" {
-            return
-        }
-
         var ctx context.Context
         var cancelFunc context.CancelFunc
 
+        // Work of the handler is cancelled when the client goes away
         if timeout > 0 {
-            ctx, cancelFunc = context.WithTimeout(context.Background(), time.Second * time.Duration(timeout))
+            ctx, cancelFunc = context.WithTimeout(c.Request.Context(), time.Second * time.Duration(timeout))
         } else {
-            ctx, cancelFunc = context.WithCancel(context.Background())
+            ctx, cancelFunc = context.WithCancel(c.Request.Context())
         }
 
         vContext := NewVascContext(projectName)
@@ -55,15 +73,7 @@ func MakeGinRouteWithContext(projectName string, handlerName string, payload fun
         vContext.Context      = ctx
         vContext.LogSelector  = "request"
         vContext.containerCtx = c
-
-        defer func () {
-            if r := recover(); r != nil {
-                c.AbortWithStatus(http.StatusInternalServerError)
-                vContext.Logger("_gin").ErrorLog("Panic:[%v]", r)
-            }
-            cancelFunc()
-            vContext.Close()
-        }()
+        vContext.attributes   = attributesOf(c)
 
         tracer := c.Request.Header.Get("X-Vasc-Request-Tracer")
         if tracer != "" {
@@ -71,9 +81,45 @@ func MakeGinRouteWithContext(projectName string, handlerName string, payload fun
             vContext.SetTID(txID)
         } else {
             // Save TxID in order to use customized logger
-            c.Request.Header.Set("X-Vasc-Request-Tracer", fmt.Sprintf("%016x", vContext.TxID))
+            tracer = fmt.Sprintf("%016x", vContext.TxID)
+            c.Request.Header.Set("X-Vasc-Request-Tracer", tracer)
         }
 
+        // Answer 504 when the route times out before the handler has responded
+        var writer *timeoutWriter
+        var stopTimer func() bool
+        if timeout > 0 {
+            writer    = newTimeoutWriter(c.Writer, tracer)
+            c.Writer  = writer
+            stopTimer = context.AfterFunc(ctx, func() {
+                if ctx.Err() == context.DeadlineExceeded {
+                    writer.timeout()
+                }
+            })
+        }
+
+        defer func () {
+            r := recover()
+            if writer != nil {
+                stopTimer()
+                c.Writer = writer.ResponseWriter
+                if writer.finish() {
+                    vContext.Logger("_gin").ErrorLog("%s: timeout after %d seconds", handlerName, timeout)
+                    c.Abort()
+                }
+            }
+            if r != nil {
+                vContext.Logger("_gin").ErrorLog("Panic:[%v]", r)
+                if c.Writer.Written() {
+                    c.Abort()
+                } else {
+                    verror.Render(c, verror.Internal(fmt.Errorf("panic: %v", r)))
+                }
+            }
+            cancelFunc()
+            vContext.Close()
+        }()
+
         // Do handling
         payload(vContext)
     }
@@ -82,19 +128,27 @@ func MakeGinRouteWithContext(projectName string, handlerName string, payload fun
 func MakeSchedulePortalWithContext(projectName string, enableLogger bool, scheduleKey string, payload func(*Portal) error, parent context.Context) func() error {
     // return a wrapper for handling schedule
     return func() error {
-        ctx, cancelFunc := context.WithCancel(parent)
+        // Every run is a trace of its own
+        ctx, span := tracing.Tracer().Start(parent, "schedule " + scheduleKey, trace.WithNewRoot(),
+            trace.WithAttributes(attribute.String("vasc.schedule", scheduleKey)))
+        ctx, cancelFunc := context.WithCancel(ctx)
 
         vContext := NewVascContext(projectName)
         vContext.HandlerName  = scheduleKey
         vContext.Context      = ctx
         vContext.LogSelector  = "schedule"
         vContext.containerCtx = nil
+        if txID, ok := tracing.TxID(ctx); ok {
+            vContext.SetTID(txID)
+        }
 
         defer func () {
             if r := recover(); r != nil {
                 vContext.Logger("_schedule").ErrorLog("%s: Panic:[%v]", scheduleKey, r)
+                tracing.RecordError(span, fmt.Errorf("panic: %v", r))
             }
             cancelFunc()
+            span.End()
             vContext.Close()
         }()
 
@@ -102,6 +156,7 @@ func MakeSchedulePortalWithContext(projectName string, enableLogger bool, schedu
 
         // Call scheduled func
         err := payload(vContext)
+        tracing.RecordError(span, err)
 
         endTime := time.Now().UnixNano()
         if enableLogger {
@@ -119,19 +174,30 @@ func MakeSchedulePortalWithContext(projectName string, enableLogger bool, schedu
 func MakeTaskHandlerWithContext(projectName string, enableLogger bool, taskKey string, payload func(*Portal) error, content *TaskContent, parent context.Context) func() error {
     // return a wrapper for handling underlying task
     return func() error {
-        ctx, cancelFunc := context.WithCancel(parent)
+        // The task continues the trace of whoever pushed it
+        ctx, span := tracing.Tracer().Start(tracing.Extract(parent, content.TraceContext), "task " + taskKey,
+            trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(attribute.String("vasc.task", taskKey)))
+        ctx, cancelFunc := context.WithCancel(ctx)
         
         vContext := NewVascContext(projectName)
         vContext.HandlerName  = taskKey
         vContext.Context      = ctx
         vContext.LogSelector  = "task"
         vContext.containerCtx = content
+        if txID, ok := tracing.TxID(ctx); ok {
+            vContext.SetTID(txID)
+        }
+        if content.Tenant != "" {
+            Set(vContext, TenantAttribute, content.Tenant)
+        }
         
         defer func () {
             if r := recover(); r != nil {
                 vContext.Logger("_task").ErrorLog("%s: Panic:[%v]", taskKey, r)
+                tracing.RecordError(span, fmt.Errorf("panic: %v", r))
             }
             cancelFunc()
+            span.End()
             vContext.Close()
         }()
         
@@ -139,6 +205,7 @@ func MakeTaskHandlerWithContext(projectName string, enableLogger bool, taskKey s
         
         // Entrance of task
         err := payload(vContext)
+        tracing.RecordError(span, err)
         
         endTime := time.Now().UnixNano()
         if enableLogger {
@@ -169,12 +236,20 @@ func (ctx *Portal) SetTID(txID uint64) {
     ctx.TxID = txID
 }
 
+// Stop the remaining handlers of the chain. Kept for compatibility, use Abort instead.
 func (ctx *Portal) NeedBreak(need bool) {
-    value := "false"
     if need {
-        value = "true"
+        ctx.Abort()
     }
-    ctx.HttpContext().Request.Header.Set("X-Vasc-Request-Needbreak", value)
+}
+
+// Prevent pending middlewares and the route handler from being called.
+func (ctx *Portal) Abort() {
+    ctx.HttpContext().Abort()
+}
+
+func (ctx *Portal) IsAborted() bool {
+    return ctx.HttpContext().IsAborted()
 }
 
 func (ctx *Portal) SetDefaultLogger(LogSelector string) {
@@ -197,12 +272,19 @@ func (ctx *Portal) Close() {
     ctx.LoggerMapMutex.Lock()
 	defer ctx.LoggerMapMutex.Unlock()
 	
+	for _, value := range ctx.closers {
+	    _ = value.Close()
+	}
+	ctx.closers = nil
+	
 	for _, value := range ctx.LoggerMap {
 	    value.Close()
 	}
 }
 
 func (ctx *Portal) Logger(subsystem string) *logger.VascLogger {
+    tenant := ctx.Tenant()
+    
     ctx.LoggerMapMutex.Lock()
 	defer ctx.LoggerMapMutex.Unlock()
 	
@@ -212,12 +294,14 @@ func (ctx *Portal) Logger(subsystem string) *logger.VascLogger {
         ctx.LoggerMap[subsystem] = result
     }
     
-    result.TxID = ctx.TxID
+    result.TxID   = ctx.TxID
+    result.Tenant = tenant
     return result
 }
 
 func (ctx *Portal) DefaultLogger() *logger.VascLogger {
     subsystem := ctx.LogSelector
+    tenant    := ctx.Tenant()
     
     ctx.LoggerMapMutex.Lock()
 	defer ctx.LoggerMapMutex.Unlock()
@@ -228,7 +312,8 @@ func (ctx *Portal) DefaultLogger() *logger.VascLogger {
         ctx.LoggerMap[subsystem] = result
     }
     
-    result.TxID = ctx.TxID
+    result.TxID   = ctx.TxID
+    result.Tenant = tenant
     return result
 }
 
@@ -252,24 +337,40 @@ func (ctx *Portal) Exit() {
     panic("VASC_HANDLER_EXIT")
 }
 
+// Log err and render it in the unified error shape. Causes are logged but never sent to the client.
+func (ctx *Portal) Error(err error) {
+    vascError := verror.From(err)
+    if vascError == nil {
+        return
+    }
+    
+    if vascError.Status >= http.StatusInternalServerError {
+        ctx.DefaultErrorLog("%v", vascError)
+    } else {
+        ctx.DefaultInfoLog("%v", vascError)
+    }
+    verror.Render(ctx.HttpContext(), vascError)
+}
+
+// The JSON helpers respond in the configured error shape, which defaults to {"code", "message"}.
 func (ctx *Portal) ErrorLogAndReturnJSON(code int, format string, v ...interface{}) {
     ctx.DefaultErrorLog(format, v...)
-    ctx.HttpContext().JSON(code, gin.H{"code": code, "message": fmt.Sprintf(format, v...)})
+    verror.Render(ctx.HttpContext(), verror.Newf(code, code, format, v...))
 }
 
 func (ctx *Portal) InfoLogAndReturnJSON(code int, format string, v ...interface{}) {
     ctx.DefaultInfoLog(format, v...)
-    ctx.HttpContext().JSON(code, gin.H{"code": code, "message": fmt.Sprintf(format, v...)})
+    verror.Render(ctx.HttpContext(), verror.Newf(code, code, format, v...))
 }
 
 func (ctx *Portal) WarnLogAndReturnJSON(code int, format string, v ...interface{}) {
     ctx.DefaultWarnLog(format, v...)
-    ctx.HttpContext().JSON(code, gin.H{"code": code, "message": fmt.Sprintf(format, v...)})
+    verror.Render(ctx.HttpContext(), verror.Newf(code, code, format, v...))
 }
 
 func (ctx *Portal) DebugLogAndReturnJSON(code int, format string, v ...interface{}) {
     ctx.DefaultDebugLog(format, v...)
-    ctx.HttpContext().JSON(code, gin.H{"code": code, "message": fmt.Sprintf(format, v...)})
+    verror.Render(ctx.HttpContext(), verror.Newf(code, code, format, v...))
 }
 
 func (ctx *Portal) ErrorLogAndReturnString(code int, format string, v ...interface{}) {
@@ -0,0 +1,110 @@
+package portal
+
+import (
+    "context"
+    "fmt"
+    "github.com/gin-gonic/gin"
+    "github.com/marxn/vasc/tracing"
+    "go.opentelemetry.io/otel/trace"
+    "runtime/debug"
+    "sync"
+)
+
+// Goroutines started by Go since the last Wait. The first failure cancels the others.
+type goGroup struct {
+    waitGroup     sync.WaitGroup
+    ctx           context.Context
+    cancel        context.CancelFunc
+    once          sync.Once
+    err           error
+}
+
+// Run fn in a goroutine with a portal of its own which carries the TxID, logger, trace and
+// attributes of ctx. Its context is cancelled when ctx ends, and when another goroutine of the group fails.
+// A panic is logged and turned into an error. Use Wait to join the goroutines.
+// A goroutine which is not joined keeps running after the handler has returned, but its context is
+// cancelled as soon as the request, task or schedule run is over. Work which has to complete must be
+// joined by Wait before returning; work meant to outlive the request needs a context of its own.
+// The child must not write the HTTP response: HttpContext() returns a read-only copy there.
+func (ctx *Portal) Go(fn func(*Portal) error) {
+    group := ctx.goGroup()
+    child := ctx.child(group.ctx)
+
+    group.waitGroup.Add(1)
+    go func() {
+        defer group.waitGroup.Done()
+
+        if err := child.run(fn); err != nil {
+            group.once.Do(func() {
+                group.err = err
+                group.cancel()
+            })
+        }
+    }()
+}
+
+// Wait for the goroutines started by Go and return the first error among them.
+// Goroutines started afterwards form a new group.
+func (ctx *Portal) Wait() error {
+    ctx.LoggerMapMutex.Lock()
+    group := ctx.group
+    ctx.group = nil
+    ctx.LoggerMapMutex.Unlock()
+
+    if group == nil {
+        return nil
+    }
+
+    group.waitGroup.Wait()
+    group.cancel()
+    return group.err
+}
+
+func (ctx *Portal) goGroup() *goGroup {
+    ctx.LoggerMapMutex.Lock()
+    defer ctx.LoggerMapMutex.Unlock()
+
+    if ctx.group == nil {
+        groupCtx, cancel := context.WithCancel(ctx.Context)
+        ctx.group = &goGroup{ctx: groupCtx, cancel: cancel}
+    }
+    return ctx.group
+}
+
+func (ctx *Portal) child(parent context.Context) *Portal {
+    result := NewVascContext(ctx.ProjectName)
+    result.TxID         = ctx.TxID
+    result.HandlerName  = ctx.HandlerName
+    result.LogLevel     = ctx.LogLevel
+    result.LogSelector  = ctx.LogSelector
+    result.Context      = parent
+    result.attributes   = ctx.attributeBag()
+    result.containerCtx = ctx.containerCtx
+
+    // gin.Context must not be used once the request is over
+    if c, ok := ctx.containerCtx.(*gin.Context); ok && c != nil {
+        result.containerCtx = c.Copy()
+    }
+    return result
+}
+
+func (ctx *Portal) run(fn func(*Portal) error) (err error) {
+    spanCtx, span := tracing.Tracer().Start(ctx.Context, "go " + ctx.HandlerName, trace.WithSpanKind(trace.SpanKindInternal))
+    runCtx, cancelFunc := context.WithCancel(spanCtx)
+    ctx.Context = runCtx
+
+    defer func() {
+        if r := recover(); r != nil {
+            ctx.Logger("_go").ErrorLog("%s: Panic:[%v] %s", ctx.HandlerName, r, debug.Stack())
+            err = fmt.Errorf("panic: %v", r)
+        } else if err != nil {
+            ctx.Logger("_go").ErrorLog("%s: %v", ctx.HandlerName, err)
+        }
+        tracing.RecordError(span, err)
+        cancelFunc()
+        span.End()
+        ctx.Close()
+    }()
+
+    return fn(ctx)
+}
@@ -0,0 +1,57 @@
+package portal
+
+import (
+    "context"
+    "github.com/gin-gonic/gin"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+func TestGoOutlivesHandler(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+
+    returned := make(chan struct{})
+    result   := make(chan error, 1)
+    engine   := gin.New()
+    engine.GET("/", MakeGinRouteWithContext("test", "go", func(p *Portal) {
+        // Not joined by Wait
+        p.Go(func(child *Portal) error {
+            <-returned
+            select {
+                case <-child.Context.Done():
+                    result <- child.Context.Err()
+                case <-time.After(time.Second):
+                    result <- nil
+            }
+            return nil
+        })
+    }, 0))
+
+    engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+    close(returned)
+
+    if err := <-result; err != context.Canceled {
+        t.Fatalf("expected the child to be cancelled once the request is over, got %v", err)
+    }
+}
+
+func TestGoJoinedByWait(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+
+    var err error
+    engine := gin.New()
+    engine.GET("/", MakeGinRouteWithContext("test", "go", func(p *Portal) {
+        p.Go(func(child *Portal) error {
+            time.Sleep(10 * time.Millisecond)
+            return child.Context.Err()
+        })
+        err = p.Wait()
+    }, 0))
+
+    engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+    if err != nil {
+        t.Fatalf("expected the joined child to finish within the request, got %v", err)
+    }
+}
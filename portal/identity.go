@@ -0,0 +1,47 @@
+package portal
+
+import (
+    "github.com/gin-gonic/gin"
+)
+
+// Key of the verified identity in gin.Context
+const IdentityKey = "vasc.identity"
+
+// Caller identity verified by an authentication provider
+type Identity struct {
+    Provider    string
+    Scheme      string
+    Subject     string
+    Claims      map[string]interface{}
+}
+
+// Attribute holding the identity, also readable by tasks and schedules which set one
+var IdentityAttribute = NewKey[*Identity]("identity")
+
+func SetIdentity(c *gin.Context, identity *Identity) {
+    SetGin(c, IdentityAttribute, identity)
+    // Kept for code reading gin.Context directly
+    c.Set(IdentityKey, identity)
+}
+
+// Identity of the request, nil if the route is not authenticated.
+func (ctx *Portal) Identity() *Identity {
+    identity, _ := Get(ctx, IdentityAttribute)
+    return identity
+}
+
+// Identity verified for the request of c, nil if the route is not authenticated.
+func GinIdentity(c *gin.Context) *Identity {
+    identity, _ := GetGin(c, IdentityAttribute)
+    return identity
+}
+
+func (ctx *Portal) Claim(name string) (interface{}, bool) {
+    identity := ctx.Identity()
+    if identity == nil || identity.Claims == nil {
+        return nil, false
+    }
+    
+    value, exists := identity.Claims[name]
+    return value, exists
+}
@@ -0,0 +1,27 @@
+package portal
+
+import (
+    "context"
+    "errors"
+)
+
+// Run fn under resilience policy name with a portal of its own whose context ends with the
+// policy timeout, so that the database sessions and redis connections it takes give up in time.
+// The error is that of fn, or one telling the policy rejected the call.
+func (ctx *Portal) Guard(name string, fn func(*Portal) error) error {
+    current := currentResources()
+    if current.Resilience == nil {
+        return errors.New("resilience is not enabled")
+    }
+
+    policy, err := current.Resilience.Policy(name)
+    if err != nil {
+        return err
+    }
+
+    return policy.Execute(ctx.Context, func(guarded context.Context) error {
+        child := ctx.child(guarded)
+        defer child.Close()
+        return fn(child)
+    })
+}
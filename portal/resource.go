@@ -0,0 +1,188 @@
+package portal
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "github.com/garyburd/redigo/redis"
+    "github.com/marxn/vasc/database"
+    "github.com/marxn/vasc/httpclient"
+    "github.com/marxn/vasc/localcache"
+    "github.com/marxn/vasc/logger"
+    "github.com/marxn/vasc/resilience"
+    vredis "github.com/marxn/vasc/redis"
+    "github.com/marxn/vasc/tenant"
+    "io"
+    "sync/atomic"
+    "time"
+    "xorm.io/xorm"
+)
+
+// Task queues as seen from a handler. Implemented by the task module, which cannot be
+// imported here.
+type TaskQueue interface {
+    PushNativeTaskWithContext(ctx context.Context, key string, content []byte) error
+    PushGlobalTaskWithContext(ctx context.Context, key string, content []byte) error
+}
+
+// Modules reachable from every portal. Any of them is nil when not enabled.
+type Resources struct {
+    DB            *database.VascDataBase
+    Redis         *vredis.VascRedis
+    Cache         *localcache.CacheManager
+    Tasks          TaskQueue
+    Tenant        *tenant.VascTenant
+    HttpClient    *httpclient.VascHttpClient
+    Resilience    *resilience.VascResilience
+}
+
+var resources atomic.Pointer[Resources]
+
+// Called by vasc once all modules are loaded.
+func SetResources(value *Resources) {
+    resources.Store(value)
+}
+
+func currentResources() *Resources {
+    if result := resources.Load(); result != nil {
+        return result
+    }
+    return &Resources{}
+}
+
+// The engine serving database key for the tenant of p.
+func (this *Resources) databaseKey(p *Portal, key string) string {
+    if this.Tenant == nil {
+        return key
+    }
+    return this.Tenant.DatabaseKey(p.Tenant(), key)
+}
+
+// The instance serving redis key for the tenant of p.
+func (this *Resources) redisKey(p *Portal, key string) string {
+    if this.Tenant == nil {
+        return key
+    }
+    return this.Tenant.RedisKey(p.Tenant(), key)
+}
+
+// Register closer to be closed together with the portal.
+func (ctx *Portal) bind(closer io.Closer) {
+    ctx.LoggerMapMutex.Lock()
+    defer ctx.LoggerMapMutex.Unlock()
+    ctx.closers = append(ctx.closers, closer)
+}
+
+// Open a session of database key bound to the portal: statements are traced, logged with
+// the TxID and cancelled with the portal context. The session is closed with the portal,
+// rolling back a transaction which has not been committed.
+func (ctx *Portal) DB(key string) (*xorm.Session, error) {
+    current := currentResources()
+    if current.DB == nil {
+        return nil, errors.New("database is not enabled")
+    }
+
+    engine, err := current.DB.GetEngine(current.databaseKey(ctx, key))
+    if err != nil {
+        return nil, err
+    }
+
+    session := engine.NewSession().Context(logger.NewContext(ctx.Context, ctx.TxID))
+    ctx.bind(session)
+    return session, nil
+}
+
+// Take a connection of redis instance key bound to the portal: commands are traced, failures
+// are logged with the TxID and nothing is sent once the portal context is done.
+// The connection goes back to the pool when the portal is closed, if not closed before.
+func (ctx *Portal) Redis(key string) (redis.Conn, error) {
+    current := currentResources()
+    if current.Redis == nil {
+        return nil, errors.New("redis is not enabled")
+    }
+
+    conn, err := current.Redis.GetConn(ctx.Context, current.redisKey(ctx, key))
+    if err != nil {
+        return nil, err
+    }
+
+    result := &redisConn{Conn: conn, portal: ctx}
+    ctx.bind(result)
+    return result, nil
+}
+
+// Return a client of upstream name bound to the portal: requests carry its tracer and trace,
+// end with its context and are logged with its TxID.
+func (ctx *Portal) HttpClient(name string) (*httpclient.Client, error) {
+    current := currentResources()
+    if current.HttpClient == nil {
+        return nil, errors.New("http client is not enabled")
+    }
+
+    upstream, err := current.HttpClient.Upstream(name)
+    if err != nil {
+        return nil, err
+    }
+    return upstream.Bind(ctx.Context, fmt.Sprintf("%016x", ctx.TxID), ctx.Logger("_http")), nil
+}
+
+// Return the local cache, or nil when it is not enabled.
+func (ctx *Portal) Cache() *localcache.CacheManager {
+    return currentResources().Cache
+}
+
+// Return the task queues with pushed tasks continuing the trace of the portal.
+func (ctx *Portal) Tasks() *Tasks {
+    return &Tasks{portal: ctx, queue: currentResources().Tasks}
+}
+
+type Tasks struct {
+    portal        *Portal
+    queue          TaskQueue
+}
+
+// Push a task to the queue of this instance.
+func (this *Tasks) Push(key string, content []byte) error {
+    if this.queue == nil {
+        return errors.New("task is not enabled")
+    }
+    return this.queue.PushNativeTaskWithContext(tenant.NewContext(this.portal.Context, this.portal.Tenant()), key, content)
+}
+
+// Push a task to the redis queue shared by all instances.
+func (this *Tasks) PushGlobal(key string, content []byte) error {
+    if this.queue == nil {
+        return errors.New("task is not enabled")
+    }
+    return this.queue.PushGlobalTaskWithContext(tenant.NewContext(this.portal.Context, this.portal.Tenant()), key, content)
+}
+
+type redisConn struct {
+    redis.Conn
+    portal        *Portal
+}
+
+// Commands are not sent once the context is done and never wait past its deadline.
+func (this *redisConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+    ctx := this.portal.Context
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+
+    var reply interface{}
+    var err error
+    if deadline, ok := ctx.Deadline(); ok {
+        timeout := time.Until(deadline)
+        if timeout <= 0 {
+            return nil, context.DeadlineExceeded
+        }
+        reply, err = redis.DoWithTimeout(this.Conn, timeout, commandName, args...)
+    } else {
+        reply, err = this.Conn.Do(commandName, args...)
+    }
+
+    if err != nil && err != redis.ErrNil {
+        this.portal.Logger("_redis").ErrorLog("%s: redis %s failed: %v", this.portal.HandlerName, commandName, err)
+    }
+    return reply, err
+}
@@ -0,0 +1,38 @@
+package portal
+
+import (
+    "github.com/gin-gonic/gin"
+)
+
+const StreamKey = "vasc.stream"
+
+// The connection of a WS or SSE route. It is closed when the handler returns.
+type Stream interface {
+    // Queue a text message, or a data event for SSE
+    Send(data []byte) error
+    SendJSON(value interface{}) error
+    // Queue a named event. On websocket it is sent as {"event":...,"data":...}
+    SendEvent(event string, data []byte) error
+    // Wait for the next message from the client. Not supported by SSE
+    Receive() ([]byte, error)
+    // Receive messages published to topic on any node
+    Subscribe(topic string) error
+    Unsubscribe(topic string)
+    Publish(topic string, data []byte) error
+    // Closed when the client goes away, the server shuts down or Close is called
+    Done() <-chan struct{}
+    Close() error
+}
+
+// Return the connection of a WS or SSE route, or nil for other routes.
+func (ctx *Portal) Stream() Stream {
+    c, ok := ctx.containerCtx.(*gin.Context)
+    if !ok || c == nil {
+        return nil
+    }
+
+    if value, exists := c.Get(StreamKey); exists {
+        return value.(Stream)
+    }
+    return nil
+}
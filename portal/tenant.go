@@ -0,0 +1,19 @@
+package portal
+
+// Attribute holding the tenant the request, task or goroutine works for
+var TenantAttribute = NewKey[string]("tenant")
+
+// Tenant of the portal, empty when tenancy is not enabled or none was resolved.
+func (ctx *Portal) Tenant() string {
+    id, _ := Get(ctx, TenantAttribute)
+    return id
+}
+
+// Put the redis key prefix of the tenant in front of key.
+func (ctx *Portal) RedisKey(key string) string {
+    tenants := currentResources().Tenant
+    if tenants == nil {
+        return key
+    }
+    return tenants.RedisPrefix(ctx.Tenant()) + key
+}
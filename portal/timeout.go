@@ -0,0 +1,148 @@
+package portal
+
+import (
+    "bufio"
+    "github.com/gin-gonic/gin"
+    "github.com/marxn/vasc/verror"
+    "net"
+    "net/http"
+    "sync"
+)
+
+// Response writer of a handler with a timeout. The 504 is written from the timer while the
+// handler may still be running, so every write goes through the mutex and the handler works
+// on its own header map until the response is committed. Writes after the timeout are dropped.
+type timeoutWriter struct {
+    gin.ResponseWriter
+    header        http.Header
+    tracer        string
+    mutex         sync.Mutex
+    timedOut      bool
+    finished      bool
+}
+
+func newTimeoutWriter(w gin.ResponseWriter, tracer string) *timeoutWriter {
+    return &timeoutWriter{
+        ResponseWriter: w,
+        header:         w.Header().Clone(),
+        tracer:         tracer,
+    }
+}
+
+func (this *timeoutWriter) Header() http.Header {
+    return this.header
+}
+
+// Copy the handler headers to the real response. Called with the mutex held.
+func (this *timeoutWriter) commitHeader() {
+    header := this.ResponseWriter.Header()
+    for key := range header {
+        if _, exists := this.header[key]; !exists {
+            delete(header, key)
+        }
+    }
+    for key, value := range this.header {
+        header[key] = value
+    }
+}
+
+func (this *timeoutWriter) WriteHeader(code int) {
+    this.mutex.Lock()
+    defer this.mutex.Unlock()
+
+    if !this.timedOut {
+        this.ResponseWriter.WriteHeader(code)
+    }
+}
+
+func (this *timeoutWriter) WriteHeaderNow() {
+    this.mutex.Lock()
+    defer this.mutex.Unlock()
+
+    if !this.timedOut {
+        this.commitHeader()
+        this.ResponseWriter.WriteHeaderNow()
+    }
+}
+
+func (this *timeoutWriter) Write(data []byte) (int, error) {
+    this.mutex.Lock()
+    defer this.mutex.Unlock()
+
+    if this.timedOut {
+        return 0, http.ErrHandlerTimeout
+    }
+    this.commitHeader()
+    return this.ResponseWriter.Write(data)
+}
+
+func (this *timeoutWriter) WriteString(data string) (int, error) {
+    return this.Write([]byte(data))
+}
+
+func (this *timeoutWriter) Flush() {
+    this.mutex.Lock()
+    defer this.mutex.Unlock()
+
+    if !this.timedOut {
+        this.commitHeader()
+        this.ResponseWriter.Flush()
+    }
+}
+
+func (this *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+    this.mutex.Lock()
+    defer this.mutex.Unlock()
+
+    if this.timedOut {
+        return nil, nil, http.ErrHandlerTimeout
+    }
+    return this.ResponseWriter.Hijack()
+}
+
+func (this *timeoutWriter) Status() int {
+    this.mutex.Lock()
+    defer this.mutex.Unlock()
+    return this.ResponseWriter.Status()
+}
+
+func (this *timeoutWriter) Size() int {
+    this.mutex.Lock()
+    defer this.mutex.Unlock()
+    return this.ResponseWriter.Size()
+}
+
+// A timed out response counts as written, so that nothing else is rendered into it.
+func (this *timeoutWriter) Written() bool {
+    this.mutex.Lock()
+    defer this.mutex.Unlock()
+    return this.timedOut || this.ResponseWriter.Written()
+}
+
+// Answer 504 unless the handler has already started the response or returned.
+func (this *timeoutWriter) timeout() {
+    this.mutex.Lock()
+    defer this.mutex.Unlock()
+
+    if this.finished || this.ResponseWriter.Written() {
+        return
+    }
+
+    this.timedOut = true
+    verror.Write(this.ResponseWriter, this.tracer, verror.Timeout(nil))
+
+    // The handler still holds the request, so the response would wait for it unless flushed
+    this.ResponseWriter.Flush()
+}
+
+// Called once the handler has returned. Reports whether the 504 has been sent.
+func (this *timeoutWriter) finish() bool {
+    this.mutex.Lock()
+    defer this.mutex.Unlock()
+
+    if !this.timedOut {
+        this.commitHeader()
+    }
+    this.finished = true
+    return this.timedOut
+}
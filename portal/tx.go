@@ -0,0 +1,197 @@
+package portal
+
+import (
+    "errors"
+    "fmt"
+    "github.com/marxn/vasc/database"
+    "github.com/marxn/vasc/logger"
+    "time"
+    "xorm.io/xorm"
+)
+
+// Guarded by LoggerMapMutex of the portal, like the map of transactions
+type transaction struct {
+    session       *xorm.Session
+    savepoints     int
+    aborted        error
+}
+
+// Run fn in a transaction of database key. It is committed when fn returns nil and rolled back
+// when fn fails or panics. A Tx on the same key started from within fn becomes a savepoint of
+// the running one. The outermost transaction is run again after a deadlock or serialization
+// failure, as many times as tx_retries of the database config allows. Such a failure within a
+// savepoint fails the whole transaction, since the database has already rolled all of it back.
+func (ctx *Portal) Tx(key string, fn func(session *xorm.Session) error) error {
+    if current := ctx.transaction(key); current != nil {
+        return ctx.savepoint(key, current, fn)
+    }
+    
+    current := currentResources()
+    db := current.DB
+    if db == nil {
+        return errors.New("database is not enabled")
+    }
+    
+    engine, err := db.GetEngine(current.databaseKey(ctx, key))
+    if err != nil {
+        return err
+    }
+    
+    retries  := 0
+    interval := 50 * time.Millisecond
+    if db.Config != nil {
+        retries = db.Config.TxRetries
+        if db.Config.TxRetryInterval > 0 {
+            interval = time.Duration(db.Config.TxRetryInterval) * time.Millisecond
+        }
+    }
+    
+    for attempt := 0; ; attempt++ {
+        err = ctx.runTx(engine, key, fn)
+        if err == nil || attempt >= retries || !database.IsRetryable(err) {
+            return err
+        }
+        
+        ctx.Logger("_xorm").WarnLog("%s: transaction on %s retried(%d/%d): %v", ctx.HandlerName, key, attempt + 1, retries, err)
+        select {
+            case <-ctx.Context.Done():
+                return err
+            case <-time.After(interval * time.Duration(attempt + 1)):
+        }
+    }
+}
+
+func (ctx *Portal) runTx(engine *xorm.Engine, key string, fn func(session *xorm.Session) error) error {
+    session := engine.NewSession().Context(logger.NewContext(ctx.Context, ctx.TxID))
+    defer session.Close()
+    
+    if err := session.Begin(); err != nil {
+        return err
+    }
+    
+    current := &transaction{session: session}
+    ctx.setTransaction(key, current)
+    defer ctx.setTransaction(key, nil)
+    
+    defer func() {
+        if r := recover(); r != nil {
+            ctx.rollback(key, session, "", fmt.Errorf("panic: %v", r))
+            panic(r)
+        }
+    }()
+    
+    err := fn(session)
+    
+    // fn may have swallowed the failure of a savepoint which took the transaction down
+    if aborted := ctx.abortedBy(current); aborted != nil {
+        err = aborted
+    }
+    if err != nil {
+        ctx.rollback(key, session, "", err)
+        return err
+    }
+    return session.Commit()
+}
+
+func (ctx *Portal) savepoint(key string, current *transaction, fn func(session *xorm.Session) error) error {
+    name, err := ctx.nextSavepoint(current)
+    if err != nil {
+        return err
+    }
+    
+    if _, err := current.session.Exec("SAVEPOINT " + name); err != nil {
+        return ctx.abortOnRetryable(current, err)
+    }
+    
+    defer func() {
+        if r := recover(); r != nil {
+            ctx.rollback(key, current.session, name, fmt.Errorf("panic: %v", r))
+            panic(r)
+        }
+    }()
+    
+    if err := fn(current.session); err != nil {
+        if database.IsRetryable(err) {
+            return ctx.abortOnRetryable(current, err)
+        }
+        ctx.rollback(key, current.session, name, err)
+        return err
+    }
+    
+    _, err = current.session.Exec("RELEASE SAVEPOINT " + name)
+    return ctx.abortOnRetryable(current, err)
+}
+
+// Name a new savepoint of current. Names are never reused within a transaction.
+func (ctx *Portal) nextSavepoint(current *transaction) (string, error) {
+    ctx.LoggerMapMutex.Lock()
+    defer ctx.LoggerMapMutex.Unlock()
+    
+    if current.aborted != nil {
+        return "", current.aborted
+    }
+    current.savepoints++
+    return fmt.Sprintf("vasc_sp_%d", current.savepoints), nil
+}
+
+// Remember a deadlock or serialization failure so that the outermost Tx retries, whatever
+// the callers in between make of err.
+func (ctx *Portal) abortOnRetryable(current *transaction, err error) error {
+    if !database.IsRetryable(err) {
+        return err
+    }
+    
+    ctx.LoggerMapMutex.Lock()
+    defer ctx.LoggerMapMutex.Unlock()
+    if current.aborted == nil {
+        current.aborted = err
+    }
+    return err
+}
+
+func (ctx *Portal) abortedBy(current *transaction) error {
+    ctx.LoggerMapMutex.Lock()
+    defer ctx.LoggerMapMutex.Unlock()
+    return current.aborted
+}
+
+// Roll back the transaction, or only up to savepoint when it is not empty.
+func (ctx *Portal) rollback(key string, session *xorm.Session, savepoint string, cause error) {
+    var err error
+    target := "transaction"
+    if savepoint == "" {
+        err = session.Rollback()
+    } else {
+        // The savepoint is released as well, it would otherwise stay until the end of the transaction
+        if _, err = session.Exec("ROLLBACK TO SAVEPOINT " + savepoint); err == nil {
+            _, err = session.Exec("RELEASE SAVEPOINT " + savepoint)
+        }
+        target = "savepoint " + savepoint
+    }
+    
+    if err != nil {
+        ctx.Logger("_xorm").ErrorLog("%s: cannot roll back %s on %s: %v, cause: %v", ctx.HandlerName, target, key, err, cause)
+    } else {
+        ctx.Logger("_xorm").WarnLog("%s: %s on %s rolled back: %v", ctx.HandlerName, target, key, cause)
+    }
+}
+
+func (ctx *Portal) transaction(key string) *transaction {
+    ctx.LoggerMapMutex.Lock()
+    defer ctx.LoggerMapMutex.Unlock()
+    return ctx.transactions[key]
+}
+
+func (ctx *Portal) setTransaction(key string, value *transaction) {
+    ctx.LoggerMapMutex.Lock()
+    defer ctx.LoggerMapMutex.Unlock()
+    
+    if value == nil {
+        delete(ctx.transactions, key)
+        return
+    }
+    if ctx.transactions == nil {
+        ctx.transactions = make(map[string]*transaction)
+    }
+    ctx.transactions[key] = value
+}
@@ -0,0 +1,117 @@
+package portal
+
+import (
+    "context"
+    "errors"
+    _ "github.com/mattn/go-sqlite3"
+    "github.com/marxn/vasc/database"
+    "github.com/marxn/vasc/global"
+    "path/filepath"
+    "testing"
+    "xorm.io/xorm"
+)
+
+func txPortal(t *testing.T) (*Portal, *xorm.Engine) {
+    engine, err := xorm.NewEngine("sqlite3", filepath.Join(t.TempDir(), "tx.db"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { _ = engine.Close() })
+
+    if _, err := engine.Exec("CREATE TABLE item (id INTEGER PRIMARY KEY)"); err != nil {
+        t.Fatal(err)
+    }
+
+    SetResources(&Resources{DB: &database.VascDataBase{
+        Engine: map[string]*xorm.Engine{"main": engine},
+        Config: &global.DatabaseConfig{TxRetries: 2, TxRetryInterval: 1},
+    }})
+    t.Cleanup(func() { SetResources(&Resources{}) })
+
+    p := NewVascContext("test")
+    p.Context = context.Background()
+    return p, engine
+}
+
+func itemIDs(t *testing.T, engine *xorm.Engine) []int64 {
+    var result []int64
+    if err := engine.Table("item").Cols("id").Asc("id").Find(&result); err != nil {
+        t.Fatal(err)
+    }
+    return result
+}
+
+func insert(session *xorm.Session, id int) error {
+    _, err := session.Exec("INSERT INTO item (id) VALUES (?)", id)
+    return err
+}
+
+func TestSavepointRolledBackAndReleased(t *testing.T) {
+    p, engine := txPortal(t)
+    failure := errors.New("inner failure")
+
+    err := p.Tx("main", func(session *xorm.Session) error {
+        if err := insert(session, 1); err != nil {
+            return err
+        }
+        if err := p.Tx("main", func(session *xorm.Session) error {
+            if err := insert(session, 2); err != nil {
+                return err
+            }
+            return failure
+        }); err != failure {
+            t.Fatalf("expected the inner error, got %v", err)
+        }
+
+        // A savepoint left behind could still be released here
+        if _, err := session.Exec("RELEASE SAVEPOINT vasc_sp_1"); err == nil {
+            t.Fatal("savepoint is still open after being rolled back")
+        }
+        return insert(session, 3)
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if ids := itemIDs(t, engine); len(ids) != 2 || ids[0] != 1 || ids[1] != 3 {
+        t.Fatalf("expected items 1 and 3, got %v", ids)
+    }
+}
+
+func TestRetryableSavepointFailureRetriesTransaction(t *testing.T) {
+    p, engine := txPortal(t)
+    attempts := 0
+
+    err := p.Tx("main", func(session *xorm.Session) error {
+        attempts++
+        if err := insert(session, attempts * 10); err != nil {
+            return err
+        }
+
+        // The caller ignores the failure, the transaction must not be committed anyway
+        _ = p.Tx("main", func(session *xorm.Session) error {
+            if attempts == 1 {
+                return errors.New("Error 1213: Deadlock found when trying to get lock")
+            }
+            return insert(session, attempts * 10 + 1)
+        })
+
+        // Nothing more runs on a transaction the database has rolled back
+        if attempts == 1 {
+            if err := p.Tx("main", func(session *xorm.Session) error { return nil }); !database.IsRetryable(err) {
+                t.Fatalf("expected the deadlock for a later savepoint, got %v", err)
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if attempts != 2 {
+        t.Fatalf("expected the transaction to run twice, ran %d times", attempts)
+    }
+    if ids := itemIDs(t, engine); len(ids) != 2 || ids[0] != 20 || ids[1] != 21 {
+        t.Fatalf("expected items of the second attempt only, got %v", ids)
+    }
+}
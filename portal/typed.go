@@ -0,0 +1,192 @@
+package portal
+
+import (
+    "encoding/json"
+    "encoding/xml"
+    "errors"
+    "github.com/gin-gonic/gin"
+    "github.com/gin-gonic/gin/binding"
+    "github.com/go-playground/validator/v10"
+    "github.com/marxn/vasc/verror"
+    "io"
+    "net/http"
+    "net/textproto"
+    "reflect"
+)
+
+var portalType = reflect.TypeOf((*Portal)(nil))
+var errorType  = reflect.TypeOf((*error)(nil)).Elem()
+
+// A handler of the form func(*Portal, *Req) (*Resp, error).
+// Req is bound from path (uri tag), query (form tag), header (header tag) and body, then validated by binding tags.
+type TypedHandler struct {
+    Handler        reflect.Value
+    RequestType    reflect.Type
+    ResponseType   reflect.Type
+}
+
+type FieldError struct {
+    Field          string        `json:"field"`
+    Rule           string        `json:"rule"`
+    Param          string        `json:"param,omitempty"`
+}
+
+// Check the prototype of handler and wrap it, returns false if it is not a typed handler.
+func ParseTypedHandler(handler interface{}) (*TypedHandler, bool) {
+    value := reflect.ValueOf(handler)
+    if value.Kind() != reflect.Func {
+        return nil, false
+    }
+
+    funcType := value.Type()
+    if funcType.NumIn() != 2 || funcType.NumOut() != 2 {
+        return nil, false
+    }
+
+    if funcType.In(0) != portalType || funcType.Out(1) != errorType {
+        return nil, false
+    }
+
+    requestType := funcType.In(1)
+    if requestType.Kind() != reflect.Ptr || requestType.Elem().Kind() != reflect.Struct {
+        return nil, false
+    }
+
+    return &TypedHandler{
+        Handler:      value,
+        RequestType:  requestType.Elem(),
+        ResponseType: funcType.Out(0),
+    }, true
+}
+
+func MakeTypedGinRoute(projectName string, handlerName string, handler *TypedHandler, timeout int) func(c *gin.Context) {
+    return MakeGinRouteWithContext(projectName, handlerName, func(p *Portal) {
+        c := p.HttpContext()
+
+        request := reflect.New(handler.RequestType)
+        if err := BindRequest(c, request.Interface()); err != nil {
+            p.renderBindError(err)
+            return
+        }
+
+        result := handler.Handler.Call([]reflect.Value{reflect.ValueOf(p), request})
+
+        if err, _ := result[1].Interface().(error); err != nil {
+            p.Error(err)
+            return
+        }
+
+        // The handler may have written the response by itself
+        if c.Writer.Written() {
+            return
+        }
+
+        response := result[0]
+        if (response.Kind() == reflect.Ptr || response.Kind() == reflect.Interface) && response.IsNil() {
+            c.Status(http.StatusNoContent)
+            return
+        }
+
+        c.JSON(http.StatusOK, response.Interface())
+    }, timeout)
+}
+
+// Bind body, path, query and header into obj and validate it. Later sources override earlier ones,
+// so the body cannot overwrite a field bound from the path or a header.
+func BindRequest(c *gin.Context, obj interface{}) error {
+    if err := bindBody(c, obj); err != nil {
+        return err
+    }
+
+    err := bindTagged(obj, "uri", func(name string) ([]string, bool) {
+        value, exists := c.Params.Get(name)
+        return []string{value}, exists
+    })
+    if err != nil {
+        return err
+    }
+
+    query := c.Request.URL.Query()
+    err = bindTagged(obj, "form", func(name string) ([]string, bool) {
+        value, exists := query[name]
+        return value, exists
+    })
+    if err != nil {
+        return err
+    }
+
+    // Header tags may be written in any case
+    err = bindTagged(obj, "header", func(name string) ([]string, bool) {
+        value, exists := c.Request.Header[textproto.CanonicalMIMEHeaderKey(name)]
+        return value, exists
+    })
+    if err != nil {
+        return err
+    }
+
+    if binding.Validator == nil {
+        return nil
+    }
+    return binding.Validator.ValidateStruct(obj)
+}
+
+func bindBody(c *gin.Context, obj interface{}) error {
+    if c.Request.Body == nil || c.Request.Body == http.NoBody || c.Request.ContentLength == 0 {
+        return nil
+    }
+
+    switch c.ContentType() {
+        case binding.MIMEJSON:
+            err := json.NewDecoder(c.Request.Body).Decode(obj)
+            if err == io.EOF {
+                return nil
+            }
+            return err
+        case binding.MIMEXML, binding.MIMEXML2:
+            err := xml.NewDecoder(c.Request.Body).Decode(obj)
+            if err == io.EOF {
+                return nil
+            }
+            return err
+        case binding.MIMEPOSTForm:
+            if err := c.Request.ParseForm(); err != nil {
+                return err
+            }
+            return bindForm(obj, c.Request.PostForm)
+        case binding.MIMEMultipartPOSTForm:
+            if err := c.Request.ParseMultipartForm(32 << 20); err != nil {
+                return err
+            }
+            return bindForm(obj, c.Request.MultipartForm.Value)
+        default:
+            status := http.StatusUnsupportedMediaType
+            return verror.Newf(status, status, "Unsupported content type: %s", c.ContentType())
+    }
+}
+
+func bindForm(obj interface{}, form map[string][]string) error {
+    return bindTagged(obj, "form", func(name string) ([]string, bool) {
+        value, exists := form[name]
+        return value, exists
+    })
+}
+
+func (ctx *Portal) renderBindError(err error) {
+    var vascError *verror.VascError
+    if errors.As(err, &vascError) {
+        ctx.Error(vascError)
+        return
+    }
+
+    var validationErrors validator.ValidationErrors
+    if errors.As(err, &validationErrors) {
+        details := make([]FieldError, 0, len(validationErrors))
+        for _, value := range validationErrors {
+            details = append(details, FieldError{Field: value.Namespace(), Rule: value.Tag(), Param: value.Param()})
+        }
+        ctx.Error(verror.BadRequest("invalid request").WithDetails(details))
+        return
+    }
+
+    ctx.Error(verror.BadRequest("invalid request").WithCause(err))
+}
@@ -0,0 +1,142 @@
+package portal
+
+import (
+    "encoding/json"
+    "github.com/gin-gonic/gin"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+type pagination struct {
+    Page           int              `form:"page,default=1"`
+}
+
+type bindRequest struct {
+    pagination
+    ID             int64            `uri:"id"`
+    Tags           []string         `form:"tag"`
+    Wait           time.Duration    `form:"wait"`
+    Trace          string           `header:"x-request-id"`
+    Name           string           `json:"name" form:"name"`
+    Role           string
+}
+
+func bindTest(t *testing.T, request *http.Request) (*bindRequest, error) {
+    t.Helper()
+    gin.SetMode(gin.TestMode)
+
+    c, _ := gin.CreateTestContext(httptest.NewRecorder())
+    c.Request = request
+    c.Params  = gin.Params{{Key: "id", Value: "42"}}
+
+    result := &bindRequest{}
+    return result, BindRequest(c, result)
+}
+
+func TestBindTaggedSources(t *testing.T) {
+    request := httptest.NewRequest(http.MethodGet, "/users/42?tag=a&tag=b&wait=2s", nil)
+    request.Header.Set("X-Request-Id", "abc")
+
+    result, err := bindTest(t, request)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if result.ID != 42 || result.Page != 1 || result.Wait != 2 * time.Second || result.Trace != "abc" {
+        t.Fatalf("unexpected binding: %+v", result)
+    }
+    if len(result.Tags) != 2 || result.Tags[0] != "a" || result.Tags[1] != "b" {
+        t.Fatalf("unexpected tags: %v", result.Tags)
+    }
+}
+
+func TestBindIgnoresUntaggedFields(t *testing.T) {
+    request := httptest.NewRequest(http.MethodPost, "/users/42?Role=admin&role=admin", strings.NewReader("Role=admin&name=bob"))
+    request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    request.Header.Set("Role", "admin")
+
+    result, err := bindTest(t, request)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if result.Role != "" {
+        t.Fatalf("untagged field bound: %q", result.Role)
+    }
+    if result.Name != "bob" {
+        t.Fatalf("tagged form field not bound: %q", result.Name)
+    }
+}
+
+func TestBindInvalidValue(t *testing.T) {
+    request := httptest.NewRequest(http.MethodGet, "/users/42?page=x", nil)
+    if _, err := bindTest(t, request); err == nil {
+        t.Fatal("expected an error for a malformed number")
+    }
+}
+
+type ownedRequest struct {
+    ID             int64            `uri:"id" json:"id"`
+    Trace          string           `header:"x-request-id" json:"trace"`
+    Name           string           `json:"name"`
+}
+
+func TestBindBodyCannotOverride(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    request := httptest.NewRequest(http.MethodPost, "/users/42", strings.NewReader(`{"id": 1, "trace": "forged", "name": "bob"}`))
+    request.Header.Set("Content-Type", "application/json")
+    request.Header.Set("X-Request-Id", "abc")
+
+    c, _ := gin.CreateTestContext(httptest.NewRecorder())
+    c.Request = request
+    c.Params  = gin.Params{{Key: "id", Value: "42"}}
+
+    result := &ownedRequest{}
+    if err := BindRequest(c, result); err != nil {
+        t.Fatal(err)
+    }
+    if result.ID != 42 || result.Trace != "abc" || result.Name != "bob" {
+        t.Fatalf("expected path and header to win over the body, got %+v", result)
+    }
+}
+
+func TestBindDefaultKeepsBody(t *testing.T) {
+    request := httptest.NewRequest(http.MethodPost, "/users/42", strings.NewReader("page=3"))
+    request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+    result, err := bindTest(t, request)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if result.Page != 3 {
+        t.Fatalf("expected the default not to replace the body, got %d", result.Page)
+    }
+}
+
+func TestBindUnsupportedContentType(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    request := httptest.NewRequest(http.MethodPost, "/users/42", strings.NewReader("name: bob"))
+    request.Header.Set("Content-Type", "application/yaml")
+
+    recorder := httptest.NewRecorder()
+    c, _ := gin.CreateTestContext(recorder)
+    c.Request = request
+
+    err := BindRequest(c, &ownedRequest{})
+    if err == nil {
+        t.Fatal("expected an error for an unsupported content type")
+    }
+
+    p := NewVascContext("test")
+    p.containerCtx = c
+    p.renderBindError(err)
+
+    if recorder.Code != http.StatusUnsupportedMediaType {
+        t.Fatalf("expected 415, got %d: %s", recorder.Code, recorder.Body.String())
+    }
+    body := make(map[string]interface{})
+    if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil || body["code"] != float64(http.StatusUnsupportedMediaType) {
+        t.Fatalf("unexpected body %s", recorder.Body.String())
+    }
+}
@@ -0,0 +1,342 @@
+/*
+ * Reverse proxy routes for services acting as gateways.
+ */
+
+package proxy
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "github.com/gin-gonic/gin"
+    "github.com/marxn/vasc/global"
+    "github.com/marxn/vasc/logger"
+    "github.com/marxn/vasc/tracing"
+    "github.com/marxn/vasc/verror"
+    "io"
+    "math/rand"
+    "net"
+    "net/http"
+    "regexp"
+    "strings"
+    "sync/atomic"
+    "time"
+)
+
+// Headers which apply to a single connection and are not forwarded
+var hopHeaders = []string{
+    "Connection",
+    "Proxy-Connection",
+    "Keep-Alive",
+    "Proxy-Authenticate",
+    "Proxy-Authorization",
+    "Te",
+    "Trailer",
+    "Transfer-Encoding",
+    "Upgrade",
+}
+
+// Bodies up to this size are kept for retries by default, larger ones are streamed without retrying
+const DefaultRetryBodyLimit = 1 << 20
+
+var idempotentMethods = map[string]bool{
+    http.MethodGet:     true,
+    http.MethodHead:    true,
+    http.MethodOptions: true,
+    http.MethodPut:     true,
+    http.MethodDelete:  true,
+}
+
+type rewriteRule struct {
+    From    *regexp.Regexp
+    To       string
+}
+
+type VascProxy struct {
+    ProjectName     string
+    Config         *global.ProxyConfig
+    Transport      *http.Transport
+    balancer       *balancer
+    rewrite       []rewriteRule
+}
+
+func New(config *global.ProxyConfig, projectName string) (*VascProxy, error) {
+    if config == nil {
+        return nil, errors.New("proxy route requires proxy config")
+    }
+
+    maxFails := config.MaxFails
+    if maxFails == 0 {
+        maxFails = 3
+    }
+    failTimeout := time.Duration(config.FailTimeout) * time.Second
+    if failTimeout <= 0 {
+        failTimeout = 10 * time.Second
+    }
+
+    balancer, err := newBalancer(config.UpstreamList, config.Balance, maxFails, failTimeout)
+    if err != nil {
+        return nil, err
+    }
+
+    result := &VascProxy{
+        ProjectName: projectName,
+        Config:      config,
+        balancer:    balancer,
+    }
+
+    for _, value := range config.Rewrite {
+        from, err := regexp.Compile(value.From)
+        if err != nil {
+            return nil, errors.New("invalid proxy rewrite: " + err.Error())
+        }
+        result.rewrite = append(result.rewrite, rewriteRule{From: from, To: value.To})
+    }
+
+    connectTimeout := time.Duration(config.ConnectTimeout) * time.Second
+    if connectTimeout <= 0 {
+        connectTimeout = 5 * time.Second
+    }
+    result.Transport = &http.Transport{
+        Proxy:                 nil,
+        DialContext:           (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext,
+        ResponseHeaderTimeout: time.Duration(config.Timeout) * time.Second,
+        MaxIdleConnsPerHost:   64,
+        IdleConnTimeout:       90 * time.Second,
+        TLSHandshakeTimeout:   connectTimeout,
+    }
+
+    return result, nil
+}
+
+func (this *VascProxy) Handler(c *gin.Context) {
+    tracer := c.Request.Header.Get("X-Vasc-Request-Tracer")
+    if tracer == "" {
+        tracer = fmt.Sprintf("%016x", rand.Uint64())
+        c.Request.Header.Set("X-Vasc-Request-Tracer", tracer)
+    }
+
+    retries := 0
+    if idempotentMethods[c.Request.Method] {
+        retries = this.Config.Retries
+    }
+
+    // A body can only be sent again when it has been kept
+    var body []byte
+    var stream io.Reader = c.Request.Body
+    if retries > 0 && c.Request.Body != nil && c.Request.Body != http.NoBody {
+        limit := this.retryBodyLimit()
+        if c.Request.ContentLength > limit {
+            retries = 0
+        } else {
+            var err error
+            if body, err = io.ReadAll(io.LimitReader(c.Request.Body, limit + 1)); err != nil {
+                verror.Render(c, verror.BadRequest("cannot read request body"))
+                return
+            }
+            // Beyond the limit the part read so far is sent ahead of the rest
+            if int64(len(body)) > limit {
+                retries = 0
+                stream  = io.MultiReader(bytes.NewReader(body), c.Request.Body)
+                body    = nil
+            }
+        }
+    }
+
+    tried := make(map[*Upstream]bool)
+    for attempt := 0; ; attempt++ {
+        upstream := this.balancer.pick(tried)
+        if upstream == nil {
+            // More retries than upstreams: go round again
+            tried    = make(map[*Upstream]bool)
+            upstream = this.balancer.pick(tried)
+        }
+        tried[upstream] = true
+
+        requestBody, contentLength := stream, c.Request.ContentLength
+        if body != nil {
+            requestBody, contentLength = bytes.NewReader(body), int64(len(body))
+        }
+
+        response, err := this.roundTrip(c, upstream, requestBody, contentLength)
+        failed := err != nil || response.StatusCode == http.StatusBadGateway ||
+            response.StatusCode == http.StatusServiceUnavailable || response.StatusCode == http.StatusGatewayTimeout
+
+        if failed {
+            this.balancer.markFailure(upstream)
+            if err != nil {
+                logger.LogSelector("_gin").ErrorLog("tid[%s] proxy to %s failed: %v", tracer, upstream.URL.Host, err)
+            }
+        } else {
+            this.balancer.markSuccess(upstream)
+        }
+
+        if !failed || attempt >= retries {
+            if err != nil {
+                this.renderError(c, err)
+                return
+            }
+            this.copyResponse(c, upstream, response)
+            return
+        }
+        if response != nil {
+            response.Body.Close()
+        }
+    }
+}
+
+func (this *VascProxy) roundTrip(c *gin.Context, upstream *Upstream, body io.Reader, contentLength int64) (*http.Response, error) {
+    atomic.AddInt64(&upstream.active, 1)
+
+    request, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, this.targetURL(c, upstream), body)
+    if err != nil {
+        atomic.AddInt64(&upstream.active, -1)
+        return nil, err
+    }
+    request.ContentLength = contentLength
+
+    this.copyRequestHeader(c, request)
+
+    response, err := this.Transport.RoundTrip(request)
+    if err != nil {
+        atomic.AddInt64(&upstream.active, -1)
+        return nil, err
+    }
+
+    // The connection counts as active until the body has been relayed
+    response.Body = &countedBody{ReadCloser: response.Body, upstream: upstream}
+    return response, nil
+}
+
+func (this *VascProxy) retryBodyLimit() int64 {
+    if this.Config.RetryBodyLimit > 0 {
+        return this.Config.RetryBodyLimit
+    }
+    return DefaultRetryBodyLimit
+}
+
+// Release the idle upstream connections once the proxy is no longer routed to.
+func (this *VascProxy) Close() {
+    this.Transport.CloseIdleConnections()
+}
+
+func (this *VascProxy) targetURL(c *gin.Context, upstream *Upstream) string {
+    requestPath := c.Request.URL.Path
+    if this.Config.StripPrefix != "" {
+        requestPath = strings.TrimPrefix(requestPath, this.Config.StripPrefix)
+    }
+    for _, rule := range this.rewrite {
+        requestPath = rule.From.ReplaceAllString(requestPath, rule.To)
+    }
+    if !strings.HasPrefix(requestPath, "/") {
+        requestPath = "/" + requestPath
+    }
+
+    target := *upstream.URL
+    target.Path     = strings.TrimSuffix(target.Path, "/") + requestPath
+    target.RawPath  = ""
+    target.RawQuery = c.Request.URL.RawQuery
+    return target.String()
+}
+
+func (this *VascProxy) copyRequestHeader(c *gin.Context, request *http.Request) {
+    for key, value := range c.Request.Header {
+        request.Header[key] = append([]string(nil), value...)
+    }
+    removeHopHeaders(request.Header)
+
+    if this.Config.PreserveHost {
+        request.Host = c.Request.Host
+    }
+
+    clientIP, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+    if err != nil {
+        clientIP = c.Request.RemoteAddr
+    }
+    if prior := c.Request.Header.Get("X-Forwarded-For"); prior != "" {
+        clientIP = prior + ", " + clientIP
+    }
+    request.Header.Set("X-Forwarded-For", clientIP)
+    request.Header.Set("X-Forwarded-Host", c.Request.Host)
+    if c.Request.TLS != nil {
+        request.Header.Set("X-Forwarded-Proto", "https")
+    } else {
+        request.Header.Set("X-Forwarded-Proto", "http")
+    }
+
+    // The upstream continues from this hop rather than from the caller
+    tracing.InjectHeader(c, request.Header)
+    
+    for _, value := range this.Config.RemoveHeaders {
+        request.Header.Del(value)
+    }
+    for key, value := range this.Config.SetHeaders {
+        request.Header.Set(key, value)
+    }
+}
+
+func (this *VascProxy) copyResponse(c *gin.Context, upstream *Upstream, response *http.Response) {
+    defer response.Body.Close()
+
+    header := c.Writer.Header()
+    for key, value := range response.Header {
+        header[key] = value
+    }
+    removeHopHeaders(header)
+
+    c.Status(response.StatusCode)
+    c.Writer.WriteHeaderNow()
+
+    // Flush as data arrives so that streamed responses are not held back
+    buffer := make([]byte, 32 * 1024)
+    for {
+        size, err := response.Body.Read(buffer)
+        if size > 0 {
+            if _, writeErr := c.Writer.Write(buffer[:size]); writeErr != nil {
+                return
+            }
+            c.Writer.Flush()
+        }
+        if err != nil {
+            if err != io.EOF {
+                logger.LogSelector("_gin").ErrorLog("tid[%s] proxy response from %s broken: %v", c.Request.Header.Get("X-Vasc-Request-Tracer"), upstream.URL.Host, err)
+            }
+            return
+        }
+    }
+}
+
+func (this *VascProxy) renderError(c *gin.Context, err error) {
+    var netErr net.Error
+    if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+        verror.Render(c, verror.Timeout(err))
+        return
+    }
+    verror.Render(c, verror.New(http.StatusBadGateway, http.StatusBadGateway, "Bad gateway"))
+}
+
+func removeHopHeaders(header http.Header) {
+    // Headers named by Connection are hop-by-hop as well
+    for _, value := range header.Values("Connection") {
+        for _, name := range strings.Split(value, ",") {
+            header.Del(strings.TrimSpace(name))
+        }
+    }
+    for _, value := range hopHeaders {
+        header.Del(value)
+    }
+}
+
+type countedBody struct {
+    io.ReadCloser
+    upstream   *Upstream
+    closed      int32
+}
+
+func (this *countedBody) Close() error {
+    if atomic.CompareAndSwapInt32(&this.closed, 0, 1) {
+        atomic.AddInt64(&this.upstream.active, -1)
+    }
+    return this.ReadCloser.Close()
+}
@@ -0,0 +1,122 @@
+package proxy
+
+import (
+    "github.com/gin-gonic/gin"
+    "github.com/marxn/vasc/global"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+)
+
+// An upstream answering 502 and recording the bodies it received
+type failingUpstream struct {
+    mutex     sync.Mutex
+    bodies  []string
+}
+
+func (this *failingUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    body, _ := io.ReadAll(r.Body)
+    this.mutex.Lock()
+    this.bodies = append(this.bodies, string(body))
+    this.mutex.Unlock()
+    w.WriteHeader(http.StatusBadGateway)
+}
+
+func serveProxy(t *testing.T, config *global.ProxyConfig, request *http.Request) *httptest.ResponseRecorder {
+    t.Helper()
+    gin.SetMode(gin.TestMode)
+
+    vascProxy, err := New(config, "test")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer vascProxy.Close()
+
+    engine := gin.New()
+    engine.Any("/*path", vascProxy.Handler)
+
+    recorder := httptest.NewRecorder()
+    engine.ServeHTTP(recorder, request)
+    return recorder
+}
+
+func TestRetryResendsBody(t *testing.T) {
+    failing := &failingUpstream{}
+    first := httptest.NewServer(failing)
+    defer first.Close()
+    second := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        _, _ = io.Copy(w, r.Body)
+    }))
+    defer second.Close()
+
+    // Round robin starts with the first upstream
+    config := &global.ProxyConfig{UpstreamList: []string{first.URL, second.URL}, Retries: 1}
+    recorder := serveProxy(t, config, httptest.NewRequest(http.MethodPut, "/items", strings.NewReader("hello")))
+    if recorder.Code != http.StatusOK || recorder.Body.String() != "hello" {
+        t.Fatalf("expected the body to reach the second upstream, got %d %q", recorder.Code, recorder.Body.String())
+    }
+    if len(failing.bodies) != 1 || failing.bodies[0] != "hello" {
+        t.Fatalf("expected the body at the failing upstream, got %q", failing.bodies)
+    }
+}
+
+func TestLargeBodyNotRetried(t *testing.T) {
+    for _, contentLength := range []int64{11, -1} {
+        failing := &failingUpstream{}
+        upstream := httptest.NewServer(failing)
+
+        config := &global.ProxyConfig{UpstreamList: []string{upstream.URL}, Retries: 2, RetryBodyLimit: 4, MaxFails: 10}
+        request := httptest.NewRequest(http.MethodPut, "/items", strings.NewReader("hello world"))
+        request.ContentLength = contentLength
+
+        recorder := serveProxy(t, config, request)
+        upstream.Close()
+
+        if recorder.Code != http.StatusBadGateway {
+            t.Fatalf("expected the upstream status, got %d", recorder.Code)
+        }
+        if len(failing.bodies) != 1 || failing.bodies[0] != "hello world" {
+            t.Fatalf("expected the whole body streamed once, got %q", failing.bodies)
+        }
+    }
+}
+
+func TestSmallBodyRetried(t *testing.T) {
+    failing := &failingUpstream{}
+    upstream := httptest.NewServer(failing)
+    defer upstream.Close()
+
+    config := &global.ProxyConfig{UpstreamList: []string{upstream.URL}, Retries: 2, RetryBodyLimit: 16, MaxFails: 10}
+    serveProxy(t, config, httptest.NewRequest(http.MethodPut, "/items", strings.NewReader("hello world")))
+
+    if len(failing.bodies) != 3 {
+        t.Fatalf("expected 3 attempts, got %d", len(failing.bodies))
+    }
+    for _, value := range failing.bodies {
+        if value != "hello world" {
+            t.Fatalf("unexpected body on retry: %q", value)
+        }
+    }
+}
+
+func TestTargetURL(t *testing.T) {
+    var target string
+    upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        target = r.URL.String()
+    }))
+    defer upstream.Close()
+
+    config := &global.ProxyConfig{
+        UpstreamList: []string{upstream.URL + "/base/"},
+        StripPrefix:  "/api",
+        Rewrite:      []global.ProxyRewriteRule{{From: "^/v1/", To: "/v2/"}},
+    }
+    serveProxy(t, config, httptest.NewRequest(http.MethodGet, "/api/v1/items?page=2", nil))
+
+    if target != "/base/v2/items?page=2" {
+        t.Fatalf("unexpected upstream target %q", target)
+    }
+}
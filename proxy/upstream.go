@@ -0,0 +1,128 @@
+package proxy
+
+import (
+    "errors"
+    "net/url"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+const BalanceRoundRobin = "round_robin"
+const BalanceLeastConn  = "least_conn"
+
+type Upstream struct {
+    URL          *url.URL
+    active        int64
+    fails         int
+    firstFail     time.Time
+    downUntil     time.Time
+    mutex         sync.Mutex
+}
+
+// Passive health checking in the way of nginx: an upstream failing maxFails times
+// within failTimeout is left out for failTimeout.
+type balancer struct {
+    upstreams   []*Upstream
+    leastConn     bool
+    next          uint64
+    maxFails      int
+    failTimeout   time.Duration
+}
+
+func newBalancer(addresses []string, balance string, maxFails int, failTimeout time.Duration) (*balancer, error) {
+    if len(addresses) == 0 {
+        return nil, errors.New("proxy requires at least one upstream")
+    }
+    if balance != "" && balance != BalanceRoundRobin && balance != BalanceLeastConn {
+        return nil, errors.New("invalid proxy balance: " + balance)
+    }
+
+    result := &balancer{
+        leastConn:   balance == BalanceLeastConn,
+        maxFails:    maxFails,
+        failTimeout: failTimeout,
+    }
+
+    for _, value := range addresses {
+        target, err := url.Parse(value)
+        if err != nil {
+            return nil, err
+        }
+        if target.Scheme != "http" && target.Scheme != "https" || target.Host == "" {
+            return nil, errors.New("invalid upstream: " + value)
+        }
+        result.upstreams = append(result.upstreams, &Upstream{URL: target})
+    }
+
+    return result, nil
+}
+
+// Pick an upstream which is healthy and not tried yet. When every upstream is down
+// they are all tried anyway, since refusing is no better than trying.
+func (this *balancer) pick(tried map[*Upstream]bool) *Upstream {
+    now := time.Now()
+
+    candidates := make([]*Upstream, 0, len(this.upstreams))
+    for _, value := range this.upstreams {
+        if !tried[value] && value.available(now) {
+            candidates = append(candidates, value)
+        }
+    }
+    if len(candidates) == 0 {
+        for _, value := range this.upstreams {
+            if !tried[value] {
+                candidates = append(candidates, value)
+            }
+        }
+    }
+    if len(candidates) == 0 {
+        return nil
+    }
+
+    if this.leastConn {
+        result := candidates[0]
+        for _, value := range candidates[1:] {
+            if atomic.LoadInt64(&value.active) < atomic.LoadInt64(&result.active) {
+                result = value
+            }
+        }
+        return result
+    }
+
+    index := atomic.AddUint64(&this.next, 1) - 1
+    return candidates[index % uint64(len(candidates))]
+}
+
+func (this *Upstream) available(now time.Time) bool {
+    this.mutex.Lock()
+    defer this.mutex.Unlock()
+    return !now.Before(this.downUntil)
+}
+
+func (this *balancer) markFailure(upstream *Upstream) {
+    if this.maxFails <= 0 {
+        return
+    }
+
+    upstream.mutex.Lock()
+    defer upstream.mutex.Unlock()
+
+    now := time.Now()
+    if upstream.fails == 0 || now.Sub(upstream.firstFail) > this.failTimeout {
+        upstream.fails     = 0
+        upstream.firstFail = now
+    }
+
+    upstream.fails++
+    if upstream.fails >= this.maxFails {
+        upstream.downUntil = now.Add(this.failTimeout)
+        upstream.fails     = 0
+    }
+}
+
+func (this *balancer) markSuccess(upstream *Upstream) {
+    upstream.mutex.Lock()
+    defer upstream.mutex.Unlock()
+    upstream.fails = 0
+}
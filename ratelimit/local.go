@@ -0,0 +1,153 @@
+package ratelimit
+
+import (
+    "sync"
+    "time"
+)
+
+const sweepInterval = time.Minute
+
+// Generic cell rate algorithm: one request every Emission, with up to Burst requests at once.
+type LocalGCRA struct {
+    Emission     time.Duration
+    Tolerance    time.Duration
+    tat          map[string]time.Time
+    lastSweep    time.Time
+    mutex        sync.Mutex
+}
+
+func NewLocalGCRA(rate int64, period time.Duration, burst int64) *LocalGCRA {
+    emission := period / time.Duration(rate)
+    return &LocalGCRA{
+        Emission:  emission,
+        Tolerance: emission * time.Duration(burst),
+        tat:       make(map[string]time.Time),
+        lastSweep: time.Now(),
+    }
+}
+
+func (this *LocalGCRA) Allow(key string) (bool, time.Duration, error) {
+    now := time.Now()
+
+    this.mutex.Lock()
+    defer this.mutex.Unlock()
+
+    this.sweep(now)
+
+    tat := this.tat[key]
+    if tat.Before(now) {
+        tat = now
+    }
+
+    newTat  := tat.Add(this.Emission)
+    allowAt := newTat.Add(-this.Tolerance)
+    if allowAt.After(now) {
+        return false, allowAt.Sub(now), nil
+    }
+
+    this.tat[key] = newTat
+    return true, 0, nil
+}
+
+func (this *LocalGCRA) sweep(now time.Time) {
+    if now.Sub(this.lastSweep) < sweepInterval {
+        return
+    }
+    this.lastSweep = now
+
+    for key, tat := range this.tat {
+        if tat.Before(now) {
+            delete(this.tat, key)
+        }
+    }
+}
+
+type windowCounter struct {
+    Window       int64
+    Current      int64
+    Previous     int64
+}
+
+// Sliding window approximated by weighting the count of the previous fixed window.
+type LocalSlidingWindow struct {
+    Limit        int64
+    Period       time.Duration
+    counters     map[string]*windowCounter
+    lastSweep    time.Time
+    mutex        sync.Mutex
+}
+
+func NewLocalSlidingWindow(limit int64, period time.Duration) *LocalSlidingWindow {
+    return &LocalSlidingWindow{
+        Limit:     limit,
+        Period:    period,
+        counters:  make(map[string]*windowCounter),
+        lastSweep: time.Now(),
+    }
+}
+
+func (this *LocalSlidingWindow) Allow(key string) (bool, time.Duration, error) {
+    now    := time.Now().UnixNano()
+    period := int64(this.Period)
+    window := now / period
+
+    this.mutex.Lock()
+    defer this.mutex.Unlock()
+
+    this.sweep(window)
+
+    counter := this.counters[key]
+    if counter == nil {
+        counter = &windowCounter{Window: window}
+        this.counters[key] = counter
+    }
+
+    if counter.Window != window {
+        if counter.Window == window - 1 {
+            counter.Previous = counter.Current
+        } else {
+            counter.Previous = 0
+        }
+        counter.Current = 0
+        counter.Window  = window
+    }
+
+    allowed, retryAfter := slidingWindowCheck(counter.Previous, counter.Current, this.Limit, now - window * period, period)
+    if allowed {
+        counter.Current++
+    }
+    return allowed, retryAfter, nil
+}
+
+func (this *LocalSlidingWindow) sweep(window int64) {
+    now := time.Now()
+    if now.Sub(this.lastSweep) < sweepInterval {
+        return
+    }
+    this.lastSweep = now
+
+    for key, counter := range this.counters {
+        if counter.Window < window - 1 {
+            delete(this.counters, key)
+        }
+    }
+}
+
+// Shared by local and redis sliding windows. elapsed and period are in the same unit.
+func slidingWindowCheck(previous int64, current int64, limit int64, elapsed int64, period int64) (bool, time.Duration) {
+    weighted := float64(previous) * float64(period - elapsed) / float64(period) + float64(current)
+    if weighted + 1 <= float64(limit) {
+        return true, 0
+    }
+
+    if current + 1 > limit || previous == 0 {
+        return false, time.Duration(period - elapsed)
+    }
+
+    // Wait until the previous window has faded out enough for one more request
+    wait := float64(period - elapsed) - float64(limit - current - 1) * float64(period) / float64(previous)
+    if wait < 0 {
+        wait = 0
+    }
+    return false, time.Duration(wait)
+}
@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+    "testing"
+    "time"
+)
+
+func TestLocalGCRABurst(t *testing.T) {
+    limiter := NewLocalGCRA(10, time.Second, 3)
+
+    for i := 0; i < 3; i++ {
+        if allowed, _, _ := limiter.Allow("a"); !allowed {
+            t.Fatalf("request %d of the burst was rejected", i + 1)
+        }
+    }
+
+    allowed, retryAfter, _ := limiter.Allow("a")
+    if allowed {
+        t.Fatal("request over the burst was allowed")
+    }
+    if retryAfter <= 0 || retryAfter > 100 * time.Millisecond {
+        t.Fatalf("expected to retry within one emission interval, got %v", retryAfter)
+    }
+
+    if allowed, _, _ := limiter.Allow("b"); !allowed {
+        t.Fatal("another key shares the bucket")
+    }
+}
+
+func TestLocalGCRARecovers(t *testing.T) {
+    limiter := NewLocalGCRA(100, time.Second, 1)
+
+    if allowed, _, _ := limiter.Allow("a"); !allowed {
+        t.Fatal("first request rejected")
+    }
+    if allowed, _, _ := limiter.Allow("a"); allowed {
+        t.Fatal("second request allowed at once")
+    }
+
+    time.Sleep(15 * time.Millisecond)
+    if allowed, _, _ := limiter.Allow("a"); !allowed {
+        t.Fatal("request rejected after the emission interval")
+    }
+}
+
+func TestLocalSlidingWindow(t *testing.T) {
+    limiter := NewLocalSlidingWindow(3, time.Hour)
+
+    for i := 0; i < 3; i++ {
+        if allowed, _, _ := limiter.Allow("a"); !allowed {
+            t.Fatalf("request %d under the limit was rejected", i + 1)
+        }
+    }
+    if allowed, retryAfter, _ := limiter.Allow("a"); allowed || retryAfter <= 0 {
+        t.Fatalf("request over the limit: allowed %v, retry after %v", allowed, retryAfter)
+    }
+}
+
+func TestSlidingWindowCheck(t *testing.T) {
+    period := int64(time.Second)
+
+    cases := []struct {
+        previous, current, limit, elapsed int64
+        allowed                           bool
+        retryAfter                        time.Duration
+    }{
+        {0, 0, 10, 0, true, 0},
+        {10, 0, 10, period / 2, true, 0},
+        {10, 5, 10, period / 2, false, 100 * time.Millisecond},
+        {0, 10, 10, period / 4, false, 750 * time.Millisecond},
+    }
+
+    for _, value := range cases {
+        allowed, retryAfter := slidingWindowCheck(value.previous, value.current, value.limit, value.elapsed, period)
+        if allowed != value.allowed || retryAfter != value.retryAfter {
+            t.Errorf("%+v: got allowed %v, retry after %v", value, allowed, retryAfter)
+        }
+    }
+}
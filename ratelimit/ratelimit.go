@@ -0,0 +1,138 @@
+/*
+ * Request rate limiting for webserver routes.
+ * Limits are kept in process memory, or in redis when they must hold across the cluster.
+ */
+
+package ratelimit
+
+import (
+    "errors"
+    "fmt"
+    "github.com/gin-gonic/gin"
+    "github.com/marxn/vasc/auth"
+    "github.com/marxn/vasc/global"
+    "github.com/marxn/vasc/logger"
+    vmiddleware "github.com/marxn/vasc/middleware"
+    "github.com/marxn/vasc/portal"
+    vredis "github.com/marxn/vasc/redis"
+    "github.com/marxn/vasc/verror"
+    "math"
+    "net/http"
+    "strings"
+    "time"
+)
+
+const ModeLocal = "local"
+const ModeRedis = "redis"
+
+const AlgorithmGCRA          = "gcra"
+const AlgorithmSlidingWindow = "sliding_window"
+
+type Limiter interface {
+    // Take one request for key. When it is rejected, retryAfter tells when the next one may pass.
+    Allow(key string) (allowed bool, retryAfter time.Duration, err error)
+}
+
+func NewLimiter(config *global.RateLimitConfig, redisPoolList *vredis.VascRedis, keyPrefix string) (Limiter, error) {
+    if config.Rate <= 0 {
+        return nil, errors.New("rate limit requires a positive rate")
+    }
+
+    period := time.Duration(config.Period) * time.Second
+    if period <= 0 {
+        period = time.Second
+    }
+
+    burst := config.Burst
+    if burst <= 0 {
+        burst = config.Rate
+    }
+
+    algorithm := config.Algorithm
+    if algorithm == "" {
+        algorithm = AlgorithmGCRA
+    }
+    if algorithm != AlgorithmGCRA && algorithm != AlgorithmSlidingWindow {
+        return nil, errors.New("invalid rate limit algorithm: " + algorithm)
+    }
+
+    switch config.Mode {
+        case "", ModeLocal:
+            if algorithm == AlgorithmGCRA {
+                return NewLocalGCRA(config.Rate, period, burst), nil
+            }
+            return NewLocalSlidingWindow(config.Rate, period), nil
+        case ModeRedis:
+            if redisPoolList == nil || redisPoolList.Get(config.Redis) == nil {
+                return nil, errors.New("cannot get redis instance for rate limit: " + config.Redis)
+            }
+            pool := redisPoolList.Get(config.Redis)
+            if algorithm == AlgorithmGCRA {
+                return &RedisGCRA{RedisConn: pool, RedisPrefix: keyPrefix, Emission: period / time.Duration(config.Rate), Burst: burst}, nil
+            }
+            return &RedisSlidingWindow{RedisConn: pool, RedisPrefix: keyPrefix, Limit: config.Rate, Period: period}, nil
+        default:
+            return nil, errors.New("invalid rate limit mode: " + config.Mode)
+    }
+}
+
+// Built-in key extractors: "ip" (default), "api_key", or "header:<Name>".
+// The client address is that resolved by the real_ip middleware, forwarding headers are not
+// trusted otherwise. Requests without an API key or header are limited by their address.
+func KeyExtractor(keyBy string) (func(*gin.Context) string, error) {
+    switch {
+        case keyBy == "" || keyBy == "ip":
+            return clientKey, nil
+        case keyBy == "api_key":
+            return func(c *gin.Context) string {
+                // Prefer the verified identity when the route is authenticated
+                if identity := portal.GinIdentity(c); identity != nil && identity.Subject != "" {
+                    return "sub:" + identity.Subject
+                }
+                // The key is a secret: keep it out of redis key names and memory
+                if key := c.Request.Header.Get("X-Api-Key"); key != "" {
+                    return "key:" + auth.HashAPIKey(key)
+                }
+                return clientKey(c)
+            }, nil
+        case strings.HasPrefix(keyBy, "header:"):
+            headerName := keyBy[len("header:"):]
+            return func(c *gin.Context) string {
+                if value := c.Request.Header.Get(headerName); value != "" {
+                    return "header:" + value
+                }
+                return clientKey(c)
+            }, nil
+        default:
+            return nil, errors.New("invalid rate limit key: " + keyBy)
+    }
+}
+
+func clientKey(c *gin.Context) string {
+    return "ip:" + vmiddleware.RealIP(c)
+}
+
+// Reject requests over the limit with 429 and Retry-After.
+// Requests are let through when the limiter itself fails.
+func Middleware(limiter Limiter, extractor func(*gin.Context) string, name string) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        allowed, retryAfter, err := limiter.Allow(extractor(c))
+        if err != nil {
+            logger.LogSelector("_gin").ErrorLog("tid[%s] rate limit %s failed: %v", c.Request.Header.Get("X-Vasc-Request-Tracer"), name, err)
+            c.Next()
+            return
+        }
+
+        if !allowed {
+            seconds := int64(math.Ceil(retryAfter.Seconds()))
+            if seconds < 1 {
+                seconds = 1
+            }
+            c.Header("Retry-After", fmt.Sprintf("%d", seconds))
+            verror.Render(c, verror.New(http.StatusTooManyRequests, http.StatusTooManyRequests, "Too many requests"))
+            return
+        }
+
+        c.Next()
+    }
+}
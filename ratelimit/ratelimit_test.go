@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+    "github.com/gin-gonic/gin"
+    "github.com/marxn/vasc/global"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func requestContext(remoteAddr string, header map[string]string) *gin.Context {
+    c, _ := gin.CreateTestContext(httptest.NewRecorder())
+    c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+    c.Request.RemoteAddr = remoteAddr
+    for key, value := range header {
+        c.Request.Header.Set(key, value)
+    }
+    return c
+}
+
+func TestIPKeyIgnoresForwardedFor(t *testing.T) {
+    extractor, _ := KeyExtractor("ip")
+
+    first  := extractor(requestContext("10.0.0.1:1234", map[string]string{"X-Forwarded-For": "1.1.1.1"}))
+    second := extractor(requestContext("10.0.0.1:1234", map[string]string{"X-Forwarded-For": "2.2.2.2"}))
+    if first != second || first != "ip:10.0.0.1" {
+        t.Fatalf("forwarding header changed the key: %q, %q", first, second)
+    }
+}
+
+func TestAPIKeyIsHashed(t *testing.T) {
+    extractor, _ := KeyExtractor("api_key")
+
+    key := extractor(requestContext("10.0.0.1:1234", map[string]string{"X-Api-Key": "secret-key"}))
+    if strings.Contains(key, "secret-key") || !strings.HasPrefix(key, "key:") {
+        t.Fatalf("raw api key in bucket key %q", key)
+    }
+}
+
+func TestMissingKeyFallsBackToAddress(t *testing.T) {
+    for _, keyBy := range []string{"api_key", "header:X-Client"} {
+        extractor, _ := KeyExtractor(keyBy)
+
+        first  := extractor(requestContext("10.0.0.1:1234", nil))
+        second := extractor(requestContext("10.0.0.2:1234", nil))
+        if first == second {
+            t.Fatalf("%s: callers without a key share bucket %q", keyBy, first)
+        }
+    }
+}
+
+func TestInvalidKeyExtractor(t *testing.T) {
+    if _, err := KeyExtractor("cookie"); err == nil {
+        t.Fatal("expected an error for an unknown key")
+    }
+}
+
+func TestMiddlewareRejectsWithRetryAfter(t *testing.T) {
+    limiter, err := NewLimiter(&global.RateLimitConfig{Rate: 1, Period: 60}, nil, "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    extractor, _ := KeyExtractor("ip")
+
+    gin.SetMode(gin.TestMode)
+    engine := gin.New()
+    engine.GET("/", Middleware(limiter, extractor, "test"), func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+    codes := make([]int, 0, 2)
+    var recorder *httptest.ResponseRecorder
+    for i := 0; i < 2; i++ {
+        recorder = httptest.NewRecorder()
+        request := httptest.NewRequest(http.MethodGet, "/", nil)
+        request.RemoteAddr = "10.0.0.1:1234"
+        engine.ServeHTTP(recorder, request)
+        codes = append(codes, recorder.Code)
+    }
+
+    if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+        t.Fatalf("unexpected status codes %v", codes)
+    }
+    if retryAfter := recorder.Header().Get("Retry-After"); retryAfter == "" || retryAfter == "0" {
+        t.Fatalf("missing Retry-After, got %q", retryAfter)
+    }
+}
+
+func TestNewLimiterValidation(t *testing.T) {
+    if _, err := NewLimiter(&global.RateLimitConfig{}, nil, ""); err == nil {
+        t.Fatal("expected an error without a rate")
+    }
+    if _, err := NewLimiter(&global.RateLimitConfig{Rate: 1, Algorithm: "leaky"}, nil, ""); err == nil {
+        t.Fatal("expected an error for an unknown algorithm")
+    }
+    if _, err := NewLimiter(&global.RateLimitConfig{Rate: 1, Mode: ModeRedis, Redis: "r"}, nil, ""); err == nil {
+        t.Fatal("expected an error without redis")
+    }
+}
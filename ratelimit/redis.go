@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+    "errors"
+    "fmt"
+    "github.com/garyburd/redigo/redis"
+    "time"
+)
+
+// Times are taken from the redis server so that all nodes share the same clock.
+var gcraScript = redis.NewScript(1, `
+redis.replicate_commands()
+local emission  = tonumber(ARGV[1])
+local tolerance = tonumber(ARGV[2])
+local now_time  = redis.call("TIME")
+local now = tonumber(now_time[1]) * 1000000 + tonumber(now_time[2])
+local tat = tonumber(redis.call("GET", KEYS[1]))
+if tat == nil or tat < now then
+    tat = now
+end
+local new_tat  = tat + emission
+local allow_at = new_tat - tolerance
+if allow_at > now then
+    return {0, allow_at - now}
+end
+redis.call("SET", KEYS[1], new_tat, "PX", math.ceil((new_tat - now) / 1000))
+return {1, 0}
+`)
+
+var slidingWindowScript = redis.NewScript(2, `
+local current  = tonumber(redis.call("GET", KEYS[1]) or "0")
+local previous = tonumber(redis.call("GET", KEYS[2]) or "0")
+local weighted = previous * tonumber(ARGV[3]) / tonumber(ARGV[4]) + current
+if weighted + 1 > tonumber(ARGV[1]) then
+    return {0, current, previous}
+end
+redis.call("INCR", KEYS[1])
+redis.call("PEXPIRE", KEYS[1], tonumber(ARGV[2]))
+return {1, current, previous}
+`)
+
+type RedisGCRA struct {
+    RedisConn      *redis.Pool
+    RedisPrefix     string
+    Emission        time.Duration
+    Burst           int64
+}
+
+func (this *RedisGCRA) Allow(key string) (bool, time.Duration, error) {
+    redisConn := this.RedisConn.Get()
+    if redisConn == nil {
+        return false, 0, errors.New("cannot get redis connection for rate limit")
+    }
+    defer redisConn.Close()
+
+    emission := int64(this.Emission / time.Microsecond)
+    result, err := redis.Int64s(gcraScript.Do(redisConn, this.RedisPrefix + key, emission, emission * this.Burst))
+    if err != nil {
+        return false, 0, err
+    }
+    if len(result) != 2 {
+        return false, 0, errors.New("invalid rate limit result")
+    }
+
+    return result[0] == 1, time.Duration(result[1]) * time.Microsecond, nil
+}
+
+type RedisSlidingWindow struct {
+    RedisConn      *redis.Pool
+    RedisPrefix     string
+    Limit           int64
+    Period          time.Duration
+}
+
+func (this *RedisSlidingWindow) Allow(key string) (bool, time.Duration, error) {
+    redisConn := this.RedisConn.Get()
+    if redisConn == nil {
+        return false, 0, errors.New("cannot get redis connection for rate limit")
+    }
+    defer redisConn.Close()
+
+    now     := time.Now().UnixNano()
+    period  := int64(this.Period)
+    window  := now / period
+    elapsed := now - window * period
+
+    currentKey  := fmt.Sprintf("%s%s:%d", this.RedisPrefix, key, window)
+    previousKey := fmt.Sprintf("%s%s:%d", this.RedisPrefix, key, window - 1)
+
+    result, err := redis.Int64s(slidingWindowScript.Do(redisConn, currentKey, previousKey,
+        this.Limit, int64(this.Period / time.Millisecond) * 2, period - elapsed, period))
+    if err != nil {
+        return false, 0, err
+    }
+    if len(result) != 3 {
+        return false, 0, errors.New("invalid rate limit result")
+    }
+
+    if result[0] == 1 {
+        return true, 0, nil
+    }
+
+    _, retryAfter := slidingWindowCheck(result[2], result[1], this.Limit, elapsed, period)
+    return false, retryAfter, nil
+}
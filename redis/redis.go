@@ -1,8 +1,11 @@
 package redis
 
 import (
+    "context"
+    "errors"
     "github.com/garyburd/redigo/redis"
     "github.com/marxn/vasc/global"
+    "github.com/marxn/vasc/tracing"
     "time"
 )
 
@@ -51,6 +54,22 @@ func (this *VascRedis) Get(key string) *redis.Pool {
     return nil
 }
 
+// Take a connection of instance key whose commands are traced as part of ctx.
+// The caller closes it as with Get(key).Get().
+func (this *VascRedis) GetConn(ctx context.Context, key string) (redis.Conn, error) {
+    pool := this.Get(key)
+    if pool == nil {
+        return nil, errors.New("cannot find redis instance: " + key)
+    }
+    
+    conn := pool.Get()
+    if err := conn.Err(); err != nil {
+        conn.Close()
+        return nil, err
+    }
+    return tracing.RedisConn(ctx, conn, key), nil
+}
+
 func (this *VascRedis) Close() {
     this.Runnable = false
     for _, value := range this.RedisPool {
@@ -0,0 +1,139 @@
+/*
+ * Building blocks protecting a service from the failures of what it depends on.
+ */
+
+package resilience
+
+import (
+    "errors"
+    "github.com/marxn/vasc/global"
+    "sync"
+    "time"
+)
+
+var ErrOpen = errors.New("circuit breaker is open")
+
+type State int
+
+const (
+    StateClosed   State = iota
+    StateOpen
+    StateHalfOpen
+)
+
+func (this State) String() string {
+    switch this {
+        case StateClosed:
+            return "closed"
+        case StateOpen:
+            return "open"
+        default:
+            return "half-open"
+    }
+}
+
+// Stops calls to a dependency after consecutive failures. Once open, it lets a few trial calls
+// through after a while and closes again if they succeed.
+type CircuitBreaker struct {
+    Name                string
+    failureThreshold    int
+    openTimeout         time.Duration
+    halfOpenRequests    int
+    mutex               sync.Mutex
+    state               State
+    failures            int
+    openedAt            time.Time
+    trials              int
+}
+
+// A nil config means all defaults: open after 5 failures, try again after 30 seconds with one call.
+func NewCircuitBreaker(name string, config *global.CircuitBreakerConfig) *CircuitBreaker {
+    result := &CircuitBreaker{
+        Name:             name,
+        failureThreshold: 5,
+        openTimeout:      30 * time.Second,
+        halfOpenRequests: 1,
+    }
+
+    if config != nil {
+        if config.FailureThreshold > 0 {
+            result.failureThreshold = config.FailureThreshold
+        }
+        if config.OpenTimeout > 0 {
+            result.openTimeout = time.Duration(config.OpenTimeout) * time.Second
+        }
+        if config.HalfOpenRequests > 0 {
+            result.halfOpenRequests = config.HalfOpenRequests
+        }
+    }
+    return result
+}
+
+// Ask for permission to make a call. Every permitted call must be followed by Report.
+func (this *CircuitBreaker) Allow() error {
+    this.mutex.Lock()
+    defer this.mutex.Unlock()
+
+    if this.state == StateOpen {
+        if time.Since(this.openedAt) < this.openTimeout {
+            return ErrOpen
+        }
+        this.state  = StateHalfOpen
+        this.trials = 0
+    }
+
+    if this.state == StateHalfOpen {
+        if this.trials >= this.halfOpenRequests {
+            return ErrOpen
+        }
+        this.trials++
+    }
+    return nil
+}
+
+// Record the outcome of a call permitted by Allow.
+func (this *CircuitBreaker) Report(success bool) {
+    this.mutex.Lock()
+    defer this.mutex.Unlock()
+
+    switch {
+        case success && this.state == StateHalfOpen:
+            this.state    = StateClosed
+            this.failures = 0
+        case success:
+            this.failures = 0
+        case this.state == StateHalfOpen:
+            this.open()
+        default:
+            this.failures++
+            if this.state == StateClosed && this.failures >= this.failureThreshold {
+                this.open()
+            }
+    }
+}
+
+// Give back a permission whose call tells nothing about the dependency, e.g. cancelled by the caller.
+func (this *CircuitBreaker) Discard() {
+    this.mutex.Lock()
+    defer this.mutex.Unlock()
+
+    if this.state == StateHalfOpen && this.trials > 0 {
+        this.trials--
+    }
+}
+
+func (this *CircuitBreaker) open() {
+    this.state    = StateOpen
+    this.openedAt = time.Now()
+    this.failures = 0
+}
+
+func (this *CircuitBreaker) State() State {
+    this.mutex.Lock()
+    defer this.mutex.Unlock()
+
+    if this.state == StateOpen && time.Since(this.openedAt) >= this.openTimeout {
+        return StateHalfOpen
+    }
+    return this.state
+}
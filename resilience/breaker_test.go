@@ -0,0 +1,89 @@
+package resilience
+
+import (
+    "github.com/marxn/vasc/global"
+    "testing"
+    "time"
+)
+
+func failTimes(breaker *CircuitBreaker, count int) {
+    for i := 0; i < count; i++ {
+        if breaker.Allow() == nil {
+            breaker.Report(false)
+        }
+    }
+}
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+    breaker := NewCircuitBreaker("test", &global.CircuitBreakerConfig{FailureThreshold: 3})
+
+    failTimes(breaker, 2)
+    if err := breaker.Allow(); err != nil {
+        t.Fatalf("expected the breaker to stay closed, got %v", err)
+    }
+    // A success in between starts the count over
+    breaker.Report(true)
+    failTimes(breaker, 2)
+    if breaker.State() != StateClosed {
+        t.Fatalf("expected closed, got %s", breaker.State())
+    }
+
+    failTimes(breaker, 1)
+    if breaker.State() != StateOpen || breaker.Allow() != ErrOpen {
+        t.Fatalf("expected the breaker to open, got %s", breaker.State())
+    }
+}
+
+func TestBreakerHalfOpenTrials(t *testing.T) {
+    breaker := NewCircuitBreaker("test", &global.CircuitBreakerConfig{FailureThreshold: 1, HalfOpenRequests: 2})
+    breaker.openTimeout = 10 * time.Millisecond
+
+    failTimes(breaker, 1)
+    time.Sleep(20 * time.Millisecond)
+    if breaker.State() != StateHalfOpen {
+        t.Fatalf("expected half-open after the timeout, got %s", breaker.State())
+    }
+
+    if breaker.Allow() != nil || breaker.Allow() != nil {
+        t.Fatal("expected two trial calls")
+    }
+    if breaker.Allow() != ErrOpen {
+        t.Fatal("expected no more than two trial calls")
+    }
+
+    // A discarded trial gives its permission back
+    breaker.Discard()
+    if breaker.Allow() != nil {
+        t.Fatal("expected the discarded trial to be available again")
+    }
+
+    breaker.Report(true)
+    if breaker.State() != StateClosed {
+        t.Fatalf("expected a successful trial to close the breaker, got %s", breaker.State())
+    }
+}
+
+func TestBreakerFailedTrialOpensAgain(t *testing.T) {
+    breaker := NewCircuitBreaker("test", &global.CircuitBreakerConfig{FailureThreshold: 1})
+    breaker.openTimeout = 10 * time.Millisecond
+
+    failTimes(breaker, 1)
+    time.Sleep(20 * time.Millisecond)
+    if breaker.Allow() != nil {
+        t.Fatal("expected a trial call")
+    }
+    breaker.Report(false)
+    if breaker.State() != StateOpen || breaker.Allow() != ErrOpen {
+        t.Fatalf("expected the breaker to open again, got %s", breaker.State())
+    }
+}
+
+func TestBreakerDefaults(t *testing.T) {
+    breaker := NewCircuitBreaker("test", nil)
+    if breaker.failureThreshold != 5 || breaker.openTimeout != 30 * time.Second || breaker.halfOpenRequests != 1 {
+        t.Fatalf("unexpected defaults: %d %s %d", breaker.failureThreshold, breaker.openTimeout, breaker.halfOpenRequests)
+    }
+    if StateClosed.String() != "closed" || StateOpen.String() != "open" || StateHalfOpen.String() != "half-open" {
+        t.Fatal("unexpected state names")
+    }
+}
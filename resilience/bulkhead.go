@@ -0,0 +1,63 @@
+package resilience
+
+import (
+    "context"
+    "errors"
+    "time"
+)
+
+var ErrBulkheadFull = errors.New("bulkhead is full")
+
+// Limits the calls in flight to a dependency so that a slow one cannot take every goroutine
+// of the service with it.
+type Bulkhead struct {
+    Name                string
+    slots               chan struct{}
+    maxWait             time.Duration
+}
+
+// maxWait is how long a call may wait for a slot. Zero means it fails at once when all slots are taken.
+func NewBulkhead(name string, maxConcurrent int, maxWait time.Duration) *Bulkhead {
+    return &Bulkhead{
+        Name:    name,
+        slots:   make(chan struct{}, maxConcurrent),
+        maxWait: maxWait,
+    }
+}
+
+// Take a slot, to be given back with Release.
+func (this *Bulkhead) Acquire(ctx context.Context) error {
+    select {
+        case this.slots <- struct{}{}:
+            return nil
+        default:
+    }
+
+    if this.maxWait <= 0 {
+        return ErrBulkheadFull
+    }
+
+    timer := time.NewTimer(this.maxWait)
+    defer timer.Stop()
+
+    select {
+        case this.slots <- struct{}{}:
+            return nil
+        case <-timer.C:
+            return ErrBulkheadFull
+        case <-ctx.Done():
+            return ctx.Err()
+    }
+}
+
+func (this *Bulkhead) Release() {
+    <-this.slots
+}
+
+func (this *Bulkhead) InUse() int {
+    return len(this.slots)
+}
+
+func (this *Bulkhead) MaxConcurrent() int {
+    return cap(this.slots)
+}
@@ -0,0 +1,58 @@
+package resilience
+
+import (
+    "context"
+    "testing"
+    "time"
+)
+
+func TestBulkheadLimitsConcurrency(t *testing.T) {
+    bulkhead := NewBulkhead("test", 2, 0)
+    ctx := context.Background()
+
+    if bulkhead.Acquire(ctx) != nil || bulkhead.Acquire(ctx) != nil {
+        t.Fatal("expected two slots")
+    }
+    if err := bulkhead.Acquire(ctx); err != ErrBulkheadFull {
+        t.Fatalf("expected the bulkhead to be full, got %v", err)
+    }
+    if bulkhead.InUse() != 2 || bulkhead.MaxConcurrent() != 2 {
+        t.Fatalf("unexpected usage %d/%d", bulkhead.InUse(), bulkhead.MaxConcurrent())
+    }
+
+    bulkhead.Release()
+    if err := bulkhead.Acquire(ctx); err != nil {
+        t.Fatalf("expected the released slot, got %v", err)
+    }
+}
+
+func TestBulkheadWaitsForSlot(t *testing.T) {
+    bulkhead := NewBulkhead("test", 1, time.Second)
+    ctx := context.Background()
+    _ = bulkhead.Acquire(ctx)
+
+    go func() {
+        time.Sleep(20 * time.Millisecond)
+        bulkhead.Release()
+    }()
+    if err := bulkhead.Acquire(ctx); err != nil {
+        t.Fatalf("expected to get the slot once released, got %v", err)
+    }
+}
+
+func TestBulkheadWaitEnds(t *testing.T) {
+    bulkhead := NewBulkhead("test", 1, 20 * time.Millisecond)
+    _ = bulkhead.Acquire(context.Background())
+
+    if err := bulkhead.Acquire(context.Background()); err != ErrBulkheadFull {
+        t.Fatalf("expected the wait to time out, got %v", err)
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    bulkhead = NewBulkhead("test", 1, time.Second)
+    _ = bulkhead.Acquire(context.Background())
+    if err := bulkhead.Acquire(ctx); err != context.Canceled {
+        t.Fatalf("expected the cancelled context, got %v", err)
+    }
+}
@@ -0,0 +1,145 @@
+package resilience
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "github.com/marxn/vasc/global"
+    "time"
+)
+
+// A named combination of bulkhead, circuit breaker and timeout guarding calls to one dependency.
+// Each part is optional: no bulkhead without max_concurrent, no timeout without timeout.
+type Policy struct {
+    Name                string
+    Config             *global.ResiliencePolicyConfig
+    Breaker            *CircuitBreaker
+    Bulkhead           *Bulkhead
+    timeout             time.Duration
+}
+
+type VascResilience struct {
+    ProjectName         string
+    Config             *global.ResilienceConfig
+    policies            map[string]*Policy
+}
+
+// State of a policy as shown by the health endpoint.
+type PolicyStatus struct {
+    CircuitBreaker      string    `json:"circuit_breaker,omitempty"`
+    InUse               int       `json:"in_use"`
+    MaxConcurrent       int       `json:"max_concurrent,omitempty"`
+}
+
+// timeout and max_wait are in milliseconds.
+func (this *VascResilience) LoadConfig(config *global.ResilienceConfig, projectName string) error {
+    this.ProjectName = projectName
+    this.Config      = config
+    this.policies    = make(map[string]*Policy)
+
+    for index := range config.PolicyList {
+        value := &config.PolicyList[index]
+        if value.Name == "" {
+            return errors.New("empty resilience policy name")
+        }
+        if this.policies[value.Name] != nil {
+            return errors.New("duplicated resilience policy: " + value.Name)
+        }
+        this.policies[value.Name] = NewPolicy(value)
+    }
+
+    return nil
+}
+
+func NewPolicy(config *global.ResiliencePolicyConfig) *Policy {
+    result := &Policy{
+        Name:    config.Name,
+        Config:  config,
+        timeout: time.Duration(config.Timeout) * time.Millisecond,
+    }
+    if config.CircuitBreaker != nil {
+        result.Breaker = NewCircuitBreaker(config.Name, config.CircuitBreaker)
+    }
+    if config.MaxConcurrent > 0 {
+        result.Bulkhead = NewBulkhead(config.Name, config.MaxConcurrent, time.Duration(config.MaxWait) * time.Millisecond)
+    }
+    return result
+}
+
+func (this *VascResilience) Policy(name string) (*Policy, error) {
+    result := this.policies[name]
+    if result == nil {
+        return nil, errors.New("unknown resilience policy: " + name)
+    }
+    return result, nil
+}
+
+func (this *VascResilience) Status() map[string]PolicyStatus {
+    result := make(map[string]PolicyStatus)
+    for name, value := range this.policies {
+        result[name] = value.Status()
+    }
+    return result
+}
+
+func (this *Policy) Status() PolicyStatus {
+    var result PolicyStatus
+    if this.Breaker != nil {
+        result.CircuitBreaker = this.Breaker.State().String()
+    }
+    if this.Bulkhead != nil {
+        result.InUse         = this.Bulkhead.InUse()
+        result.MaxConcurrent = this.Bulkhead.MaxConcurrent()
+    }
+    return result
+}
+
+// Run fn under the policy. Any error of fn counts as a failure of the dependency, except when ctx
+// itself is done. The bulkhead slot is held until fn returns, even after a timeout.
+func (this *Policy) Execute(ctx context.Context, fn func(context.Context) error) error {
+    var release func()
+    if this.Bulkhead != nil {
+        if err := this.Bulkhead.Acquire(ctx); err != nil {
+            return fmt.Errorf("%s: %w", this.Name, err)
+        }
+        release = this.Bulkhead.Release
+    }
+
+    if this.Breaker != nil {
+        if err := this.Breaker.Allow(); err != nil {
+            if release != nil {
+                release()
+            }
+            return fmt.Errorf("%s: %w", this.Name, err)
+        }
+    }
+
+    // A panic of fn is a failure as well
+    finished := false
+    if this.Breaker != nil {
+        defer func() {
+            if !finished {
+                this.Breaker.Report(false)
+            }
+        }()
+    }
+
+    err := runWithTimeout(ctx, this.timeout, fn, release)
+    finished = true
+
+    if this.Breaker != nil {
+        switch {
+            case err == nil:
+                this.Breaker.Report(true)
+            case ctx.Err() != nil:
+                this.Breaker.Discard()
+            default:
+                this.Breaker.Report(false)
+        }
+    }
+
+    if errors.Is(err, ErrTimeout) {
+        return fmt.Errorf("%s: %w", this.Name, err)
+    }
+    return err
+}
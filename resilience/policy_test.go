@@ -0,0 +1,135 @@
+package resilience
+
+import (
+    "context"
+    "errors"
+    "github.com/marxn/vasc/global"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestWithTimeout(t *testing.T) {
+    err := WithTimeout(context.Background(), 20 * time.Millisecond, func(ctx context.Context) error {
+        // Ignores its context, the caller must not wait for it
+        time.Sleep(200 * time.Millisecond)
+        return nil
+    })
+    if err != ErrTimeout {
+        t.Fatalf("expected a timeout, got %v", err)
+    }
+
+    failure := errors.New("failure")
+    if err := WithTimeout(context.Background(), time.Second, func(ctx context.Context) error { return failure }); err != failure {
+        t.Fatalf("expected the error of fn, got %v", err)
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    err = WithTimeout(ctx, time.Second, func(ctx context.Context) error {
+        <-ctx.Done()
+        return ctx.Err()
+    })
+    if err != context.Canceled {
+        t.Fatalf("expected the cancellation of the caller, got %v", err)
+    }
+}
+
+func TestWithTimeoutRaisesPanic(t *testing.T) {
+    defer func() {
+        if r := recover(); r == nil || !strings.Contains(r.(string), "boom") {
+            t.Fatalf("expected the panic of fn, got %v", r)
+        }
+    }()
+    _ = WithTimeout(context.Background(), time.Second, func(ctx context.Context) error {
+        panic("boom")
+    })
+}
+
+func TestPolicyOpensBreaker(t *testing.T) {
+    policy  := NewPolicy(&global.ResiliencePolicyConfig{Name: "test", CircuitBreaker: &global.CircuitBreakerConfig{FailureThreshold: 2}})
+    failure := errors.New("failure")
+
+    for i := 0; i < 2; i++ {
+        if err := policy.Execute(context.Background(), func(ctx context.Context) error { return failure }); err != failure {
+            t.Fatalf("expected the error of fn, got %v", err)
+        }
+    }
+
+    called := false
+    err := policy.Execute(context.Background(), func(ctx context.Context) error {
+        called = true
+        return nil
+    })
+    if !errors.Is(err, ErrOpen) || called {
+        t.Fatalf("expected the open breaker to stop the call, got %v", err)
+    }
+    if status := policy.Status(); status.CircuitBreaker != "open" {
+        t.Fatalf("unexpected status %+v", status)
+    }
+}
+
+func TestPolicyTimeoutHoldsSlot(t *testing.T) {
+    policy := NewPolicy(&global.ResiliencePolicyConfig{Name: "test", Timeout: 20, MaxConcurrent: 1})
+    release := make(chan struct{})
+
+    err := policy.Execute(context.Background(), func(ctx context.Context) error {
+        <-release
+        return nil
+    })
+    if !errors.Is(err, ErrTimeout) {
+        t.Fatalf("expected a timeout, got %v", err)
+    }
+
+    // The abandoned call still runs and keeps its slot
+    if err := policy.Execute(context.Background(), func(ctx context.Context) error { return nil }); !errors.Is(err, ErrBulkheadFull) {
+        t.Fatalf("expected the bulkhead to be full, got %v", err)
+    }
+
+    close(release)
+    deadline := time.Now().Add(time.Second)
+    for policy.Bulkhead.InUse() > 0 && time.Now().Before(deadline) {
+        time.Sleep(5 * time.Millisecond)
+    }
+    if err := policy.Execute(context.Background(), func(ctx context.Context) error { return nil }); err != nil {
+        t.Fatalf("expected the slot to be released, got %v", err)
+    }
+}
+
+func TestPolicyPanicCountsAsFailure(t *testing.T) {
+    policy := NewPolicy(&global.ResiliencePolicyConfig{Name: "test", MaxConcurrent: 1, CircuitBreaker: &global.CircuitBreakerConfig{FailureThreshold: 1}})
+
+    func() {
+        defer func() { _ = recover() }()
+        _ = policy.Execute(context.Background(), func(ctx context.Context) error { panic("boom") })
+    }()
+
+    if policy.Breaker.State() != StateOpen {
+        t.Fatalf("expected the panic to open the breaker, got %s", policy.Breaker.State())
+    }
+    if policy.Bulkhead.InUse() != 0 {
+        t.Fatal("expected the slot to be released after the panic")
+    }
+}
+
+func TestLoadPolicies(t *testing.T) {
+    value := new(VascResilience)
+    config := &global.ResilienceConfig{PolicyList: []global.ResiliencePolicyConfig{{Name: "a", MaxConcurrent: 3}}}
+    if err := value.LoadConfig(config, "test"); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := value.Policy("a"); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := value.Policy("b"); err == nil {
+        t.Fatal("expected an error for an unknown policy")
+    }
+    if status := value.Status()["a"]; status.MaxConcurrent != 3 {
+        t.Fatalf("unexpected status %+v", status)
+    }
+
+    duplicated := &global.ResilienceConfig{PolicyList: []global.ResiliencePolicyConfig{{Name: "a"}, {Name: "a"}}}
+    if err := new(VascResilience).LoadConfig(duplicated, "test"); err == nil {
+        t.Fatal("expected an error for a duplicated policy")
+    }
+}
@@ -0,0 +1,75 @@
+package resilience
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "github.com/marxn/vasc/logger"
+    "runtime/debug"
+    "time"
+)
+
+var ErrTimeout = errors.New("call timed out")
+
+// Run fn with a context ending after timeout and give up waiting for it at that point, even if
+// fn does not watch its context, e.g. a call blocked on a dead connection. fn then goes on in the
+// background and its result is dropped. A panic of fn is raised again in the caller.
+func WithTimeout(ctx context.Context, timeout time.Duration, fn func(context.Context) error) error {
+    return runWithTimeout(ctx, timeout, fn, nil)
+}
+
+type panicError struct {
+    value         interface{}
+    stack         []byte
+}
+
+// done is called once fn has returned, which may be after the caller gave up.
+func runWithTimeout(ctx context.Context, timeout time.Duration, fn func(context.Context) error, done func()) error {
+    if timeout <= 0 {
+        if done != nil {
+            defer done()
+        }
+        return fn(ctx)
+    }
+
+    timeoutCtx, cancelFunc := context.WithTimeout(ctx, timeout)
+    defer cancelFunc()
+
+    result := make(chan error, 1)
+    go func() {
+        defer func() {
+            if r := recover(); r != nil {
+                result <- &panicError{value: r, stack: debug.Stack()}
+            }
+            if done != nil {
+                done()
+            }
+        }()
+        result <- fn(timeoutCtx)
+    }()
+
+    select {
+        case err := <-result:
+            if value, ok := err.(*panicError); ok {
+                panic(fmt.Sprintf("%v\n%s", value.value, value.stack))
+            }
+            return err
+        case <-timeoutCtx.Done():
+            go drain(result)
+            if err := ctx.Err(); err != nil {
+                return err
+            }
+            return ErrTimeout
+    }
+}
+
+// Log a panic of a call nobody waits for anymore.
+func drain(result chan error) {
+    if value, ok := (<-result).(*panicError); ok {
+        logger.LogSelector("_resilience").ErrorLog("Panic after timeout:[%v] %s", value.value, value.stack)
+    }
+}
+
+func (this *panicError) Error() string {
+    return fmt.Sprintf("panic: %v", this.value)
+}
@@ -0,0 +1,320 @@
+/*
+ * Response caching for webserver routes.
+ * Entries are kept in localcache or redis. Every entry records the generations of its route
+ * and path, so that invalidating only has to move a generation instead of finding the entries.
+ */
+
+package responsecache
+
+import (
+    "crypto/md5"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "github.com/gin-gonic/gin"
+    "github.com/marxn/vasc/global"
+    "github.com/marxn/vasc/localcache"
+    "github.com/marxn/vasc/logger"
+    vredis "github.com/marxn/vasc/redis"
+    "net/http"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+const StorageLocal = "local"
+const StorageRedis = "redis"
+
+const defaultMaxBodySize = 1024 * 1024
+
+type entry struct {
+    Status        int             `json:"status"`
+    Header        http.Header     `json:"header"`
+    Body        []byte            `json:"body"`
+    CreateTime    int64           `json:"create_time"`
+    ExpireTime    int64           `json:"expire_time"`
+    RouteGen      int64           `json:"route_gen"`
+    PathGen       int64           `json:"path_gen"`
+}
+
+type storage interface {
+    // Read the entry under key with the current generations of the route name and the path
+    load(key string, name string, path string) (data []byte, routeGen int64, pathGen int64, err error)
+    save(key string, data []byte, ttl time.Duration) error
+    remove(key string) error
+    invalidate(name string, paths []string, ttl time.Duration) error
+}
+
+type ResponseCache struct {
+    Name             string
+    TTL              time.Duration
+    VaryQuery      []string
+    VaryHeaders    []string
+    MaxBodySize      int64
+    // Callers on authenticated routes must not share entries
+    Identity         func(*gin.Context) string
+    storage          storage
+}
+
+// Storages of each route name, used by Invalidate
+var registry      = make(map[string]map[string]registered)
+var registryMutex   sync.RWMutex
+
+type registered struct {
+    storage   storage
+    ttl       time.Duration
+}
+
+func New(config *global.ResponseCacheConfig, name string, cacheManager *localcache.CacheManager, redisPoolList *vredis.VascRedis, projectName string) (*ResponseCache, error) {
+    if config.TTL <= 0 {
+        return nil, errors.New("response cache requires a positive ttl")
+    }
+
+    result := &ResponseCache{
+        Name:        name,
+        TTL:         time.Duration(config.TTL) * time.Second,
+        VaryQuery:   config.VaryQuery,
+        VaryHeaders: config.VaryHeaders,
+        MaxBodySize: config.MaxBodySize,
+    }
+    if config.Name != "" {
+        result.Name = config.Name
+    }
+    if result.MaxBodySize <= 0 {
+        result.MaxBodySize = defaultMaxBodySize
+    }
+
+    var storageKey string
+    switch config.Storage {
+        case "", StorageLocal:
+            if cacheManager == nil {
+                return nil, errors.New("localcache is not enabled for response cache")
+            }
+            result.storage = &localStorage{CacheManager: cacheManager}
+            storageKey     = StorageLocal
+        case StorageRedis:
+            if redisPoolList == nil || redisPoolList.Get(config.Redis) == nil {
+                return nil, errors.New("cannot get redis instance for response cache: " + config.Redis)
+            }
+            result.storage = &redisStorage{RedisConn: redisPoolList.Get(config.Redis), RedisPrefix: fmt.Sprintf("VASC:%s:RESPONSECACHE:", projectName)}
+            storageKey     = StorageRedis + ":" + config.Redis
+        default:
+            return nil, errors.New("invalid response cache storage: " + config.Storage)
+    }
+
+    registryMutex.Lock()
+    defer registryMutex.Unlock()
+    if registry[result.Name] == nil {
+        registry[result.Name] = make(map[string]registered)
+    }
+    // Keep the longest ttl so that invalidation outlives every entry of the name
+    if previous, exists := registry[result.Name][storageKey]; !exists || previous.ttl < result.TTL {
+        registry[result.Name][storageKey] = registered{storage: result.storage, ttl: result.TTL}
+    }
+
+    return result, nil
+}
+
+// Drop the cached responses of the routes named name, or only those of the given request paths.
+func Invalidate(name string, paths ...string) error {
+    registryMutex.RLock()
+    storages := make([]registered, 0, len(registry[name]))
+    for _, value := range registry[name] {
+        storages = append(storages, value)
+    }
+    registryMutex.RUnlock()
+
+    if len(storages) == 0 {
+        return errors.New("no response cache named " + name)
+    }
+
+    for _, value := range storages {
+        if err := value.storage.invalidate(name, paths, value.ttl); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// Serve GET requests from the cache and store the 200 responses of the handler.
+// Responses setting cookies or marked no-store/private are never stored.
+// Requests go to the handler when the storage fails.
+// The cache runs beneath the compress middleware, so entries hold the plain body and every hit is
+// encoded again for the client. Responses the handler encodes by itself are not stored, as the
+// cache key does not tell the encodings a client accepts.
+func (this *ResponseCache) Middleware(c *gin.Context) {
+    if c.Request.Method != http.MethodGet {
+        c.Next()
+        return
+    }
+
+    path := c.Request.URL.Path
+    key  := this.key(c)
+
+    data, routeGen, pathGen, err := this.storage.load(key, this.Name, path)
+    if err != nil {
+        logger.LogSelector("_gin").ErrorLog("tid[%s] response cache %s failed: %v", c.Request.Header.Get("X-Vasc-Request-Tracer"), this.Name, err)
+        c.Next()
+        return
+    }
+
+    if data != nil {
+        var value entry
+        if json.Unmarshal(data, &value) == nil && value.RouteGen == routeGen && value.PathGen == pathGen {
+            if time.Now().Unix() < value.ExpireTime {
+                serve(c, &value)
+                return
+            }
+            _ = this.storage.remove(key)
+        }
+    }
+
+    c.Header("X-Vasc-Cache", "MISS")
+
+    // Headers set by the outer middlewares belong to this request only
+    before   := c.Writer.Header().Clone()
+    recorder := &recorder{ResponseWriter: c.Writer, limit: this.MaxBodySize}
+    c.Writer  = recorder
+    c.Next()
+    c.Writer  = recorder.ResponseWriter
+
+    if !cacheable(c, recorder) {
+        return
+    }
+
+    now   := time.Now()
+    value := entry{
+        Status:     c.Writer.Status(),
+        Header:     changedHeader(before, c.Writer.Header()),
+        Body:       recorder.body,
+        CreateTime: now.Unix(),
+        ExpireTime: now.Add(this.TTL).Unix(),
+        RouteGen:   routeGen,
+        PathGen:    pathGen,
+    }
+
+    data, err = json.Marshal(&value)
+    if err == nil {
+        err = this.storage.save(key, data, this.TTL)
+    }
+    if err != nil {
+        logger.LogSelector("_gin").ErrorLog("tid[%s] response cache %s cannot store: %v", c.Request.Header.Get("X-Vasc-Request-Tracer"), this.Name, err)
+    }
+}
+
+func (this *ResponseCache) key(c *gin.Context) string {
+    var builder strings.Builder
+    builder.WriteString(this.Name)
+    builder.WriteString("\n")
+    builder.WriteString(c.Request.URL.Path)
+
+    query := c.Request.URL.Query()
+    for _, name := range this.VaryQuery {
+        values := append([]string(nil), query[name]...)
+        sort.Strings(values)
+        builder.WriteString("\nq:" + name + "=" + strings.Join(values, ","))
+    }
+    for _, name := range this.VaryHeaders {
+        builder.WriteString("\nh:" + name + "=" + strings.Join(c.Request.Header.Values(name), ","))
+    }
+    if this.Identity != nil {
+        builder.WriteString("\ni:" + this.Identity(c))
+    }
+
+    hash := md5.Sum([]byte(builder.String()))
+    return hex.EncodeToString(hash[:])
+}
+
+func serve(c *gin.Context, value *entry) {
+    header := c.Writer.Header()
+    for key, values := range value.Header {
+        if !transferHeaders[key] {
+            header[key] = values
+        }
+    }
+    header.Set("X-Vasc-Cache", "HIT")
+    header.Set("Age", fmt.Sprintf("%d", time.Now().Unix() - value.CreateTime))
+
+    c.Status(value.Status)
+    _, _ = c.Writer.Write(value.Body)
+    c.Abort()
+}
+
+func cacheable(c *gin.Context, recorder *recorder) bool {
+    if c.Writer.Status() != http.StatusOK || recorder.overflow || recorder.contentEncoding() != "" {
+        return false
+    }
+
+    header := c.Writer.Header()
+    if len(header.Values("Set-Cookie")) > 0 {
+        return false
+    }
+    cacheControl := strings.ToLower(strings.Join(header.Values("Cache-Control"), ","))
+    return !strings.Contains(cacheControl, "no-store") && !strings.Contains(cacheControl, "private")
+}
+
+// Headers which describe the body as sent to one client rather than the response itself
+var transferHeaders = map[string]bool{
+    "X-Vasc-Cache":     true,
+    "Content-Encoding": true,
+    "Content-Length":   true,
+}
+
+// Headers the handler added or changed.
+func changedHeader(before http.Header, after http.Header) http.Header {
+    result := make(http.Header)
+    for key, values := range after {
+        if transferHeaders[key] || strings.Join(before[key], "\n") == strings.Join(values, "\n") {
+            continue
+        }
+        result[key] = append([]string(nil), values...)
+    }
+    return result
+}
+
+// Keeps a copy of the body while it is written, up to limit.
+type recorder struct {
+    gin.ResponseWriter
+    body      []byte
+    limit     int64
+    overflow  bool
+    started   bool
+    encoding  string
+}
+
+func (this *recorder) Write(data []byte) (int, error) {
+    this.record(data)
+    return this.ResponseWriter.Write(data)
+}
+
+func (this *recorder) WriteString(data string) (int, error) {
+    this.record([]byte(data))
+    return this.ResponseWriter.WriteString(data)
+}
+
+func (this *recorder) record(data []byte) {
+    // The compress middleware sets Content-Encoding only once the body reaches it
+    if !this.started {
+        this.started  = true
+        this.encoding = this.Header().Get("Content-Encoding")
+    }
+    if this.overflow {
+        return
+    }
+    if int64(len(this.body) + len(data)) > this.limit {
+        this.overflow = true
+        this.body     = nil
+        return
+    }
+    this.body = append(this.body, data...)
+}
+
+// Content-Encoding set by the handler, not by the compress middleware.
+func (this *recorder) contentEncoding() string {
+    if !this.started {
+        return this.Header().Get("Content-Encoding")
+    }
+    return this.encoding
+}
@@ -0,0 +1,227 @@
+package responsecache
+
+import (
+    "bytes"
+    "compress/gzip"
+    "github.com/gin-gonic/gin"
+    "github.com/marxn/vasc/global"
+    "github.com/marxn/vasc/middleware"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+type memoryStorage struct {
+    mutex         sync.Mutex
+    entries       map[string][]byte
+    generations   map[string]int64
+}
+
+func newMemoryStorage() *memoryStorage {
+    return &memoryStorage{entries: make(map[string][]byte), generations: make(map[string]int64)}
+}
+
+func (this *memoryStorage) load(key string, name string, path string) ([]byte, int64, int64, error) {
+    this.mutex.Lock()
+    defer this.mutex.Unlock()
+    return this.entries[key], this.generations[name], this.generations[name + "\n" + path], nil
+}
+
+func (this *memoryStorage) save(key string, data []byte, ttl time.Duration) error {
+    this.mutex.Lock()
+    defer this.mutex.Unlock()
+    this.entries[key] = data
+    return nil
+}
+
+func (this *memoryStorage) remove(key string) error {
+    this.mutex.Lock()
+    defer this.mutex.Unlock()
+    delete(this.entries, key)
+    return nil
+}
+
+func (this *memoryStorage) invalidate(name string, paths []string, ttl time.Duration) error {
+    this.mutex.Lock()
+    defer this.mutex.Unlock()
+    if len(paths) == 0 {
+        this.generations[name]++
+    }
+    for _, path := range paths {
+        this.generations[name + "\n" + path]++
+    }
+    return nil
+}
+
+var plainBody = strings.Repeat("cached response body ", 200)
+
+func testCache() *ResponseCache {
+    return &ResponseCache{Name: "test", TTL: time.Minute, MaxBodySize: defaultMaxBodySize, VaryQuery: []string{"page"}, storage: newMemoryStorage()}
+}
+
+func testEngine(t *testing.T, cache *ResponseCache, handler gin.HandlerFunc) *gin.Engine {
+    gin.SetMode(gin.TestMode)
+    compress, err := middleware.New("compress", nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    engine := gin.New()
+    engine.Use(compress)
+    engine.GET("/items", cache.Middleware, handler)
+    return engine
+}
+
+func get(engine *gin.Engine, target string, acceptEncoding string) *httptest.ResponseRecorder {
+    request := httptest.NewRequest(http.MethodGet, target, nil)
+    if acceptEncoding != "" {
+        request.Header.Set("Accept-Encoding", acceptEncoding)
+    }
+    recorder := httptest.NewRecorder()
+    engine.ServeHTTP(recorder, request)
+    return recorder
+}
+
+func decodedBody(t *testing.T, recorder *httptest.ResponseRecorder) string {
+    if recorder.Header().Get("Content-Encoding") != "gzip" {
+        return recorder.Body.String()
+    }
+    reader, err := gzip.NewReader(bytes.NewReader(recorder.Body.Bytes()))
+    if err != nil {
+        t.Fatal(err)
+    }
+    data, err := io.ReadAll(reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return string(data)
+}
+
+func TestHitIsEncodedForEachClient(t *testing.T) {
+    engine := testEngine(t, testCache(), func(c *gin.Context) {
+        c.String(http.StatusOK, plainBody)
+    })
+
+    first := get(engine, "/items", "gzip")
+    if first.Header().Get("X-Vasc-Cache") != "MISS" || first.Header().Get("Content-Encoding") != "gzip" {
+        t.Fatalf("expected a compressed miss, got %v", first.Header())
+    }
+
+    plain := get(engine, "/items", "")
+    if plain.Header().Get("X-Vasc-Cache") != "HIT" {
+        t.Fatalf("expected a hit, got %v", plain.Header())
+    }
+    if encoding := plain.Header().Get("Content-Encoding"); encoding != "" {
+        t.Fatalf("client without gzip got Content-Encoding %q", encoding)
+    }
+    if plain.Body.String() != plainBody {
+        t.Fatal("client without gzip got a corrupt body")
+    }
+
+    compressed := get(engine, "/items", "gzip")
+    if compressed.Header().Get("X-Vasc-Cache") != "HIT" || compressed.Header().Get("Content-Encoding") != "gzip" {
+        t.Fatalf("expected a compressed hit, got %v", compressed.Header())
+    }
+    if decodedBody(t, compressed) != plainBody {
+        t.Fatal("gzip client got a corrupt body")
+    }
+}
+
+func TestHandlerEncodedResponseIsNotStored(t *testing.T) {
+    var encoded bytes.Buffer
+    writer := gzip.NewWriter(&encoded)
+    _, _ = writer.Write([]byte(plainBody))
+    _ = writer.Close()
+
+    engine := testEngine(t, testCache(), func(c *gin.Context) {
+        c.Header("Content-Encoding", "gzip")
+        c.Data(http.StatusOK, "text/plain", encoded.Bytes())
+    })
+
+    get(engine, "/items", "gzip")
+    if second := get(engine, "/items", ""); second.Header().Get("X-Vasc-Cache") != "MISS" {
+        t.Fatal("a response encoded by the handler must not be served from the cache")
+    }
+}
+
+func TestUncacheableResponses(t *testing.T) {
+    handlers := map[string]gin.HandlerFunc{
+        "no-store":   func(c *gin.Context) { c.Header("Cache-Control", "no-store"); c.String(http.StatusOK, "x") },
+        "private":    func(c *gin.Context) { c.Header("Cache-Control", "private, max-age=60"); c.String(http.StatusOK, "x") },
+        "set-cookie": func(c *gin.Context) { c.SetCookie("session", "1", 60, "/", "", false, true); c.String(http.StatusOK, "x") },
+        "error":      func(c *gin.Context) { c.String(http.StatusInternalServerError, "x") },
+    }
+
+    for name, handler := range handlers {
+        engine := testEngine(t, testCache(), handler)
+        get(engine, "/items", "")
+        if second := get(engine, "/items", ""); second.Header().Get("X-Vasc-Cache") != "MISS" {
+            t.Fatalf("%s: response should not have been stored", name)
+        }
+    }
+}
+
+func TestKeyVariesByQueryAndIdentity(t *testing.T) {
+    cache := testCache()
+    calls := 0
+    engine := testEngine(t, cache, func(c *gin.Context) {
+        calls++
+        c.String(http.StatusOK, "page %s", c.Query("page"))
+    })
+
+    get(engine, "/items?page=1", "")
+    get(engine, "/items?page=1&other=x", "")
+    if calls != 1 {
+        t.Fatalf("query parameters outside vary_query must share the entry, handler ran %d times", calls)
+    }
+    if recorder := get(engine, "/items?page=2", ""); recorder.Body.String() != "page 2" || calls != 2 {
+        t.Fatalf("a different page must not be served from the cache: %q", recorder.Body.String())
+    }
+
+    cache.Identity = func(c *gin.Context) string { return c.GetHeader("X-User") }
+    first := httptest.NewRequest(http.MethodGet, "/items?page=1", nil)
+    first.Header.Set("X-User", "alice")
+    second := httptest.NewRequest(http.MethodGet, "/items?page=1", nil)
+    second.Header.Set("X-User", "bob")
+    if cache.key(ginContext(first)) == cache.key(ginContext(second)) {
+        t.Fatal("callers with different identities must not share entries")
+    }
+}
+
+func TestInvalidateDropsEntries(t *testing.T) {
+    cache := testCache()
+    cache.Name = "invalidate-test"
+    registry[cache.Name] = map[string]registered{StorageLocal: {storage: cache.storage, ttl: cache.TTL}}
+    defer delete(registry, cache.Name)
+
+    engine := testEngine(t, cache, func(c *gin.Context) {
+        c.String(http.StatusOK, "x")
+    })
+
+    get(engine, "/items", "")
+    if err := Invalidate(cache.Name, "/items"); err != nil {
+        t.Fatal(err)
+    }
+    if recorder := get(engine, "/items", ""); recorder.Header().Get("X-Vasc-Cache") != "MISS" {
+        t.Fatal("expected a miss after invalidating the path")
+    }
+    if err := Invalidate("missing"); err == nil {
+        t.Fatal("expected an error for an unknown cache name")
+    }
+}
+
+func TestNewRequiresTTL(t *testing.T) {
+    if _, err := New(&global.ResponseCacheConfig{}, "test", nil, nil, "test"); err == nil {
+        t.Fatal("expected an error without ttl")
+    }
+}
+
+func ginContext(request *http.Request) *gin.Context {
+    c, _ := gin.CreateTestContext(httptest.NewRecorder())
+    c.Request = request
+    return c
+}
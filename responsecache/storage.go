@@ -0,0 +1,147 @@
+package responsecache
+
+import (
+    "errors"
+    "github.com/garyburd/redigo/redis"
+    "github.com/marxn/vasc/localcache"
+    "strconv"
+    "sync"
+    "time"
+)
+
+// Generations are the time of the last invalidation, so a generation that has expired
+// never comes back with a value an old entry was stored under.
+func newGeneration() int64 {
+    return time.Now().UnixNano()
+}
+
+type localStorage struct {
+    CacheManager   *localcache.CacheManager
+}
+
+type localGeneration struct {
+    value      int64
+    expire     time.Time
+}
+
+// Shared by all local caches so that generations survive a route reload
+var localGenerations     = make(map[string]localGeneration)
+var localGenerationMutex   sync.Mutex
+
+func (this *localStorage) load(key string, name string, path string) ([]byte, int64, int64, error) {
+    localGenerationMutex.Lock()
+    now      := time.Now()
+    routeGen := localGenerations[name]
+    pathGen  := localGenerations[name + "\n" + path]
+    localGenerationMutex.Unlock()
+
+    if now.After(routeGen.expire) {
+        routeGen.value = 0
+    }
+    if now.After(pathGen.expire) {
+        pathGen.value = 0
+    }
+
+    // A missing key is not told apart from other errors by localcache
+    value, err := this.CacheManager.ReadKV(key, false)
+    if err != nil || value == "" {
+        return nil, routeGen.value, pathGen.value, nil
+    }
+    return []byte(value), routeGen.value, pathGen.value, nil
+}
+
+func (this *localStorage) save(key string, data []byte, ttl time.Duration) error {
+    return this.CacheManager.WriteKV(key, string(data), int64(ttl / time.Second), false)
+}
+
+func (this *localStorage) remove(key string) error {
+    return this.CacheManager.RemoveFromFS(key)
+}
+
+func (this *localStorage) invalidate(name string, paths []string, ttl time.Duration) error {
+    localGenerationMutex.Lock()
+    defer localGenerationMutex.Unlock()
+
+    now := time.Now()
+    for key, value := range localGenerations {
+        if now.After(value.expire) {
+            delete(localGenerations, key)
+        }
+    }
+
+    generation := localGeneration{value: newGeneration(), expire: now.Add(ttl)}
+    if len(paths) == 0 {
+        localGenerations[name] = generation
+        return nil
+    }
+    for _, path := range paths {
+        localGenerations[name + "\n" + path] = generation
+    }
+    return nil
+}
+
+type redisStorage struct {
+    RedisConn     *redis.Pool
+    RedisPrefix    string
+}
+
+func (this *redisStorage) generationKey(name string, path string) string {
+    if path == "" {
+        return this.RedisPrefix + "GEN:" + name
+    }
+    return this.RedisPrefix + "GEN:" + name + ":" + path
+}
+
+func (this *redisStorage) load(key string, name string, path string) ([]byte, int64, int64, error) {
+    redisConn := this.RedisConn.Get()
+    if redisConn == nil {
+        return nil, 0, 0, errors.New("cannot get redis connection for response cache")
+    }
+    defer redisConn.Close()
+
+    values, err := redis.ByteSlices(redisConn.Do("MGET", this.RedisPrefix + key, this.generationKey(name, ""), this.generationKey(name, path)))
+    if err != nil {
+        return nil, 0, 0, err
+    }
+
+    routeGen, _ := strconv.ParseInt(string(values[1]), 10, 64)
+    pathGen,  _ := strconv.ParseInt(string(values[2]), 10, 64)
+    return values[0], routeGen, pathGen, nil
+}
+
+func (this *redisStorage) save(key string, data []byte, ttl time.Duration) error {
+    redisConn := this.RedisConn.Get()
+    if redisConn == nil {
+        return errors.New("cannot get redis connection for response cache")
+    }
+    defer redisConn.Close()
+
+    _, err := redisConn.Do("SET", this.RedisPrefix + key, data, "PX", int64(ttl / time.Millisecond))
+    return err
+}
+
+// Entries expire in redis by themselves
+func (this *redisStorage) remove(key string) error {
+    return nil
+}
+
+func (this *redisStorage) invalidate(name string, paths []string, ttl time.Duration) error {
+    redisConn := this.RedisConn.Get()
+    if redisConn == nil {
+        return errors.New("cannot get redis connection for response cache")
+    }
+    defer redisConn.Close()
+
+    generation := newGeneration()
+    expire     := int64(ttl / time.Millisecond)
+    if len(paths) == 0 {
+        _, err := redisConn.Do("SET", this.generationKey(name, ""), generation, "PX", expire)
+        return err
+    }
+    for _, path := range paths {
+        if _, err := redisConn.Do("SET", this.generationKey(name, path), generation, "PX", expire); err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,198 @@
+package stream
+
+import (
+    "context"
+    "errors"
+    "github.com/garyburd/redigo/redis"
+    "github.com/marxn/vasc/global"
+    "github.com/marxn/vasc/logger"
+    vredis "github.com/marxn/vasc/redis"
+    "sync"
+    "time"
+)
+
+// Fans messages out to subscribed connections. With redis, every node subscribes to the
+// project channel pattern and messages published on any node reach all of them.
+type Hub struct {
+    ProjectName     string
+    RedisConn      *redis.Pool
+    options        *options
+    ctx             context.Context
+    cancel          context.CancelFunc
+    topics          map[string]map[*connection]bool
+    topicMutex      sync.RWMutex
+    pubsub         *redis.PubSubConn
+    pubsubMutex     sync.Mutex
+    done            chan struct{}
+}
+
+func NewHub(config *global.StreamConfig, redisPoolList *vredis.VascRedis, projectName string) (*Hub, error) {
+    ctx, cancel := context.WithCancel(context.Background())
+
+    hub := &Hub{
+        ProjectName: projectName,
+        options:     newOptions(config),
+        ctx:         ctx,
+        cancel:      cancel,
+        topics:      make(map[string]map[*connection]bool),
+    }
+
+    if config != nil && config.Redis != "" {
+        if redisPoolList == nil || redisPoolList.Get(config.Redis) == nil {
+            cancel()
+            return nil, errors.New("cannot get redis instance for stream: " + config.Redis)
+        }
+        hub.RedisConn = redisPoolList.Get(config.Redis)
+    }
+
+    return hub, nil
+}
+
+func (this *Hub) channelPrefix() string {
+    return "VASC:" + this.ProjectName + ":STREAM:"
+}
+
+func (this *Hub) Start() {
+    if this.RedisConn == nil {
+        return
+    }
+
+    this.pubsubMutex.Lock()
+    this.done = make(chan struct{})
+    this.pubsubMutex.Unlock()
+
+    go this.receiveLoop(this.done)
+}
+
+// Stop receiving and close all connections.
+func (this *Hub) Close() {
+    this.cancel()
+
+    // The receiver is the only reader of the connection, so it is ended by unsubscribing
+    this.pubsubMutex.Lock()
+    if this.pubsub != nil {
+        _ = this.pubsub.PUnsubscribe()
+    }
+    done := this.done
+    this.pubsubMutex.Unlock()
+
+    if done != nil {
+        <-done
+    }
+}
+
+// Send data to the subscribers of topic on all nodes.
+func (this *Hub) Publish(topic string, data []byte) error {
+    if this.RedisConn == nil {
+        this.deliver(topic, data)
+        return nil
+    }
+
+    redisConn := this.RedisConn.Get()
+    if redisConn == nil {
+        return errors.New("cannot get redis connection for stream")
+    }
+    defer redisConn.Close()
+
+    _, err := redisConn.Do("PUBLISH", this.channelPrefix() + topic, data)
+    return err
+}
+
+func (this *Hub) deliver(topic string, data []byte) {
+    this.topicMutex.RLock()
+    subscribers := make([]*connection, 0, len(this.topics[topic]))
+    for conn := range this.topics[topic] {
+        subscribers = append(subscribers, conn)
+    }
+    this.topicMutex.RUnlock()
+
+    for _, conn := range subscribers {
+        // A slow subscriber is closed by SendEvent and does not hold up the others
+        _ = conn.Send(data)
+    }
+}
+
+func (this *Hub) subscribe(topic string, conn *connection) {
+    this.topicMutex.Lock()
+    defer this.topicMutex.Unlock()
+
+    if this.topics[topic] == nil {
+        this.topics[topic] = make(map[*connection]bool)
+    }
+    this.topics[topic][conn] = true
+}
+
+func (this *Hub) unsubscribe(topic string, conn *connection) {
+    this.topicMutex.Lock()
+    defer this.topicMutex.Unlock()
+
+    delete(this.topics[topic], conn)
+    if len(this.topics[topic]) == 0 {
+        delete(this.topics, topic)
+    }
+}
+
+// Keep one pattern subscription for the project, reconnecting until the hub is closed.
+func (this *Hub) receiveLoop(done chan struct{}) {
+    defer close(done)
+
+    prefix := this.channelPrefix()
+    for {
+        err := this.receive(prefix)
+
+        select {
+            case <-this.ctx.Done():
+                return
+            default:
+        }
+
+        logger.ErrorLog("stream hub subscription lost: %v", err)
+        select {
+            case <-time.After(time.Second):
+            case <-this.ctx.Done():
+                return
+        }
+    }
+}
+
+func (this *Hub) receive(prefix string) error {
+    redisConn := this.RedisConn.Get()
+    if redisConn == nil {
+        return errors.New("cannot get redis connection for stream")
+    }
+
+    pubsub := &redis.PubSubConn{Conn: redisConn}
+    defer func() {
+        this.pubsubMutex.Lock()
+        this.pubsub = nil
+        this.pubsubMutex.Unlock()
+        _ = pubsub.Close()
+    }()
+
+    this.pubsubMutex.Lock()
+    if this.ctx.Err() != nil {
+        this.pubsubMutex.Unlock()
+        return this.ctx.Err()
+    }
+    this.pubsub = pubsub
+    this.pubsubMutex.Unlock()
+
+    if err := pubsub.PSubscribe(prefix + "*"); err != nil {
+        return err
+    }
+
+    for {
+        switch value := pubsub.Receive().(type) {
+            case redis.PMessage:
+                this.deliver(value.Channel[len(prefix):], value.Data)
+            case redis.Message:
+                this.deliver(value.Channel[len(prefix):], value.Data)
+            case redis.Subscription:
+                if value.Count == 0 {
+                    return nil
+                }
+            case error:
+                return value
+        }
+    }
+}
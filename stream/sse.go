@@ -0,0 +1,123 @@
+package stream
+
+import (
+    "bytes"
+    "github.com/gin-gonic/gin"
+    "github.com/marxn/vasc/portal"
+    "github.com/marxn/vasc/verror"
+    "net/http"
+    "time"
+)
+
+type eventStreamConn struct {
+    *connection
+    writer      gin.ResponseWriter
+    controller *http.ResponseController
+}
+
+// Create the gin handler of an SSE route.
+func EventStreamRoute(projectName string, handlerName string, handler func(*portal.Portal), hub *Hub) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if _, ok := c.Writer.(http.Flusher); !ok {
+            verror.Render(c, verror.New(http.StatusNotImplemented, http.StatusNotImplemented, "Streaming is not supported"))
+            return
+        }
+
+        conn := &eventStreamConn{
+            connection: newConnection(hub, c.Request.Context()),
+            writer:     c.Writer,
+            controller: http.NewResponseController(c.Writer),
+        }
+
+        _ = conn.controller.SetWriteDeadline(time.Now().Add(hub.options.WriteTimeout))
+        header := c.Writer.Header()
+        header.Set("Content-Type", "text/event-stream")
+        header.Set("Cache-Control", "no-cache")
+        header.Set("Connection", "keep-alive")
+        header.Set("X-Accel-Buffering", "no")
+        c.Writer.WriteHeader(http.StatusOK)
+        c.Writer.Flush()
+
+        go conn.writeLoop()
+
+        serve(c, projectName, handlerName, handler, conn, conn.ctx)
+    }
+}
+
+func (this *eventStreamConn) Receive() ([]byte, error) {
+    return nil, ErrNotSupported
+}
+
+func (this *eventStreamConn) writeLoop() {
+    ticker := time.NewTicker(this.hub.options.PingInterval)
+
+    defer func() {
+        ticker.Stop()
+        this.release()
+        close(this.finished)
+    }()
+
+    for {
+        select {
+            case value := <-this.queue:
+                if err := this.write(encodeEvent(value)); err != nil {
+                    this.fail(ErrClosed)
+                    return
+                }
+            case <-ticker.C:
+                // Comment lines keep proxies from closing an idle stream
+                if err := this.write([]byte(": ping\n\n")); err != nil {
+                    this.fail(ErrClosed)
+                    return
+                }
+            case <-this.ctx.Done():
+                this.flush()
+                return
+        }
+    }
+}
+
+// Write what is still queued when the connection is closed by the server.
+func (this *eventStreamConn) flush() {
+    if this.closeError() != ErrClosed {
+        return
+    }
+
+    for {
+        select {
+            case value := <-this.queue:
+                if this.write(encodeEvent(value)) != nil {
+                    return
+                }
+            default:
+                return
+        }
+    }
+}
+
+// Each write gets its own deadline, the server write timeout would cut the stream otherwise.
+func (this *eventStreamConn) write(data []byte) error {
+    _ = this.controller.SetWriteDeadline(time.Now().Add(this.hub.options.WriteTimeout))
+    if _, err := this.writer.Write(data); err != nil {
+        return err
+    }
+    return this.controller.Flush()
+}
+
+func encodeEvent(value message) []byte {
+    var buffer bytes.Buffer
+    if value.Event != "" {
+        buffer.WriteString("event: ")
+        buffer.WriteString(value.Event)
+        buffer.WriteByte('\n')
+    }
+
+    for _, line := range bytes.Split(value.Data, []byte("\n")) {
+        buffer.WriteString("data: ")
+        buffer.Write(bytes.TrimSuffix(line, []byte("\r")))
+        buffer.WriteByte('\n')
+    }
+    buffer.WriteByte('\n')
+
+    return buffer.Bytes()
+}
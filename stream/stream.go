@@ -0,0 +1,206 @@
+/*
+ * Long lived WS and SSE connections for webserver routes.
+ * Handlers get the connection from portal.Stream(); messages published to a topic
+ * reach subscribers on every node when the hub is backed by redis.
+ */
+
+package stream
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "github.com/gin-gonic/gin"
+    "github.com/marxn/vasc/global"
+    "github.com/marxn/vasc/portal"
+    "sync"
+    "time"
+)
+
+var ErrClosed       = errors.New("stream closed")
+var ErrSlowConsumer = errors.New("stream closed: client cannot keep up")
+var ErrSlowReceiver = errors.New("stream closed: handler cannot keep up with incoming messages")
+var ErrNotSupported = errors.New("receive is not supported by server-sent events")
+
+type message struct {
+    Event      string
+    Data     []byte
+}
+
+// Defaults applied to StreamConfig
+type options struct {
+    PingInterval     time.Duration
+    PongTimeout      time.Duration
+    WriteTimeout     time.Duration
+    MaxMessageSize   int64
+    SendBuffer       int
+    AllowedOrigins []string
+}
+
+func newOptions(config *global.StreamConfig) *options {
+    if config == nil {
+        config = &global.StreamConfig{}
+    }
+
+    result := &options{
+        PingInterval:   time.Duration(config.PingInterval) * time.Second,
+        PongTimeout:    time.Duration(config.PongTimeout)  * time.Second,
+        WriteTimeout:   time.Duration(config.WriteTimeout) * time.Second,
+        MaxMessageSize: config.MaxMessageSize,
+        SendBuffer:     config.SendBuffer,
+        AllowedOrigins: config.AllowedOrigins,
+    }
+    if result.PingInterval <= 0 {
+        result.PingInterval = 30 * time.Second
+    }
+    if result.PongTimeout <= result.PingInterval {
+        result.PongTimeout = result.PingInterval * 2
+    }
+    if result.WriteTimeout <= 0 {
+        result.WriteTimeout = 10 * time.Second
+    }
+    if result.MaxMessageSize <= 0 {
+        result.MaxMessageSize = 64 * 1024
+    }
+    if result.SendBuffer <= 0 {
+        result.SendBuffer = 64
+    }
+    return result
+}
+
+// State shared by both transports. Outgoing messages are queued and written by one goroutine,
+// so that a slow client never blocks the handler or the hub.
+type connection struct {
+    hub          *Hub
+    ctx           context.Context
+    cancel        context.CancelFunc
+    stopHub       func() bool
+    queue         chan message
+    finished      chan struct{}
+    topics        map[string]bool
+    topicMutex    sync.Mutex
+    err           error
+    errOnce       sync.Once
+}
+
+// The connection ends with the request or when the hub shuts down, whichever comes first.
+func newConnection(hub *Hub, parent context.Context) *connection {
+    ctx, cancel := context.WithCancel(parent)
+    return &connection{
+        hub:      hub,
+        ctx:      ctx,
+        cancel:   cancel,
+        stopHub:  context.AfterFunc(hub.ctx, cancel),
+        queue:    make(chan message, hub.options.SendBuffer),
+        finished: make(chan struct{}),
+        topics:   make(map[string]bool),
+    }
+}
+
+func (this *connection) Send(data []byte) error {
+    return this.SendEvent("", data)
+}
+
+func (this *connection) SendJSON(value interface{}) error {
+    data, err := json.Marshal(value)
+    if err != nil {
+        return err
+    }
+    return this.Send(data)
+}
+
+func (this *connection) SendEvent(event string, data []byte) error {
+    select {
+        case <-this.ctx.Done():
+            return this.closeError()
+        default:
+    }
+
+    select {
+        case this.queue <- message{Event: event, Data: data}:
+            return nil
+        default:
+            this.fail(ErrSlowConsumer)
+            return ErrSlowConsumer
+    }
+}
+
+func (this *connection) Subscribe(topic string) error {
+    this.topicMutex.Lock()
+    defer this.topicMutex.Unlock()
+
+    // Topics are released under the same lock once the connection is done
+    select {
+        case <-this.ctx.Done():
+            return this.closeError()
+        default:
+    }
+
+    this.topics[topic] = true
+    this.hub.subscribe(topic, this)
+    return nil
+}
+
+func (this *connection) Unsubscribe(topic string) {
+    this.topicMutex.Lock()
+    delete(this.topics, topic)
+    this.topicMutex.Unlock()
+
+    this.hub.unsubscribe(topic, this)
+}
+
+func (this *connection) Publish(topic string, data []byte) error {
+    return this.hub.Publish(topic, data)
+}
+
+func (this *connection) Done() <-chan struct{} {
+    return this.ctx.Done()
+}
+
+// Stop the connection and wait until the writer has finished with it.
+func (this *connection) Close() error {
+    this.fail(ErrClosed)
+    <-this.finished
+    return nil
+}
+
+// Record why the connection ended and stop it. Only the first reason is kept.
+func (this *connection) fail(err error) {
+    this.errOnce.Do(func() {
+        this.err = err
+    })
+    this.cancel()
+}
+
+func (this *connection) closeError() error {
+    this.errOnce.Do(func() {
+        this.err = ErrClosed
+    })
+    return this.err
+}
+
+// Called by the writer once the connection is done.
+func (this *connection) release() {
+    this.cancel()
+    this.stopHub()
+
+    this.topicMutex.Lock()
+    defer this.topicMutex.Unlock()
+    for topic := range this.topics {
+        this.hub.unsubscribe(topic, this)
+    }
+    this.topics = make(map[string]bool)
+}
+
+// Run handler with conn as the portal stream. The connection is closed when the handler returns.
+func serve(c *gin.Context, projectName string, handlerName string, handler func(*portal.Portal), conn portal.Stream, ctx context.Context) {
+    c.Set(portal.StreamKey, conn)
+
+    portal.MakeGinRouteWithContext(projectName, handlerName, func(p *portal.Portal) {
+        defer conn.Close()
+
+        // The handler context ends with the connection
+        p.Context = ctx
+        handler(p)
+    }, 0)(c)
+}
@@ -0,0 +1,183 @@
+package stream
+
+import (
+    "encoding/json"
+    "github.com/gin-gonic/gin"
+    "github.com/gorilla/websocket"
+    "github.com/marxn/vasc/logger"
+    "github.com/marxn/vasc/portal"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+)
+
+// Incoming messages buffered for Receive. The reader cannot wait for the handler, since it has
+// to keep answering pings, so a client sending beyond it is closed with a policy violation.
+const receiveBuffer = 64
+
+type webSocketConn struct {
+    *connection
+    socket    *websocket.Conn
+    incoming   chan []byte
+}
+
+// Create the gin handler of a WS route.
+func WebSocketRoute(projectName string, handlerName string, handler func(*portal.Portal), hub *Hub) gin.HandlerFunc {
+    upgrader := &websocket.Upgrader{
+        HandshakeTimeout: hub.options.WriteTimeout,
+        CheckOrigin:      checkOrigin(hub.options.AllowedOrigins),
+    }
+
+    return func(c *gin.Context) {
+        // The upgrader has answered the client when it fails
+        socket, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+        if err != nil {
+            logger.LogSelector("_gin").ErrorLog("tid[%s] websocket upgrade failed: %v", c.Request.Header.Get("X-Vasc-Request-Tracer"), err)
+            c.Abort()
+            return
+        }
+
+        conn := &webSocketConn{
+            connection: newConnection(hub, c.Request.Context()),
+            socket:     socket,
+            incoming:   make(chan []byte, receiveBuffer),
+        }
+
+        go conn.readLoop()
+        go conn.writeLoop()
+
+        serve(c, projectName, handlerName, handler, conn, conn.ctx)
+    }
+}
+
+// Same origin only unless allowed origins are configured. "*" allows any origin.
+func checkOrigin(allowedOrigins []string) func(r *http.Request) bool {
+    if len(allowedOrigins) == 0 {
+        return nil
+    }
+
+    return func(r *http.Request) bool {
+        origin := r.Header.Get("Origin")
+        if origin == "" {
+            return true
+        }
+        for _, value := range allowedOrigins {
+            if value == "*" || strings.EqualFold(value, origin) {
+                return true
+            }
+        }
+
+        // Fall back to the same origin rule
+        parsed, err := url.Parse(origin)
+        return err == nil && strings.EqualFold(parsed.Host, r.Host)
+    }
+}
+
+func (this *webSocketConn) Receive() ([]byte, error) {
+    select {
+        case data, ok := <-this.incoming:
+            if !ok {
+                return nil, this.closeError()
+            }
+            return data, nil
+        case <-this.ctx.Done():
+            return nil, this.closeError()
+    }
+}
+
+func (this *webSocketConn) readLoop() {
+    defer close(this.incoming)
+
+    options := this.hub.options
+    this.socket.SetReadLimit(options.MaxMessageSize)
+    _ = this.socket.SetReadDeadline(time.Now().Add(options.PongTimeout))
+    this.socket.SetPongHandler(func(string) error {
+        return this.socket.SetReadDeadline(time.Now().Add(options.PongTimeout))
+    })
+
+    for {
+        _, data, err := this.socket.ReadMessage()
+        if err != nil {
+            this.fail(ErrClosed)
+            return
+        }
+
+        // Any message proves that the client is alive
+        _ = this.socket.SetReadDeadline(time.Now().Add(options.PongTimeout))
+
+        select {
+            case this.incoming <- data:
+            default:
+                this.fail(ErrSlowReceiver)
+                return
+        }
+    }
+}
+
+func (this *webSocketConn) writeLoop() {
+    options := this.hub.options
+    ticker  := time.NewTicker(options.PingInterval)
+
+    defer func() {
+        ticker.Stop()
+        this.release()
+        _ = this.socket.Close()
+        close(this.finished)
+    }()
+
+    for {
+        select {
+            case value := <-this.queue:
+                if err := this.write(value); err != nil {
+                    this.fail(ErrClosed)
+                    return
+                }
+            case <-ticker.C:
+                if err := this.socket.WriteControl(websocket.PingMessage, nil, time.Now().Add(options.WriteTimeout)); err != nil {
+                    this.fail(ErrClosed)
+                    return
+                }
+            case <-this.ctx.Done():
+                this.flush()
+                closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+                if this.closeError() == ErrSlowReceiver {
+                    closeMessage = websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "too many messages")
+                }
+                _ = this.socket.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(options.WriteTimeout))
+                return
+        }
+    }
+}
+
+// Write what is still queued when the connection is closed by the server.
+func (this *webSocketConn) flush() {
+    if this.closeError() != ErrClosed {
+        return
+    }
+
+    for {
+        select {
+            case value := <-this.queue:
+                if this.write(value) != nil {
+                    return
+                }
+            default:
+                return
+        }
+    }
+}
+
+func (this *webSocketConn) write(value message) error {
+    data := value.Data
+    if value.Event != "" {
+        var err error
+        data, err = json.Marshal(map[string]string{"event": value.Event, "data": string(value.Data)})
+        if err != nil {
+            return err
+        }
+    }
+
+    _ = this.socket.SetWriteDeadline(time.Now().Add(this.hub.options.WriteTimeout))
+    return this.socket.WriteMessage(websocket.TextMessage, data)
+}
@@ -0,0 +1,90 @@
+package stream
+
+import (
+    "errors"
+    "github.com/gin-gonic/gin"
+    "github.com/gorilla/websocket"
+    "github.com/marxn/vasc/portal"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+func dialWebSocket(t *testing.T, handler func(*portal.Portal)) *websocket.Conn {
+    t.Helper()
+    gin.SetMode(gin.TestMode)
+
+    hub, err := NewHub(nil, nil, "test")
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(hub.Close)
+
+    engine := gin.New()
+    engine.GET("/ws", WebSocketRoute("test", "ws", handler, hub))
+    server := httptest.NewServer(engine)
+    t.Cleanup(server.Close)
+
+    client, _, err := websocket.DefaultDialer.Dial("ws" + strings.TrimPrefix(server.URL, "http") + "/ws", nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { _ = client.Close() })
+    _ = client.SetReadDeadline(time.Now().Add(5 * time.Second))
+    return client
+}
+
+func TestWebSocketReceive(t *testing.T) {
+    client := dialWebSocket(t, func(p *portal.Portal) {
+        for {
+            data, err := p.Stream().Receive()
+            if err != nil {
+                return
+            }
+            _ = p.Stream().Send(append([]byte("echo "), data...))
+        }
+    })
+
+    for _, value := range []string{"one", "two"} {
+        if err := client.WriteMessage(websocket.TextMessage, []byte(value)); err != nil {
+            t.Fatal(err)
+        }
+        _, data, err := client.ReadMessage()
+        if err != nil {
+            t.Fatal(err)
+        }
+        if string(data) != "echo " + value {
+            t.Fatalf("unexpected reply %q", data)
+        }
+    }
+}
+
+func TestWebSocketReceiveOverflow(t *testing.T) {
+    result := make(chan error, 1)
+    client := dialWebSocket(t, func(p *portal.Portal) {
+        // Never receives until the connection is done
+        <-p.Stream().Done()
+        for {
+            if _, err := p.Stream().Receive(); err != nil {
+                result <- err
+                return
+            }
+        }
+    })
+
+    for i := 0; i <= receiveBuffer; i++ {
+        if err := client.WriteMessage(websocket.TextMessage, []byte("message")); err != nil {
+            break
+        }
+    }
+
+    _, _, err := client.ReadMessage()
+    var closeError *websocket.CloseError
+    if !errors.As(err, &closeError) || closeError.Code != websocket.ClosePolicyViolation {
+        t.Fatalf("expected a policy violation close, got %v", err)
+    }
+    if err := <-result; err != ErrSlowReceiver {
+        t.Fatalf("expected the handler to learn why, got %v", err)
+    }
+}
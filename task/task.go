@@ -11,6 +11,10 @@ import (
     "github.com/marxn/vasc/global"
     "github.com/marxn/vasc/portal"
     vredis "github.com/marxn/vasc/redis"
+    "github.com/marxn/vasc/tenant"
+    "github.com/marxn/vasc/tracing"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/trace"
     "sync"
     "time"
 )
@@ -23,6 +27,7 @@ type VascTask struct {
     Application       *global.VascApplication
     RedisConn         *redis.Pool
     RedisPrefix        string
+    redisInstance      string
     runnable           bool
     needReload         bool
     DBConn            *xorm.Engine
@@ -57,7 +62,8 @@ func (this *VascTask) LoadConfig(config *global.TaskConfig, redisPoolList *vredi
         if redisInstance == nil {
             return errors.New("cannot get redis instance for global task")
         }
-        this.RedisConn = redisInstance
+        this.RedisConn     = redisInstance
+        this.redisInstance = config.GlobalQueueRedis
     }
     if dbList!=nil && config.LoadTaskDB!="" {
         dbEngine, err := dbList.GetEngine(config.LoadTaskDB)
@@ -244,15 +250,25 @@ func (this * VascTask) Bootstrap() {
 }
 
 func (this *VascTask) PushNativeTask(key string, content []byte) error {
+    return this.PushNativeTaskWithContext(context.Background(), key, content)
+}
+
+// Push a task which is handled as part of the trace of ctx, for the tenant attached to ctx.
+func (this *VascTask) PushNativeTaskWithContext(ctx context.Context, key string, content []byte) error {
     info := this.TaskList[key]
     if info==nil {
         return errors.New("invalid task")
     } 
     
+    ctx, span := startPushSpan(ctx, key)
+    defer span.End()
+    
     taskContent := &portal.TaskContent{
-        ProjectName: this.ProjectName,
-        CreateTime:  time.Now().UnixNano(),
-        Content:     content,
+        ProjectName:  this.ProjectName,
+        CreateTime:   time.Now().UnixNano(),
+        Content:      content,
+        TraceContext: tracing.Inject(ctx),
+        Tenant:       tenant.FromContext(ctx),
     }
     
     for ;this.runnable && !this.needReload; {
@@ -300,18 +316,29 @@ func (this *VascTask) getTaskFromRedis(key string, timeout int64) (*portal.TaskC
 }
 
 func (this *VascTask) PushGlobalTask(key string, content []byte) error {
+    return this.PushGlobalTaskWithContext(context.Background(), key, content)
+}
+
+// Push a task which is handled as part of the trace of ctx, for the tenant attached to ctx,
+// on whichever instance takes it.
+func (this *VascTask) PushGlobalTaskWithContext(ctx context.Context, key string, content []byte) error {
     if this.RedisConn==nil {
         return errors.New("cannot find redis configuration for pushing task")
     }
     aKey := this.RedisPrefix + key
     
-    redisConn := this.RedisConn.Get()
+    ctx, span := startPushSpan(ctx, key)
+    defer span.End()
+    
+    redisConn := tracing.RedisConn(ctx, this.RedisConn.Get(), this.redisInstance)
     defer redisConn.Close()
     
     taskContent := &portal.TaskContent{
-        ProjectName: this.ProjectName,
-        CreateTime:  time.Now().UnixNano(),
-        Content:     content,
+        ProjectName:  this.ProjectName,
+        CreateTime:   time.Now().UnixNano(),
+        Content:      content,
+        TraceContext: tracing.Inject(ctx),
+        Tenant:       tenant.FromContext(ctx),
     }
     
     taskContentBytes, err := json.Marshal(taskContent)
@@ -360,6 +387,11 @@ func (this *VascTask) CreateNewPersistentTask(task *VascTaskDB) error {
     return err
 }
 
+func startPushSpan(ctx context.Context, key string) (context.Context, trace.Span) {
+    return tracing.Tracer().Start(ctx, "push " + key, trace.WithSpanKind(trace.SpanKindProducer),
+        trace.WithAttributes(attribute.String("vasc.task", key)))
+}
+
 func InvalidTaskHandler(p * portal.Portal) error {
     return errors.New("Invalid task prototype")
 }
@@ -0,0 +1,181 @@
+/*
+ * Tenant resolution for deployments serving several customers. A tenant selects its own
+ * database engines and redis instances among the configured ones, and a key prefix in redis.
+ */
+
+package tenant
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "github.com/marxn/vasc/global"
+    "net"
+    "net/http"
+    "regexp"
+    "strings"
+)
+
+const SourceHeader = "header"
+const SourceHost   = "host"
+const SourceClaim  = "claim"
+
+var ErrMismatch = errors.New("tenant does not match the identity")
+
+// Tenant ids end up in redis prefixes and log lines, so a ":" could reach the keys of another tenant
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+type VascTenant struct {
+    Config        *global.TenantConfig
+    tenantMap      map[string]*global.TenantItem
+    hostMap        map[string]string
+}
+
+func (this *VascTenant) LoadConfig(config *global.TenantConfig) error {
+    this.Config    = config
+    this.tenantMap = make(map[string]*global.TenantItem)
+    this.hostMap   = make(map[string]string)
+
+    if len(config.Resolve) == 0 {
+        config.Resolve = []string{SourceHeader}
+    }
+    for _, value := range config.Resolve {
+        if value != SourceHeader && value != SourceHost && value != SourceClaim {
+            return errors.New("invalid tenant source: " + value)
+        }
+    }
+    if config.Header == "" {
+        config.Header = "X-Tenant-Id"
+    }
+    if config.Claim == "" {
+        config.Claim = "tenant"
+    }
+
+    for index := range config.TenantList {
+        item := &config.TenantList[index]
+        if item.ID == "" {
+            return errors.New("empty tenant id")
+        }
+        if !idPattern.MatchString(item.ID) {
+            return errors.New("invalid tenant id: " + item.ID)
+        }
+        if this.tenantMap[item.ID] != nil {
+            return errors.New("duplicated tenant: " + item.ID)
+        }
+        this.tenantMap[item.ID] = item
+
+        for _, host := range item.HostList {
+            host = strings.ToLower(host)
+            if owner, exists := this.hostMap[host]; exists {
+                return fmt.Errorf("host %s belongs to both tenant %s and %s", host, owner, item.ID)
+            }
+            this.hostMap[host] = item.ID
+        }
+    }
+
+    if config.Default != "" && !this.Exists(config.Default) {
+        return errors.New("unknown default tenant: " + config.Default)
+    }
+
+    return nil
+}
+
+// Tell whether id may be served. Any well-formed id is accepted when no tenant is listed.
+func (this *VascTenant) Exists(id string) bool {
+    if len(this.tenantMap) == 0 {
+        return idPattern.MatchString(id)
+    }
+    return this.tenantMap[id] != nil
+}
+
+// Find the tenant of request from the configured sources in order, falling back to the default.
+// claims are those of the verified identity, nil for an anonymous request. A tenant claim of the
+// identity always decides, whatever the order: a header or host naming another tenant is refused
+// with ErrMismatch rather than letting the caller pick someone else's data.
+func (this *VascTenant) Resolve(request *http.Request, claims map[string]interface{}) (string, error) {
+    claimed, _ := claims[this.Config.Claim].(string)
+
+    for _, source := range this.Config.Resolve {
+        var id string
+        switch source {
+            case SourceHeader:
+                id = strings.TrimSpace(request.Header.Get(this.Config.Header))
+            case SourceHost:
+                id = this.fromHost(request.Host)
+            case SourceClaim:
+                id = claimed
+        }
+        if id == "" {
+            continue
+        }
+        if claimed == "" {
+            return id, nil
+        }
+        if id != claimed {
+            return "", ErrMismatch
+        }
+    }
+
+    if claimed != "" {
+        return claimed, nil
+    }
+    return this.Config.Default, nil
+}
+
+// A host listed by a tenant, or a subdomain named after one, e.g. acme.example.com.
+func (this *VascTenant) fromHost(host string) string {
+    if name, _, err := net.SplitHostPort(host); err == nil {
+        host = name
+    }
+    host = strings.ToLower(host)
+
+    if id, exists := this.hostMap[host]; exists {
+        return id
+    }
+    if index := strings.IndexByte(host, '.'); index > 0 && this.tenantMap[host[:index]] != nil {
+        return host[:index]
+    }
+    return ""
+}
+
+// The database engine serving key for tenant id. Keys the tenant does not map are shared.
+func (this *VascTenant) DatabaseKey(id string, key string) string {
+    if item := this.tenantMap[id]; item != nil && item.Database[key] != "" {
+        return item.Database[key]
+    }
+    return key
+}
+
+// The redis instance serving key for tenant id. Keys the tenant does not map are shared.
+func (this *VascTenant) RedisKey(id string, key string) string {
+    if item := this.tenantMap[id]; item != nil && item.Redis[key] != "" {
+        return item.Redis[key]
+    }
+    return key
+}
+
+// Prefix of the redis keys of tenant id, "<id>:" unless configured.
+func (this *VascTenant) RedisPrefix(id string) string {
+    if id == "" {
+        return ""
+    }
+    if item := this.tenantMap[id]; item != nil && item.RedisPrefix != "" {
+        return item.RedisPrefix
+    }
+    return id + ":"
+}
+
+type tenantKey struct{}
+
+// Attach tenant id to parent, e.g. for a task pushed on behalf of the tenant.
+func NewContext(parent context.Context, id string) context.Context {
+    if id == "" {
+        return parent
+    }
+    return context.WithValue(parent, tenantKey{}, id)
+}
+
+func FromContext(ctx context.Context) string {
+    id, _ := ctx.Value(tenantKey{}).(string)
+    return id
+}
@@ -0,0 +1,140 @@
+package tenant
+
+import (
+    "github.com/marxn/vasc/global"
+    "net/http/httptest"
+    "testing"
+)
+
+func testTenant(t *testing.T, config *global.TenantConfig) *VascTenant {
+    result := new(VascTenant)
+    if err := result.LoadConfig(config); err != nil {
+        t.Fatal(err)
+    }
+    return result
+}
+
+func listedConfig(resolve ...string) *global.TenantConfig {
+    return &global.TenantConfig{
+        Resolve: resolve,
+        TenantList: []global.TenantItem{
+            {ID: "acme", HostList: []string{"api.acme.com"}},
+            {ID: "globex"},
+        },
+    }
+}
+
+func TestResolveSourcesInOrder(t *testing.T) {
+    value := testTenant(t, listedConfig(SourceHost, SourceHeader))
+
+    request := httptest.NewRequest("GET", "http://api.acme.com:8080/", nil)
+    request.Header.Set("X-Tenant-Id", "globex")
+    if id, err := value.Resolve(request, nil); err != nil || id != "acme" {
+        t.Fatalf("expected the host to win, got %q, %v", id, err)
+    }
+
+    request = httptest.NewRequest("GET", "http://globex.example.com/", nil)
+    if id, _ := value.Resolve(request, nil); id != "globex" {
+        t.Fatalf("expected the subdomain tenant, got %q", id)
+    }
+
+    request = httptest.NewRequest("GET", "http://unknown.example.com/", nil)
+    request.Header.Set("X-Tenant-Id", " acme ")
+    if id, _ := value.Resolve(request, nil); id != "acme" {
+        t.Fatalf("expected the header tenant, got %q", id)
+    }
+}
+
+func TestResolveDefault(t *testing.T) {
+    config := listedConfig()
+    config.Default = "globex"
+    value := testTenant(t, config)
+
+    if id, err := value.Resolve(httptest.NewRequest("GET", "/", nil), nil); err != nil || id != "globex" {
+        t.Fatalf("expected the default tenant, got %q, %v", id, err)
+    }
+}
+
+func TestClaimDecidesTenant(t *testing.T) {
+    value  := testTenant(t, listedConfig())
+    claims := map[string]interface{}{"tenant": "acme"}
+
+    // The claim applies even though only the header is configured as a source
+    request := httptest.NewRequest("GET", "/", nil)
+    if id, err := value.Resolve(request, claims); err != nil || id != "acme" {
+        t.Fatalf("expected the claimed tenant, got %q, %v", id, err)
+    }
+
+    request.Header.Set("X-Tenant-Id", "acme")
+    if id, err := value.Resolve(request, claims); err != nil || id != "acme" {
+        t.Fatalf("expected an agreeing header to pass, got %q, %v", id, err)
+    }
+
+    request.Header.Set("X-Tenant-Id", "globex")
+    if _, err := value.Resolve(request, claims); err != ErrMismatch {
+        t.Fatalf("expected a header naming another tenant to be refused, got %v", err)
+    }
+}
+
+func TestClaimRefusesOtherHost(t *testing.T) {
+    value   := testTenant(t, listedConfig(SourceClaim, SourceHost))
+    request := httptest.NewRequest("GET", "http://api.acme.com/", nil)
+
+    if _, err := value.Resolve(request, map[string]interface{}{"tenant": "globex"}); err != ErrMismatch {
+        t.Fatalf("expected a host of another tenant to be refused, got %v", err)
+    }
+}
+
+func TestExists(t *testing.T) {
+    listed := testTenant(t, listedConfig())
+    if !listed.Exists("acme") || listed.Exists("initech") {
+        t.Fatal("only listed tenants may exist")
+    }
+
+    open := testTenant(t, &global.TenantConfig{})
+    for _, id := range []string{"acme", "tenant-01", "a.b_c"} {
+        if !open.Exists(id) {
+            t.Fatalf("expected %q to be accepted without a tenant list", id)
+        }
+    }
+    for _, id := range []string{"", "acme:admin", "a b", "-acme", "*"} {
+        if open.Exists(id) {
+            t.Fatalf("expected %q to be refused", id)
+        }
+    }
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+    configs := map[string]*global.TenantConfig{
+        "source":  {Resolve: []string{"cookie"}},
+        "empty":   {TenantList: []global.TenantItem{{ID: ""}}},
+        "invalid": {TenantList: []global.TenantItem{{ID: "a:b"}}},
+        "twice":   {TenantList: []global.TenantItem{{ID: "a"}, {ID: "a"}}},
+        "host":    {TenantList: []global.TenantItem{{ID: "a", HostList: []string{"x.com"}}, {ID: "b", HostList: []string{"X.com"}}}},
+        "default": {Default: "missing", TenantList: []global.TenantItem{{ID: "a"}}},
+    }
+
+    for name, config := range configs {
+        if err := new(VascTenant).LoadConfig(config); err == nil {
+            t.Fatalf("%s: expected an error", name)
+        }
+    }
+}
+
+func TestTenantResources(t *testing.T) {
+    config := listedConfig()
+    config.TenantList[0].Database    = map[string]string{"main": "acme_main"}
+    config.TenantList[0].Redis       = map[string]string{"cache": "acme_cache"}
+    config.TenantList[0].RedisPrefix = "ACME:"
+    value := testTenant(t, config)
+
+    if value.DatabaseKey("acme", "main") != "acme_main" || value.DatabaseKey("globex", "main") != "main" {
+        t.Fatal("unexpected database key")
+    }
+    if value.RedisKey("acme", "cache") != "acme_cache" || value.RedisKey("acme", "other") != "other" {
+        t.Fatal("unexpected redis key")
+    }
+    if value.RedisPrefix("acme") != "ACME:" || value.RedisPrefix("globex") != "globex:" || value.RedisPrefix("") != "" {
+        t.Fatal("unexpected redis prefix")
+    }
+}
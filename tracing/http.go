@@ -0,0 +1,66 @@
+package tracing
+
+import (
+    "context"
+    "fmt"
+    "github.com/gin-gonic/gin"
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/propagation"
+    "go.opentelemetry.io/otel/trace"
+    "net/http"
+)
+
+const tracerHeader = "X-Vasc-Request-Tracer"
+
+// Start a server span for every request, continuing the trace of an incoming traceparent.
+// The span is put into the request context, which the portal context derives from.
+func Middleware() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+        name := c.Request.Method
+        if route := c.FullPath(); route != "" {
+            name += " " + route
+        }
+
+        ctx, span := Tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+            attribute.String("http.request.method", c.Request.Method),
+            attribute.String("http.route", c.FullPath()),
+            attribute.String("url.path", c.Request.URL.Path),
+            attribute.String("client.address", c.ClientIP()),
+            attribute.String("user_agent.original", c.Request.UserAgent()),
+        ))
+        defer span.End()
+
+        // Loggers follow the trace unless the caller brought its own tracer
+        tracer := c.Request.Header.Get(tracerHeader)
+        if tracer == "" {
+            if txID, ok := TxID(ctx); ok {
+                tracer = fmt.Sprintf("%016x", txID)
+                c.Request.Header.Set(tracerHeader, tracer)
+            }
+        }
+        span.SetAttributes(attribute.String("vasc.tracer", tracer))
+
+        c.Request = c.Request.WithContext(ctx)
+        c.Next()
+
+        status := c.Writer.Status()
+        span.SetAttributes(attribute.Int("http.response.status_code", status))
+        if status >= http.StatusInternalServerError {
+            span.SetStatus(codes.Error, http.StatusText(status))
+        }
+    }
+}
+
+// Write the trace context of the request into header, e.g. for an outgoing request.
+func InjectHeader(c *gin.Context, header http.Header) {
+    otel.GetTextMapPropagator().Inject(c.Request.Context(), propagation.HeaderCarrier(header))
+}
+
+// Write the trace context of ctx into header, for requests made outside of a gin handler.
+func InjectContext(ctx context.Context, header http.Header) {
+    otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
@@ -0,0 +1,63 @@
+package tracing
+
+import (
+    "context"
+    "github.com/garyburd/redigo/redis"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/trace"
+    "strings"
+    "time"
+)
+
+// Redis connection recording each Do as a client span under ctx. Pipelined commands queued
+// by Send are not recorded one by one.
+type redisConn struct {
+    redis.Conn
+    ctx           context.Context
+    instance      string
+}
+
+// Wrap conn so that its commands show up in the trace of ctx. conn is returned unchanged
+// when tracing is disabled.
+func RedisConn(ctx context.Context, conn redis.Conn, instance string) redis.Conn {
+    if !Enabled() {
+        return conn
+    }
+    return &redisConn{Conn: conn, ctx: ctx, instance: instance}
+}
+
+func (this *redisConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+    return this.do(commandName, func() (interface{}, error) {
+        return this.Conn.Do(commandName, args...)
+    })
+}
+
+func (this *redisConn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+    return this.do(commandName, func() (interface{}, error) {
+        return redis.DoWithTimeout(this.Conn, timeout, commandName, args...)
+    })
+}
+
+func (this *redisConn) do(commandName string, call func() (interface{}, error)) (interface{}, error) {
+    // An empty command only flushes the pipeline
+    if commandName == "" {
+        return call()
+    }
+
+    command := strings.ToUpper(commandName)
+    _, span, ok := startChild(this.ctx, "redis " + command, trace.SpanKindClient,
+        attribute.String("db.system.name", "redis"),
+        attribute.String("db.namespace", this.instance),
+        attribute.String("db.operation.name", command),
+    )
+    if !ok {
+        return call()
+    }
+    defer span.End()
+
+    reply, err := call()
+    if err != redis.ErrNil {
+        RecordError(span, err)
+    }
+    return reply, err
+}
@@ -0,0 +1,175 @@
+/*
+ * OpenTelemetry tracing with W3C trace context propagation. Spans are exported over OTLP
+ * to a collector; nothing is recorded unless tracing is enabled in the vasc config.
+ */
+
+package tracing
+
+import (
+    "context"
+    "encoding/binary"
+    "errors"
+    "github.com/marxn/vasc/global"
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+    "go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+    "go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+    "go.opentelemetry.io/otel/propagation"
+    "go.opentelemetry.io/otel/sdk/resource"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    "go.opentelemetry.io/otel/trace"
+    "sync/atomic"
+    "time"
+)
+
+const instrumentationName = "github.com/marxn/vasc"
+
+type VascTracing struct {
+    ProjectName     string
+    Config         *global.TracingConfig
+    Provider       *sdktrace.TracerProvider
+}
+
+var enabled atomic.Bool
+
+func (this *VascTracing) LoadConfig(config *global.TracingConfig, projectName string) error {
+    this.ProjectName = projectName
+    this.Config      = config
+
+    exporter, err := newExporter(config)
+    if err != nil {
+        return err
+    }
+
+    serviceName := config.ServiceName
+    if serviceName == "" {
+        serviceName = projectName
+    }
+
+    ratio := 1.0
+    if config.SampleRatio != nil {
+        ratio = *config.SampleRatio
+    }
+
+    // An upstream decision is kept so that a trace is never recorded halfway
+    this.Provider = sdktrace.NewTracerProvider(
+        sdktrace.WithBatcher(exporter),
+        sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+        sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+    )
+
+    otel.SetTracerProvider(this.Provider)
+    otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+    enabled.Store(true)
+
+    return nil
+}
+
+func newExporter(config *global.TracingConfig) (*otlptrace.Exporter, error) {
+    timeout := time.Duration(config.Timeout) * time.Second
+    if timeout <= 0 {
+        timeout = 10 * time.Second
+    }
+
+    switch config.Protocol {
+        case "", "grpc":
+            endpoint := config.Endpoint
+            if endpoint == "" {
+                endpoint = "localhost:4317"
+            }
+            options := []otlptracegrpc.Option{
+                otlptracegrpc.WithEndpoint(endpoint),
+                otlptracegrpc.WithTimeout(timeout),
+                otlptracegrpc.WithHeaders(config.Headers),
+            }
+            if config.Insecure {
+                options = append(options, otlptracegrpc.WithInsecure())
+            }
+            return otlptracegrpc.New(context.Background(), options...)
+        case "http":
+            endpoint := config.Endpoint
+            if endpoint == "" {
+                endpoint = "localhost:4318"
+            }
+            options := []otlptracehttp.Option{
+                otlptracehttp.WithEndpoint(endpoint),
+                otlptracehttp.WithTimeout(timeout),
+                otlptracehttp.WithHeaders(config.Headers),
+            }
+            if config.Insecure {
+                options = append(options, otlptracehttp.WithInsecure())
+            }
+            return otlptracehttp.New(context.Background(), options...)
+        default:
+            return nil, errors.New("unsupported tracing protocol: " + config.Protocol)
+    }
+}
+
+// Flush pending spans and stop exporting.
+func (this *VascTracing) Close() {
+    enabled.Store(false)
+
+    ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
+    defer cancel()
+    _ = this.Provider.Shutdown(ctx)
+}
+
+// Tell whether spans are being recorded.
+func Enabled() bool {
+    return enabled.Load()
+}
+
+func Tracer() trace.Tracer {
+    return otel.Tracer(instrumentationName)
+}
+
+// Start a span only when ctx already belongs to a trace, so that background work such as
+// polling does not produce a root span for every call.
+func startChild(ctx context.Context, name string, kind trace.SpanKind, attributes ...attribute.KeyValue) (context.Context, trace.Span, bool) {
+    if !Enabled() || !trace.SpanContextFromContext(ctx).IsValid() {
+        return ctx, nil, false
+    }
+
+    ctx, span := Tracer().Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attributes...))
+    return ctx, span, true
+}
+
+// Mark span as failed by err. Nothing is recorded for a nil error.
+func RecordError(span trace.Span, err error) {
+    if err == nil {
+        return
+    }
+    span.RecordError(err)
+    span.SetStatus(codes.Error, err.Error())
+}
+
+// Serialize the trace context of ctx, e.g. for a task envelope. Returns nil outside of a trace.
+func Inject(ctx context.Context) map[string]string {
+    carrier := propagation.MapCarrier{}
+    otel.GetTextMapPropagator().Inject(ctx, carrier)
+    if len(carrier) == 0 {
+        return nil
+    }
+    return carrier
+}
+
+// Return ctx carrying the trace context serialized by Inject.
+func Extract(ctx context.Context, carrier map[string]string) context.Context {
+    if len(carrier) == 0 {
+        return ctx
+    }
+    return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(carrier))
+}
+
+// The 64-bit transaction ID of the trace which ctx belongs to, so that log lines can be
+// matched with spans. The low half of the trace ID is used.
+func TxID(ctx context.Context) (uint64, bool) {
+    spanContext := trace.SpanContextFromContext(ctx)
+    if !spanContext.IsValid() {
+        return 0, false
+    }
+    traceID := spanContext.TraceID()
+    return binary.BigEndian.Uint64(traceID[8:]), true
+}
@@ -0,0 +1,71 @@
+package tracing
+
+import (
+    "context"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/trace"
+    "strings"
+    "xorm.io/xorm/contexts"
+)
+
+type xormSpanKey struct{}
+
+// Hook of a xorm engine turning each statement into a client span. Only statements run
+// through a session carrying a traced context, e.g. engine.Context(p.Context), are recorded.
+type XormHook struct {
+    Instance      string
+    System        string
+}
+
+// Well known database systems by driver name, others are reported under the driver name.
+var xormSystems = map[string]string{
+    "mysql":    "mysql",
+    "postgres": "postgresql",
+    "pgx":      "postgresql",
+    "sqlite":   "sqlite",
+    "sqlite3":  "sqlite",
+    "mssql":    "microsoft.sql_server",
+    "oci8":     "oracle.db",
+    "godror":   "oracle.db",
+}
+
+// Create a hook for the engine of instance running on driver, e.g. engine.DriverName().
+func NewXormHook(instance string, driver string) *XormHook {
+    system, ok := xormSystems[driver]
+    if !ok {
+        system = driver
+    }
+    return &XormHook{Instance: instance, System: system}
+}
+
+func (this *XormHook) BeforeProcess(c *contexts.ContextHook) (context.Context, error) {
+    ctx, span, ok := startChild(c.Ctx, "db " + operation(c.SQL), trace.SpanKindClient,
+        attribute.String("db.system.name", this.System),
+        attribute.String("db.namespace", this.Instance),
+        attribute.String("db.operation.name", operation(c.SQL)),
+        attribute.String("db.query.text", c.SQL),
+    )
+    if !ok {
+        return c.Ctx, nil
+    }
+    return context.WithValue(ctx, xormSpanKey{}, span), nil
+}
+
+func (this *XormHook) AfterProcess(c *contexts.ContextHook) error {
+    span, ok := c.Ctx.Value(xormSpanKey{}).(trace.Span)
+    if !ok {
+        return nil
+    }
+    RecordError(span, c.Err)
+    span.End()
+    return nil
+}
+
+// The leading keyword of a statement, e.g. SELECT.
+func operation(sql string) string {
+    sql = strings.TrimSpace(sql)
+    if index := strings.IndexAny(sql, " \t\n"); index > 0 {
+        sql = sql[:index]
+    }
+    return strings.ToUpper(sql)
+}
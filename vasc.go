@@ -5,26 +5,41 @@ import (
     "errors"
     "flag"
     "fmt"
+    "github.com/marxn/vasc/config"
     "github.com/marxn/vasc/database"
     "github.com/marxn/vasc/global"
+    "github.com/marxn/vasc/grpcserver"
+    "github.com/marxn/vasc/httpclient"
     "github.com/marxn/vasc/localcache"
     "github.com/marxn/vasc/logger"
+    "github.com/marxn/vasc/openapi"
+    "github.com/marxn/vasc/portal"
+    "github.com/marxn/vasc/resilience"
     vredis "github.com/marxn/vasc/redis"
     "github.com/marxn/vasc/scheduler"
     "github.com/marxn/vasc/task"
+    "github.com/marxn/vasc/tenant"
+    "github.com/marxn/vasc/tracing"
     "github.com/marxn/vasc/webserver"
+    "io"
     "io/ioutil"
     "os"
     "os/signal"
+    "strings"
     "syscall"
 )
 
-const VascWebserver = 0x01 << 1
-const VascCache     = 0x01 << 2
-const VascDb        = 0x01 << 3
-const VascRedis     = 0x01 << 4
-const VascScheduler = 0x01 << 5
-const VascTask      = 0x01 << 6
+const VascWebserver  = 0x01 << 1
+const VascCache      = 0x01 << 2
+const VascDb         = 0x01 << 3
+const VascRedis      = 0x01 << 4
+const VascScheduler  = 0x01 << 5
+const VascTask       = 0x01 << 6
+const VascGrpc       = 0x01 << 7
+const VascTracing    = 0x01 << 8
+const VascTenant     = 0x01 << 9
+const VascHttpClient = 0x01 << 10
+const VascResilience = 0x01 << 11
 
 type VascService struct {
     Cache         *localcache.CacheManager
@@ -33,16 +48,26 @@ type VascService struct {
     Redis         *vredis.VascRedis
     Scheduler     *scheduler.VascScheduler
     Task          *task.VascTask
+    Grpc          *grpcserver.VascGrpcServer
+    Tracing       *tracing.VascTracing
+    Tenant        *tenant.VascTenant
+    HttpClient    *httpclient.VascHttpClient
+    Resilience    *resilience.VascResilience
     BitCode        uint64
 }
 
 var vascInstance    *VascService
+var vascApplication *global.VascApplication
 var vascSignalChan   chan os.Signal
 var project         *string
 var environment     *string
 var mode            *string
 var initializer      func() error
 
+// Returned by InitInstance once the OpenAPI document requested by -openapi is written.
+// Nothing is started then and the caller is expected to exit.
+var ErrExported = errors.New("openapi document exported")
+
 func GetProjectName() string {
     return *project
 }
@@ -70,6 +95,16 @@ func loadModule(projectName string, app *global.VascApplication) error {
     
     logger.SetProjectName(projectName)
     
+    // Loaded first so that the other modules can hook into it
+    if vascConfiguration.Tracing!=nil && vascConfiguration.Tracing.Enable {
+        vascInstance.Tracing = new(tracing.VascTracing)
+        err := vascInstance.Tracing.LoadConfig(vascConfiguration.Tracing, projectName)
+        if err!=nil {
+            return err
+        }
+        vascInstance.BitCode |= VascTracing
+    }
+    
     if vascConfiguration.Redis!=nil && vascConfiguration.Redis.Enable {
         vascInstance.Redis = new(vredis.VascRedis)
         err := vascInstance.Redis.LoadConfig(vascConfiguration.Redis, projectName)
@@ -97,13 +132,51 @@ func loadModule(projectName string, app *global.VascApplication) error {
         vascInstance.BitCode |= VascCache
     }
     
+    if vascConfiguration.Tenant!=nil && vascConfiguration.Tenant.Enable {
+        vascInstance.Tenant = new(tenant.VascTenant)
+        err := vascInstance.Tenant.LoadConfig(vascConfiguration.Tenant)
+        if err!=nil {
+            return err
+        }
+        vascInstance.BitCode |= VascTenant
+    }
+    
+    if vascConfiguration.HttpClient!=nil && vascConfiguration.HttpClient.Enable {
+        vascInstance.HttpClient = new(httpclient.VascHttpClient)
+        err := vascInstance.HttpClient.LoadConfig(vascConfiguration.HttpClient, projectName)
+        if err!=nil {
+            return err
+        }
+        vascInstance.BitCode |= VascHttpClient
+    }
+    
+    if vascConfiguration.Resilience!=nil && vascConfiguration.Resilience.Enable {
+        vascInstance.Resilience = new(resilience.VascResilience)
+        err := vascInstance.Resilience.LoadConfig(vascConfiguration.Resilience, projectName)
+        if err!=nil {
+            return err
+        }
+        vascInstance.BitCode |= VascResilience
+    }
+    
     if vascConfiguration.Webserver!=nil && vascConfiguration.Webserver.Enable {
         vascInstance.WebServer = new(webserver.VascWebServer)
-        err := vascInstance.WebServer.LoadConfig(vascConfiguration.Webserver, projectName)
+        vascInstance.WebServer.LocalCache = vascInstance.Cache
+        vascInstance.WebServer.Tenant     = vascInstance.Tenant
+        vascInstance.WebServer.HttpClient = vascInstance.HttpClient
+        vascInstance.WebServer.Resilience = vascInstance.Resilience
+        vascInstance.WebServer.Reloader   = Reload
+        err := vascInstance.WebServer.LoadConfig(vascConfiguration.Webserver, vascInstance.Redis, vascInstance.DB, projectName)
         if err!=nil {
             return err
         }
         
+        if GetMode()=="bootstrap" && vascInstance.WebServer.Auth!=nil {
+            if err := vascInstance.WebServer.Auth.Bootstrap(); err!=nil {
+                return err
+            }
+        }
+        
         err = vascInstance.WebServer.LoadModules(appConfiguration.WebserverRoute, appConfiguration.WebServerGroup, app)
         if err!=nil {
             return err
@@ -140,7 +213,35 @@ func loadModule(projectName string, app *global.VascApplication) error {
         }
         
         vascInstance.BitCode |= VascTask
-    }    
+    }
+    
+    if vascConfiguration.Grpc!=nil && vascConfiguration.Grpc.Enable {
+        vascInstance.Grpc = new(grpcserver.VascGrpcServer)
+        err := vascInstance.Grpc.LoadConfig(vascConfiguration.Grpc, projectName)
+        if err!=nil {
+            return err
+        }
+        
+        err = vascInstance.Grpc.LoadServices(app)
+        if err!=nil {
+            return err
+        }
+        
+        vascInstance.BitCode |= VascGrpc
+    }
+    
+    resources := &portal.Resources{
+        DB:         vascInstance.DB,
+        Redis:      vascInstance.Redis,
+        Cache:      vascInstance.Cache,
+        Tenant:     vascInstance.Tenant,
+        HttpClient: vascInstance.HttpClient,
+        Resilience: vascInstance.Resilience,
+    }
+    if vascInstance.Task != nil {
+        resources.Tasks = vascInstance.Task
+    }
+    portal.SetResources(resources)
     
     return nil
 }
@@ -150,6 +251,10 @@ func InitInstance(app *global.VascApplication) error {
     environment     = flag.String("e", "",      "environment(demo/test/online/...)")
     pidfile        := flag.String("p", "",      "pid file path")
     mode            = flag.String("m", "normal","running mode(normal/bootstrap)")
+    openapiFile    := flag.String("openapi", "", "export OpenAPI document to file and exit(- for stdout)")
+    // Long names keep clear of the short flags an application may define on the same flag set
+    configFile     := flag.String("vasc-config",     app.ConfigurationFile,    "vasc config file or directory(json/yaml/toml)")
+    appConfigFile  := flag.String("vasc-app-config", app.AppConfigurationFile, "application config file or directory(json/yaml/toml)")
     
     flag.Parse()
     
@@ -157,25 +262,69 @@ func InitInstance(app *global.VascApplication) error {
         return errors.New("project name cannot be empty")
     }
     
+    app.ConfigurationFile    = *configFile
+    app.AppConfigurationFile = *appConfigFile
+    if err := loadConfigurationFiles(app, *environment); err!=nil {
+        return err
+    }
+    
     if app.Configuration=="" {
         return errors.New("config file path cannot be empty")
     }
+    
+    if *openapiFile!="" {
+        if err := exportOpenAPIFile(app, *project, *openapiFile); err!=nil {
+            return err
+        }
+        return ErrExported
+    }
    
     if *pidfile!="" {
         GeneratePidFile(pidfile)
     }
     
     //Install signal receiver
-    vascSignalChan = make(chan os.Signal)
+    vascSignalChan = make(chan os.Signal, 1)
     signal.Notify(vascSignalChan, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGUSR1, syscall.SIGUSR2)
     
     //Initliaze object
     vascInstance = new(VascService)
     vascInstance.BitCode = 0
+    vascApplication = app
 
     return loadModule(*project, app)
 }
 
+// Read the configuration files of app, overlaid for environment, unless the configuration is given as is.
+// The application configuration is read again from its file on reload.
+func loadConfigurationFiles(app *global.VascApplication, environment string) error {
+    if app.Configuration=="" && app.ConfigurationFile!="" {
+        content, err := config.Load(app.ConfigurationFile, environment)
+        if err!=nil {
+            return errors.New("cannot load vasc config: " + err.Error())
+        }
+        app.Configuration = content
+    }
+    
+    if app.AppConfigurationFile!="" {
+        filename := app.AppConfigurationFile
+        if app.AppConfigurationLoader==nil {
+            app.AppConfigurationLoader = func() (string, error) {
+                return config.Load(filename, environment)
+            }
+        }
+        if app.AppConfiguration=="" {
+            content, err := config.Load(filename, environment)
+            if err!=nil {
+                return errors.New("cannot load application config: " + err.Error())
+            }
+            app.AppConfiguration = content
+        }
+    }
+    
+    return nil
+}
+
 func SetInitializer(initfunc func() error) {
     initializer = initfunc
 }
@@ -205,6 +354,15 @@ func StartService() error {
         } 
     }
     
+    if vascInstance.BitCode &VascGrpc != 0 {
+        if err := vascInstance.Grpc.Start(); err != nil {
+            return err
+        }
+    }
+    
+    // Every server has claimed its inherited socket by now
+    webserver.CloseUnusedInheritedListeners()
+    
     return nil
 }
 
@@ -218,6 +376,12 @@ func Close() {
     if vascInstance.BitCode &VascWebserver != 0 {
         vascInstance.WebServer.Close()
     }
+    if vascInstance.BitCode &VascGrpc != 0 {
+        vascInstance.Grpc.Close()
+    }
+    if vascInstance.BitCode &VascHttpClient != 0 {
+        vascInstance.HttpClient.Close()
+    }
     if vascInstance.BitCode &VascCache != 0 {
         vascInstance.Cache.Close()
     }
@@ -227,12 +391,52 @@ func Close() {
     if vascInstance.BitCode &VascRedis != 0 {
         vascInstance.Redis.Close()
     }
+    if vascInstance.BitCode &VascTracing != 0 {
+        vascInstance.Tracing.Close()
+    }
 }
 
 func GetVascInstance() *VascService {
     return vascInstance
 }
 
+// Write the OpenAPI document of the application routes to w without starting any service.
+func ExportOpenAPI(app *global.VascApplication, projectName string, w io.Writer) error {
+    var vascConfiguration global.VascConfig
+    err := json.Unmarshal([]byte(app.Configuration), &vascConfiguration)
+    if err != nil {
+        return errors.New("Cannot parse vasc config file for project:" + projectName)
+    }
+    
+    var appConfiguration global.ControllerConfig
+    err = json.Unmarshal([]byte(app.AppConfiguration), &appConfiguration)
+    if err != nil {
+        return errors.New("Cannot parse application config file for project:" + projectName)
+    }
+    
+    document := openapi.Generate(vascConfiguration.Webserver, appConfiguration.WebserverRoute, appConfiguration.WebServerGroup, app.FuncMap, projectName)
+    encoder  := json.NewEncoder(w)
+    encoder.SetIndent("", "  ")
+    return encoder.Encode(document)
+}
+
+func exportOpenAPIFile(app *global.VascApplication, projectName string, filename string) error {
+    if filename == "-" {
+        return ExportOpenAPI(app, projectName, os.Stdout)
+    }
+    
+    file, err := os.Create(filename)
+    if err != nil {
+        return err
+    }
+    
+    if err = ExportOpenAPI(app, projectName, file); err != nil {
+        file.Close()
+        return err
+    }
+    return file.Close()
+}
+
 func GeneratePidFile(pidfile *string) {
     pid := fmt.Sprintf("%d", os.Getpid())
     err := ioutil.WriteFile(*pidfile, []byte(pid), 0666)
@@ -241,6 +445,132 @@ func GeneratePidFile(pidfile *string) {
     }
 }
 
+// Fetch the application configuration with AppConfigurationLoader and rebuild the route table from it.
+func Reload() error {
+    if vascApplication.AppConfigurationLoader == nil {
+        return errors.New("no application configuration loader for project:" + *project)
+    }
+    
+    appConfiguration, err := vascApplication.AppConfigurationLoader()
+    if err != nil {
+        return err
+    }
+    
+    return ReloadRoutes(appConfiguration)
+}
+
+// Rebuild the webserver route table from appConfiguration without restarting.
+// The running routes are kept if the new configuration cannot be loaded.
+func ReloadRoutes(appConfiguration string) error {
+    if vascInstance.BitCode &VascWebserver == 0 {
+        return errors.New("webserver is not enabled for project:" + *project)
+    }
+    
+    var controllerConfig global.ControllerConfig
+    err := json.Unmarshal([]byte(appConfiguration), &controllerConfig)
+    if err != nil {
+        return errors.New("Cannot parse application config file for project:" + *project)
+    }
+    
+    err = vascInstance.WebServer.Reload(controllerConfig.WebserverRoute, controllerConfig.WebServerGroup, vascApplication)
+    if err != nil {
+        return err
+    }
+    
+    vascApplication.AppConfiguration = appConfiguration
+    return nil
+}
+
+// Block until a terminating signal arrives.
+// SIGUSR2 re-executes the binary and hands the listening sockets over to the new process,
+// after which the caller is expected to Close() this one gracefully.
+// SIGHUP reloads the route table when AppConfigurationLoader is set.
 func Wait() {
-    <- vascSignalChan
+    for sig := range vascSignalChan {
+        if sig == syscall.SIGHUP && vascInstance.BitCode &VascWebserver != 0 && vascApplication.AppConfigurationLoader != nil {
+            if err := Reload(); err != nil {
+                logger.ErrorLog("cannot reload route table: %v", err)
+            } else {
+                logger.InfoLog("route table has been reloaded")
+            }
+            continue
+        }
+        
+        if sig == syscall.SIGUSR2 && vascInstance.BitCode &(VascWebserver|VascGrpc) != 0 {
+            if err := handoverProcess(); err != nil {
+                logger.ErrorLog("cannot hand listeners over to new process: %v", err)
+                continue
+            }
+            logger.InfoLog("listeners have been handed over, shutting down")
+        }
+        return
+    }
+}
+
+// Listening sockets of the webserver and the gRPC server.
+func listenerFiles() ([]*os.File, []string, error) {
+    var files []*os.File
+    var names []string
+    
+    servers := make([]interface{ ListenerFiles() ([]*os.File, []string, error) }, 0, 2)
+    if vascInstance.BitCode &VascWebserver != 0 {
+        servers = append(servers, vascInstance.WebServer)
+    }
+    if vascInstance.BitCode &VascGrpc != 0 {
+        servers = append(servers, vascInstance.Grpc)
+    }
+    
+    for _, server := range servers {
+        serverFiles, serverNames, err := server.ListenerFiles()
+        if err != nil {
+            for _, file := range files {
+                _ = file.Close()
+            }
+            return nil, nil, err
+        }
+        files = append(files, serverFiles...)
+        names = append(names, serverNames...)
+    }
+    
+    return files, names, nil
+}
+
+func handoverProcess() error {
+    files, names, err := listenerFiles()
+    if err != nil {
+        return err
+    }
+    defer func() {
+        for _, file := range files {
+            _ = file.Close()
+        }
+    }()
+    listenEnv := webserver.ListenerEnv(names)
+    
+    execPath, err := os.Executable()
+    if err != nil {
+        return err
+    }
+    
+    env := make([]string, 0, len(os.Environ()) + len(listenEnv))
+    for _, value := range os.Environ() {
+        if strings.HasPrefix(value, webserver.EnvListenFds + "=") || strings.HasPrefix(value, webserver.EnvListenFdNames + "=") {
+            continue
+        }
+        env = append(env, value)
+    }
+    env = append(env, listenEnv...)
+    
+    // Inherited sockets start from fd 3 in the new process
+    procFiles := append([]*os.File{os.Stdin, os.Stdout, os.Stderr}, files...)
+    process, err := os.StartProcess(execPath, os.Args, &os.ProcAttr{
+        Env:   env,
+        Files: procFiles,
+    })
+    if err != nil {
+        return err
+    }
+    
+    logger.InfoLog("new process started: pid[%d]", process.Pid)
+    return process.Release()
 }
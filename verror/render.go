@@ -0,0 +1,121 @@
+package verror
+
+import (
+    "encoding/json"
+    "github.com/gin-gonic/gin"
+    "github.com/marxn/vasc/global"
+    "net/http"
+    "strconv"
+    "sync"
+)
+
+type Renderer func(c *gin.Context, err *VascError)
+
+var renderer      Renderer
+var rendererMutex sync.RWMutex
+var responseShape = Shape(nil)
+
+// Set the response shape from config.
+func Configure(config *global.ErrorResponseConfig) {
+    if config == nil {
+        return
+    }
+
+    rendererMutex.Lock()
+    defer rendererMutex.Unlock()
+    responseShape = Shape(config)
+}
+
+// Return the response shape described by config. Empty field names keep the defaults.
+func Shape(config *global.ErrorResponseConfig) global.ErrorResponseConfig {
+    shape := global.ErrorResponseConfig{}
+    if config != nil {
+        shape = *config
+    }
+
+    if shape.CodeField == "" {
+        shape.CodeField = "code"
+    }
+    if shape.MessageField == "" {
+        shape.MessageField = "message"
+    }
+    if shape.DetailsField == "" {
+        shape.DetailsField = "details"
+    }
+    return shape
+}
+
+// Replace the default renderer when the shape cannot be expressed by config.
+func SetRenderer(value Renderer) {
+    rendererMutex.Lock()
+    defer rendererMutex.Unlock()
+    renderer = value
+}
+
+// Write err as the response. Error statuses abort the remaining handlers.
+func Render(c *gin.Context, err error) {
+    vascError := From(err)
+    if vascError == nil {
+        return
+    }
+
+    rendererMutex.RLock()
+    custom, shape := renderer, responseShape
+    rendererMutex.RUnlock()
+
+    if custom != nil {
+        custom(c, vascError)
+    } else {
+        body := Body(shape, c.Request.Header.Get("X-Vasc-Request-Tracer"), vascError)
+        if vascError.Status >= 400 {
+            c.AbortWithStatusJSON(vascError.Status, body)
+        } else {
+            c.JSON(vascError.Status, body)
+        }
+    }
+}
+
+// Write err in the configured shape to w, for when the gin context cannot be used.
+// A custom renderer is not applied here.
+func Write(w http.ResponseWriter, tracer string, err error) {
+    vascError := From(err)
+    if vascError == nil {
+        return
+    }
+
+    rendererMutex.RLock()
+    shape := responseShape
+    rendererMutex.RUnlock()
+
+    data, _ := json.Marshal(Body(shape, tracer, vascError))
+    w.Header().Set("Content-Type", "application/json; charset=utf-8")
+    w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+    w.WriteHeader(vascError.Status)
+    _, _ = w.Write(data)
+}
+
+func Body(shape global.ErrorResponseConfig, tracer string, err *VascError) gin.H {
+    body := gin.H{
+        shape.CodeField    : err.Code,
+        shape.MessageField : err.Message,
+    }
+    if err.Details != nil {
+        body[shape.DetailsField] = err.Details
+    }
+    if shape.TraceField != "" && tracer != "" {
+        body[shape.TraceField] = tracer
+    }
+
+    if shape.Envelope != "" {
+        return gin.H{shape.Envelope: body}
+    }
+    return body
+}
+
+func NotFoundHandler(c *gin.Context) {
+    Render(c, NotFound("Not found"))
+}
+
+func MethodNotAllowedHandler(c *gin.Context) {
+    Render(c, New(http.StatusMethodNotAllowed, http.StatusMethodNotAllowed, "Method not allowed"))
+}
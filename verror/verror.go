@@ -0,0 +1,100 @@
+/*
+ * Structured error carrying both the HTTP status and the business code,
+ * rendered in one configurable shape by webserver, portal and middlewares.
+ */
+
+package verror
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+)
+
+type VascError struct {
+    Status      int
+    Code        int
+    Message     string
+    Details     interface{}
+    Cause       error
+}
+
+func New(status int, code int, message string) *VascError {
+    return &VascError{Status: status, Code: code, Message: message}
+}
+
+func Newf(status int, code int, format string, v ...interface{}) *VascError {
+    return New(status, code, fmt.Sprintf(format, v...))
+}
+
+func Wrap(cause error, status int, code int, message string) *VascError {
+    return &VascError{Status: status, Code: code, Message: message, Cause: cause}
+}
+
+func (this *VascError) Error() string {
+    if this.Cause != nil {
+        return this.Message + ": " + this.Cause.Error()
+    }
+    return this.Message
+}
+
+func (this *VascError) Unwrap() error {
+    return this.Cause
+}
+
+// Return a copy with details attached, so that predefined errors can be shared.
+func (this *VascError) WithDetails(details interface{}) *VascError {
+    result := *this
+    result.Details = details
+    return &result
+}
+
+func (this *VascError) WithCause(cause error) *VascError {
+    result := *this
+    result.Cause = cause
+    return &result
+}
+
+// Convert any error into a VascError. Unknown errors become an internal error
+// whose message does not leak the cause to the client; an expired deadline becomes a timeout.
+func From(err error) *VascError {
+    if err == nil {
+        return nil
+    }
+
+    var result *VascError
+    if errors.As(err, &result) {
+        return result
+    }
+
+    if errors.Is(err, context.DeadlineExceeded) {
+        return Timeout(err)
+    }
+
+    return Wrap(err, http.StatusInternalServerError, http.StatusInternalServerError, "Internal server error")
+}
+
+func BadRequest(message string) *VascError {
+    return New(http.StatusBadRequest, http.StatusBadRequest, message)
+}
+
+func Unauthorized(message string) *VascError {
+    return New(http.StatusUnauthorized, http.StatusUnauthorized, message)
+}
+
+func Forbidden(message string) *VascError {
+    return New(http.StatusForbidden, http.StatusForbidden, message)
+}
+
+func NotFound(message string) *VascError {
+    return New(http.StatusNotFound, http.StatusNotFound, message)
+}
+
+func Timeout(cause error) *VascError {
+    return Wrap(cause, http.StatusGatewayTimeout, http.StatusGatewayTimeout, "Gateway timeout")
+}
+
+func Internal(cause error) *VascError {
+    return Wrap(cause, http.StatusInternalServerError, http.StatusInternalServerError, "Internal server error")
+}
@@ -0,0 +1,103 @@
+package webserver
+
+import (
+    "github.com/alicebob/miniredis/v2"
+    "github.com/gin-gonic/gin"
+    "github.com/garyburd/redigo/redis"
+    "github.com/marxn/vasc/global"
+    vredis "github.com/marxn/vasc/redis"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func testApplication() *global.VascApplication {
+    return &global.VascApplication{
+        FuncMap: map[string]interface{}{
+            "Hello": func(c *gin.Context) { c.String(http.StatusOK, "hello") },
+            "Deny":  func(c *gin.Context) { c.AbortWithStatus(http.StatusForbidden) },
+        },
+    }
+}
+
+func serve(t *testing.T, modules []global.VascRoute, groups []global.VascRouteGroup, target string) int {
+    gin.SetMode(gin.TestMode)
+    server := &VascWebServer{Config: &global.WebServerConfig{}}
+    engine := gin.New()
+    if err := server.loadRoutes(engine, modules, groups, testApplication()); err != nil {
+        t.Fatal(err)
+    }
+
+    recorder := httptest.NewRecorder()
+    engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+    return recorder.Code
+}
+
+func TestNamedGroupReferredToByPath(t *testing.T) {
+    groups := []global.VascRouteGroup{{Name: "admin", Group: "/admin", Middlewares: []string{"Deny"}}}
+
+    for _, reference := range []string{"admin", "/admin"} {
+        modules := []global.VascRoute{{Method: "GET", Route: "/hello", HandlerName: "Hello", Group: reference}}
+        if code := serve(t, modules, groups, "/admin/hello"); code != http.StatusForbidden {
+            t.Fatalf("group referred to as %q: expected its middleware to answer 403, got %d", reference, code)
+        }
+    }
+}
+
+func TestNamedGroupSharedByNameAndPath(t *testing.T) {
+    groups  := []global.VascRouteGroup{{Name: "admin", Group: "/admin", Middlewares: []string{"Deny"}}}
+    modules := []global.VascRoute{
+        {Method: "GET", Route: "/a", HandlerName: "Hello", Group: "admin"},
+        {Method: "GET", Route: "/b", HandlerName: "Hello", Group: "/admin"},
+    }
+
+    for _, target := range []string{"/admin/a", "/admin/b"} {
+        if code := serve(t, modules, groups, target); code != http.StatusForbidden {
+            t.Fatalf("%s: expected 403, got %d", target, code)
+        }
+    }
+}
+
+func TestUnknownLegacyGroupMiddleware(t *testing.T) {
+    groups  := []global.VascRouteGroup{{Group: "/v1", MiddlewareName: "Missing"}}
+    modules := []global.VascRoute{{Method: "GET", Route: "/hello", HandlerName: "Hello", Group: "/v1"}}
+
+    server := &VascWebServer{Config: &global.WebServerConfig{}}
+    if err := server.loadRoutes(gin.New(), modules, groups, testApplication()); err == nil {
+        t.Fatal("expected an error for a group middleware which does not exist")
+    }
+}
+
+func TestRateLimitSeparatedByGroup(t *testing.T) {
+    redisServer := miniredis.RunT(t)
+    pool := &redis.Pool{Dial: func() (redis.Conn, error) { return redis.Dial("tcp", redisServer.Addr()) }}
+
+    limit   := &global.RateLimitConfig{Rate: 1, Period: 3600, Mode: "redis", Redis: "main"}
+    groups  := []global.VascRouteGroup{{Name: "a", Group: "/a"}, {Name: "b", Group: "/b"}}
+    modules := []global.VascRoute{
+        {Method: "GET", Route: "/list", HandlerName: "Hello", Group: "a", RateLimit: limit},
+        {Method: "GET", Route: "/list", HandlerName: "Hello", Group: "b", RateLimit: limit},
+    }
+
+    gin.SetMode(gin.TestMode)
+    server := &VascWebServer{
+        ProjectName: "test",
+        Config:      &global.WebServerConfig{},
+        Redis:       &vredis.VascRedis{RedisPool: map[string]*redis.Pool{"main": pool}, Runnable: true},
+        handler:     new(engineHandler),
+    }
+    server.ServiceCore = server.newEngine()
+    server.handler.engine.Store(server.ServiceCore)
+    if err := server.LoadModules(modules, groups, testApplication()); err != nil {
+        t.Fatal(err)
+    }
+
+    for _, target := range []string{"/a/list", "/b/list"} {
+        if code := request(server, http.MethodGet, target); code != http.StatusOK {
+            t.Fatalf("%s: expected its own quota, got %d", target, code)
+        }
+    }
+    if code := request(server, http.MethodGet, "/a/list"); code != http.StatusTooManyRequests {
+        t.Fatalf("expected the quota of /a/list to be used up, got %d", code)
+    }
+}
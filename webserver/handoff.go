@@ -0,0 +1,229 @@
+/*
+ * Listening socket inheritance: systemd socket activation (LISTEN_FDS) and
+ * the listener handoff used for zero-downtime re-exec.
+ */
+
+package webserver
+
+import (
+    "errors"
+    "fmt"
+    "net"
+    "net/url"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+const listenFdsStart = 3
+
+const EnvListenFds     = "VASC_LISTEN_FDS"
+const EnvListenFdNames = "VASC_LISTEN_FDNAMES"
+
+type inheritedListener struct {
+    Name      string
+    Listener  net.Listener
+    Used      bool
+}
+
+var inheritedList   []*inheritedListener
+var inheritedOnce     sync.Once
+var inheritedMutex    sync.Mutex
+
+// Collect listening sockets passed by systemd or by the previous vasc process.
+func loadInheritedListeners() {
+    fdNum, nameList := 0, []string(nil)
+    if value := os.Getenv(EnvListenFds); value != "" {
+        fdNum, _ = strconv.Atoi(value)
+        nameList = splitListenerNames(os.Getenv(EnvListenFdNames))
+    } else if value := os.Getenv("LISTEN_FDS"); value != "" && os.Getenv("LISTEN_PID") == strconv.Itoa(os.Getpid()) {
+        fdNum, _ = strconv.Atoi(value)
+        nameList = strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+    }
+
+    // Do not pass them on to child processes
+    for _, key := range []string{EnvListenFds, EnvListenFdNames, "LISTEN_FDS", "LISTEN_PID", "LISTEN_FDNAMES"} {
+        _ = os.Unsetenv(key)
+    }
+
+    for i := 0; i < fdNum; i++ {
+        name := ""
+        if i < len(nameList) {
+            name = nameList[i]
+        }
+
+        file := os.NewFile(uintptr(listenFdsStart + i), name)
+        if file == nil {
+            continue
+        }
+
+        listener, err := net.FileListener(file)
+        _ = file.Close()
+        if err != nil {
+            fmt.Printf("cannot use inherited fd[%d]: %v\n", listenFdsStart + i, err)
+            continue
+        }
+
+        inheritedList = append(inheritedList, &inheritedListener{Name: name, Listener: listener})
+    }
+}
+
+// Find an inherited listener by key, or by address when the key does not match any name.
+// It returns nil when nothing was inherited for the address.
+func InheritListener(key string, network string, location string) (net.Listener, error) {
+    inheritedOnce.Do(loadInheritedListeners)
+
+    inheritedMutex.Lock()
+    defer inheritedMutex.Unlock()
+
+    var result *inheritedListener
+    for _, value := range inheritedList {
+        if !value.Used && key != "" && value.Name == key {
+            result = value
+            break
+        }
+    }
+
+    if result == nil {
+        for _, value := range inheritedList {
+            if !value.Used && sameAddress(network, location, value.Listener.Addr()) {
+                result = value
+                break
+            }
+        }
+    }
+
+    if result == nil {
+        return nil, nil
+    }
+
+    if result.Listener.Addr().Network() != network {
+        return nil, errors.New("inherited listener " + result.Name + " does not match network " + network)
+    }
+
+    result.Used = true
+    return result.Listener, nil
+}
+
+func sameAddress(network string, location string, addr net.Addr) bool {
+    if addr.Network() != network {
+        return false
+    }
+
+    if network == "unix" {
+        return addr.String() == location
+    }
+
+    expected, err := net.ResolveTCPAddr("tcp", location)
+    if err != nil {
+        return false
+    }
+
+    actual, ok := addr.(*net.TCPAddr)
+    if !ok || expected.Port != actual.Port {
+        return false
+    }
+
+    if expected.IP == nil || expected.IP.IsUnspecified() {
+        return actual.IP == nil || actual.IP.IsUnspecified()
+    }
+
+    return expected.IP.Equal(actual.IP)
+}
+
+// Close inherited sockets which are not claimed by any configured listener.
+// To be called once every server holding listeners has started.
+func CloseUnusedInheritedListeners() {
+    inheritedOnce.Do(loadInheritedListeners)
+
+    inheritedMutex.Lock()
+    defer inheritedMutex.Unlock()
+
+    for _, value := range inheritedList {
+        if !value.Used {
+            _ = value.Listener.Close()
+            value.Used = true
+        }
+    }
+}
+
+// Duplicate all listening sockets so that they can be passed to a new process,
+// together with the names the new process finds them by.
+func (this *VascWebServer) ListenerFiles() ([]*os.File, []string, error) {
+    files := make([]*os.File, 0, len(this.Listeners))
+    names := make([]string, 0, len(this.Listeners))
+
+    for _, vascListener := range this.Listeners {
+        if vascListener.listener == nil {
+            continue
+        }
+
+        file, err := ListenerFile(vascListener.listener)
+        if err != nil {
+            for _, value := range files {
+                _ = value.Close()
+            }
+            return nil, nil, err
+        }
+        if file == nil {
+            continue
+        }
+
+        files = append(files, file)
+        names = append(names, vascListener.Key)
+    }
+
+    return files, names, nil
+}
+
+// Duplicate the socket of listener, or return nil when it has none.
+func ListenerFile(listener net.Listener) (*os.File, error) {
+    filer, ok := listener.(interface{ File() (*os.File, error) })
+    if !ok {
+        return nil, nil
+    }
+
+    file, err := filer.File()
+    if err != nil {
+        return nil, err
+    }
+
+    // The socket file now belongs to the new process as well
+    if unixListener, ok := listener.(*net.UnixListener); ok {
+        unixListener.SetUnlinkOnClose(false)
+    }
+    return file, nil
+}
+
+// Environment telling the new process how to pick up the sockets passed from fd 3 on, named by names.
+func ListenerEnv(names []string) []string {
+    return []string{
+        fmt.Sprintf("%s=%d", EnvListenFds, len(names)),
+        fmt.Sprintf("%s=%s", EnvListenFdNames, joinListenerNames(names)),
+    }
+}
+
+// Listener keys default to the listen address, e.g. tcp:0.0.0.0:80, so each name is escaped
+// before joining them with ":" the way systemd does.
+func joinListenerNames(names []string) string {
+    escaped := make([]string, len(names))
+    for i, value := range names {
+        escaped[i] = url.QueryEscape(value)
+    }
+    return strings.Join(escaped, ":")
+}
+
+func splitListenerNames(value string) []string {
+    if value == "" {
+        return nil
+    }
+
+    result := strings.Split(value, ":")
+    for i, name := range result {
+        if unescaped, err := url.QueryUnescape(name); err == nil {
+            result[i] = unescaped
+        }
+    }
+    return result
+}
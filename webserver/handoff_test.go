@@ -0,0 +1,29 @@
+package webserver
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestListenerNamesRoundTrip(t *testing.T) {
+    names := []string{"tcp:0.0.0.0:80", "unix:/run/vasc.sock", "admin", "", "100%:x"}
+
+    joined := joinListenerNames(names)
+    result := splitListenerNames(joined)
+    if !reflect.DeepEqual(result, names) {
+        t.Fatalf("names %q came back as %q from %q", names, result, joined)
+    }
+}
+
+func TestSplitListenerNamesEmpty(t *testing.T) {
+    if result := splitListenerNames(""); result != nil {
+        t.Fatalf("expected no names, got %q", result)
+    }
+}
+
+func TestJoinListenerNamesKeepsCount(t *testing.T) {
+    joined := joinListenerNames([]string{"tcp:127.0.0.1:8080", "tcp:[::1]:8080"})
+    if result := splitListenerNames(joined); len(result) != 2 {
+        t.Fatalf("expected 2 names, got %d from %q", len(result), joined)
+    }
+}
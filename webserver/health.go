@@ -0,0 +1,61 @@
+package webserver
+
+import (
+    "github.com/gin-gonic/gin"
+    "github.com/marxn/vasc/global"
+    "github.com/marxn/vasc/resilience"
+    "net/http"
+)
+
+const DefaultHealthPath = "/health"
+
+type healthStatus struct {
+    Status          string                              `json:"status"`
+    Policies        map[string]resilience.PolicyStatus  `json:"policies,omitempty"`
+    Upstreams       map[string]string                   `json:"upstreams,omitempty"`
+}
+
+// Serve the state of the circuit breakers and bulkheads so that on-call can see which dependency
+// is tripped. An open breaker makes the service degraded but still answers 200: the service itself
+// is alive and restarting it would not bring the dependency back.
+func (this *VascWebServer) loadHealth(engine *gin.Engine, app *global.VascApplication) error {
+    config := this.Config.Health
+    
+    middlewares, err := this.resolveMiddlewareList(app, withAuth(config.Auth, nil))
+    if err!=nil {
+        return err
+    }
+    
+    healthPath := config.Path
+    if healthPath=="" {
+        healthPath = DefaultHealthPath
+    }
+    engine.GET(healthPath, append(middlewares, this.healthHandler)...)
+    
+    return nil
+}
+
+func (this *VascWebServer) healthHandler(c *gin.Context) {
+    result := healthStatus{Status: "ok"}
+    
+    if this.Resilience!=nil {
+        result.Policies = this.Resilience.Status()
+        for _, value := range result.Policies {
+            if value.CircuitBreaker==resilience.StateOpen.String() {
+                result.Status = "degraded"
+            }
+        }
+    }
+    
+    if this.HttpClient!=nil {
+        result.Upstreams = make(map[string]string)
+        for name, state := range this.HttpClient.Breakers() {
+            result.Upstreams[name] = state.String()
+            if state==resilience.StateOpen {
+                result.Status = "degraded"
+            }
+        }
+    }
+    
+    c.JSON(http.StatusOK, result)
+}
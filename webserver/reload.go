@@ -0,0 +1,47 @@
+package webserver
+
+import (
+    "errors"
+    "github.com/gin-gonic/gin"
+    "github.com/marxn/vasc/global"
+    "github.com/marxn/vasc/verror"
+    "net/http"
+)
+
+const DefaultReloadPath = "/admin/reload"
+
+// Rebuild the route table on POST, the same way as SIGHUP does. Anyone able to call it can make the
+// service re-read its configuration, so it is only served behind an auth provider.
+func (this *VascWebServer) loadReload(engine *gin.Engine, app *global.VascApplication) error {
+    config := this.Config.Reload
+    if config.Auth=="" {
+        return errors.New("reload endpoint requires an auth provider")
+    }
+    
+    middlewares, err := this.resolveMiddlewareList(app, withAuth(config.Auth, nil))
+    if err!=nil {
+        return err
+    }
+    
+    reloadPath := config.Path
+    if reloadPath=="" {
+        reloadPath = DefaultReloadPath
+    }
+    engine.POST(reloadPath, append(middlewares, this.reloadHandler)...)
+    
+    return nil
+}
+
+func (this *VascWebServer) reloadHandler(c *gin.Context) {
+    if this.Reloader==nil {
+        verror.Render(c, verror.New(http.StatusNotImplemented, http.StatusNotImplemented, "reload is not available"))
+        return
+    }
+    
+    if err := this.Reloader(); err!=nil {
+        verror.Render(c, verror.Newf(http.StatusInternalServerError, http.StatusInternalServerError, "cannot reload route table: %v", err))
+        return
+    }
+    
+    c.JSON(http.StatusOK, gin.H{"status": "reloaded"})
+}
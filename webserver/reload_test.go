@@ -0,0 +1,108 @@
+package webserver
+
+import (
+    "github.com/gin-gonic/gin"
+    "github.com/marxn/vasc/global"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+func reloadServer(t *testing.T, modules []global.VascRoute) *VascWebServer {
+    gin.SetMode(gin.TestMode)
+    server := &VascWebServer{Config: &global.WebServerConfig{}, handler: new(engineHandler)}
+    server.ServiceCore = server.newEngine()
+    server.handler.engine.Store(server.ServiceCore)
+    if err := server.LoadModules(modules, nil, testApplication()); err != nil {
+        t.Fatal(err)
+    }
+    return server
+}
+
+func request(server *VascWebServer, method string, target string) int {
+    recorder := httptest.NewRecorder()
+    server.Engine().ServeHTTP(recorder, httptest.NewRequest(method, target, nil))
+    return recorder.Code
+}
+
+func TestReloadKeepsRateLimit(t *testing.T) {
+    limit   := &global.RateLimitConfig{Rate: 1, Period: 3600}
+    modules := []global.VascRoute{{Method: "GET", Route: "/hello", HandlerName: "Hello", RateLimit: limit}}
+    server  := reloadServer(t, modules)
+
+    if code := request(server, http.MethodGet, "/hello"); code != http.StatusOK {
+        t.Fatalf("expected 200, got %d", code)
+    }
+    if err := server.Reload(modules, nil, testApplication()); err != nil {
+        t.Fatal(err)
+    }
+    if code := request(server, http.MethodGet, "/hello"); code != http.StatusTooManyRequests {
+        t.Fatalf("expected the quota to survive the reload, got %d", code)
+    }
+
+    // A changed limit starts over
+    modules[0].RateLimit = &global.RateLimitConfig{Rate: 2, Period: 3600}
+    if err := server.Reload(modules, nil, testApplication()); err != nil {
+        t.Fatal(err)
+    }
+    if code := request(server, http.MethodGet, "/hello"); code != http.StatusOK {
+        t.Fatalf("expected a new limiter for the new limit, got %d", code)
+    }
+}
+
+func TestReloadEndpointRequiresAuth(t *testing.T) {
+    server := reloadServer(t, nil)
+    server.Config.Reload = &global.ReloadConfig{Enable: true}
+    if err := server.Reload(nil, nil, testApplication()); err == nil {
+        t.Fatal("expected the reload endpoint to be refused without an auth provider")
+    }
+}
+
+func TestReloadHandler(t *testing.T) {
+    reloaded := 0
+    server   := reloadServer(t, nil)
+    server.Reloader = func() error {
+        reloaded++
+        return nil
+    }
+
+    engine := gin.New()
+    engine.POST(DefaultReloadPath, server.reloadHandler)
+
+    recorder := httptest.NewRecorder()
+    engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, DefaultReloadPath, nil))
+    if recorder.Code != http.StatusOK || reloaded != 1 {
+        t.Fatalf("expected one reload answered with 200, got %d after %d reloads", recorder.Code, reloaded)
+    }
+}
+
+func TestReloadClosesProxyConnections(t *testing.T) {
+    var closed int32
+    upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+    upstream.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+        if state == http.StateClosed {
+            atomic.AddInt32(&closed, 1)
+        }
+    }
+    upstream.Start()
+    defer upstream.Close()
+
+    modules := []global.VascRoute{{Method: "PROXY", Route: "/api/*path", Proxy: &global.ProxyConfig{UpstreamList: []string{upstream.URL}}}}
+    server  := reloadServer(t, modules)
+    if code := request(server, http.MethodGet, "/api/items"); code != http.StatusOK {
+        t.Fatalf("expected 200, got %d", code)
+    }
+
+    if err := server.Reload(modules, nil, testApplication()); err != nil {
+        t.Fatal(err)
+    }
+    for deadline := time.Now().Add(time.Second); atomic.LoadInt32(&closed) == 0; {
+        if time.Now().After(deadline) {
+            t.Fatal("expected the idle connection of the replaced proxy to be closed")
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+}
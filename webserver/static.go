@@ -0,0 +1,232 @@
+/*
+ * FILE routes with static options: listing control, caching headers,
+ * precompressed sidecars, SPA fallback and file systems registered in FuncMap.
+ */
+
+package webserver
+
+import (
+    "errors"
+    "fmt"
+    "github.com/gin-gonic/gin"
+    "github.com/marxn/vasc/global"
+    "github.com/marxn/vasc/verror"
+    "hash/fnv"
+    "io"
+    "io/fs"
+    "mime"
+    "net/http"
+    "os"
+    "path"
+    "strings"
+    "sync"
+)
+
+const defaultIndexFile = "index.html"
+
+var precompressedEncodings = []struct {
+    Encoding   string
+    Extension  string
+}{
+    {"br",   ".br"},
+    {"gzip", ".gz"},
+}
+
+type staticHandler struct {
+    root       http.FileSystem
+    config    *global.StaticConfig
+    index      string
+    listing    http.Handler
+    hashes     sync.Map
+}
+
+// Use the file system named by static.file_system in FuncMap, or local_file_path on disk.
+// local_file_path selects a sub directory when a file system is given.
+func staticFileSystem(app *global.VascApplication, route *global.VascRoute) (http.FileSystem, error) {
+    if route.Static.FileSystem == "" {
+        return http.Dir(route.LocalFilePath), nil
+    }
+
+    switch value := app.FuncMap[route.Static.FileSystem].(type) {
+        case http.FileSystem:
+            return value, nil
+        case fs.FS:
+            if route.LocalFilePath != "" {
+                sub, err := fs.Sub(value, strings.Trim(route.LocalFilePath, "/"))
+                if err != nil {
+                    return nil, err
+                }
+                value = sub
+            }
+            return http.FS(value), nil
+        case nil:
+            return nil, errors.New("cannot find file system: " + route.Static.FileSystem)
+        default:
+            return nil, errors.New("invalid file system prototype: " + route.Static.FileSystem)
+    }
+}
+
+func registerStatic(router *gin.RouterGroup, route global.VascRoute, middlewares []gin.HandlerFunc, root http.FileSystem) {
+    handler := &staticHandler{
+        root:    root,
+        config:  route.Static,
+        index:   route.Static.Index,
+        listing: http.FileServer(root),
+    }
+    if handler.index == "" {
+        handler.index = defaultIndexFile
+    }
+
+    group := router.Group(route.Route, middlewares...)
+    group.GET("/*filepath", handler.serve)
+    group.HEAD("/*filepath", handler.serve)
+}
+
+func (this *staticHandler) serve(c *gin.Context) {
+    name := path.Clean("/" + c.Param("filepath"))
+
+    file, info, err := this.open(name)
+    if err == nil && info.IsDir() {
+        file.Close()
+
+        if !this.config.DisableListing {
+            // Let the file server render the listing, or the index file with its redirects
+            request := c.Request.Clone(c.Request.Context())
+            request.URL.Path = c.Param("filepath")
+            this.listing.ServeHTTP(c.Writer, request)
+            return
+        }
+
+        name = path.Join(name, this.index)
+        file, info, err = this.open(name)
+    }
+
+    if err != nil && this.config.SPAFallback {
+        // Unknown paths belong to the client side router
+        name = "/" + this.index
+        file, info, err = this.open(name)
+    }
+
+    if err != nil {
+        verror.Render(c, verror.NotFound("Not found"))
+        return
+    }
+    defer file.Close()
+
+    this.serveFile(c, name, file, info)
+}
+
+// Open a regular file or directory, treating anything else as missing.
+func (this *staticHandler) open(name string) (http.File, os.FileInfo, error) {
+    file, err := this.root.Open(name)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    info, err := file.Stat()
+    if err != nil {
+        file.Close()
+        return nil, nil, err
+    }
+    if !info.IsDir() && !info.Mode().IsRegular() {
+        file.Close()
+        return nil, nil, os.ErrNotExist
+    }
+
+    return file, info, nil
+}
+
+func (this *staticHandler) serveFile(c *gin.Context, name string, file http.File, info os.FileInfo) {
+    header := c.Writer.Header()
+    if this.config.CacheControl != "" {
+        header.Set("Cache-Control", this.config.CacheControl)
+    }
+
+    if this.config.Precompressed {
+        header.Add("Vary", "Accept-Encoding")
+
+        if sidecar, sidecarInfo, encoding := this.openPrecompressed(c, name); sidecar != nil {
+            defer sidecar.Close()
+
+            // The content type comes from the original file, not the sidecar
+            contentType := mime.TypeByExtension(path.Ext(name))
+            if contentType == "" {
+                contentType = "application/octet-stream"
+            }
+            header.Set("Content-Type", contentType)
+            header.Set("Content-Encoding", encoding)
+            if this.config.ETag {
+                header.Set("ETag", this.etag(name, sidecar, sidecarInfo, encoding))
+            }
+
+            http.ServeContent(c.Writer, c.Request, name, sidecarInfo.ModTime(), sidecar)
+            return
+        }
+    }
+
+    if this.config.ETag {
+        header.Set("ETag", this.etag(name, file, info, ""))
+    }
+    http.ServeContent(c.Writer, c.Request, name, info.ModTime(), file)
+}
+
+// Find a sidecar for name in an encoding accepted by the client.
+func (this *staticHandler) openPrecompressed(c *gin.Context, name string) (http.File, os.FileInfo, string) {
+    accepted := c.Request.Header.Get("Accept-Encoding")
+
+    for _, value := range precompressedEncodings {
+        if !acceptsEncoding(accepted, value.Encoding) {
+            continue
+        }
+
+        file, info, err := this.open(name + value.Extension)
+        if err != nil {
+            continue
+        }
+        if info.IsDir() {
+            file.Close()
+            continue
+        }
+        return file, info, value.Encoding
+    }
+
+    return nil, nil, ""
+}
+
+func acceptsEncoding(accepted string, encoding string) bool {
+    for _, value := range strings.Split(accepted, ",") {
+        fields := strings.Split(value, ";")
+        if strings.TrimSpace(fields[0]) != encoding {
+            continue
+        }
+        if len(fields) > 1 && strings.ReplaceAll(strings.TrimSpace(fields[1]), " ", "") == "q=0" {
+            return false
+        }
+        return true
+    }
+    return false
+}
+
+// Weak validator from size and modification time. Embedded files have no modification time
+// and never change, so their content hash is computed once instead.
+func (this *staticHandler) etag(name string, file http.File, info os.FileInfo, encoding string) string {
+    result := fmt.Sprintf("%x-%x", info.Size(), info.ModTime().UnixNano())
+    if info.ModTime().IsZero() {
+        key := name + ":" + encoding
+        if value, ok := this.hashes.Load(key); ok {
+            result = value.(string)
+        } else {
+            hash := fnv.New64a()
+            if _, err := io.Copy(hash, file); err == nil {
+                result = fmt.Sprintf("%x-%x", info.Size(), hash.Sum64())
+                this.hashes.Store(key, result)
+            }
+            file.Seek(0, io.SeekStart)
+        }
+    }
+
+    if encoding != "" {
+        result += "-" + encoding
+    }
+    return "W/\"" + result + "\""
+}
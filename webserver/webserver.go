@@ -5,32 +5,105 @@ import (
     "errors"
     "fmt"
     "github.com/gin-gonic/gin"
+    "github.com/marxn/vasc/auth"
+    "github.com/marxn/vasc/database"
     "github.com/marxn/vasc/global"
+    "github.com/marxn/vasc/httpclient"
+    "github.com/marxn/vasc/localcache"
+    vmiddleware "github.com/marxn/vasc/middleware"
+    "github.com/marxn/vasc/openapi"
     "github.com/marxn/vasc/portal"
+    "github.com/marxn/vasc/proxy"
+    "github.com/marxn/vasc/ratelimit"
+    "github.com/marxn/vasc/resilience"
+    vredis "github.com/marxn/vasc/redis"
+    "github.com/marxn/vasc/responsecache"
+    "github.com/marxn/vasc/stream"
+    "github.com/marxn/vasc/tenant"
+    "github.com/marxn/vasc/tracing"
+    "github.com/marxn/vasc/verror"
     "log/syslog"
     "net"
     "net/http"
     "os"
+    "path"
+    "strings"
+    "sync"
+    "sync/atomic"
     "time"
 )
 
-type VascWebServer struct {
-    ProjectName     string
-    ServiceCore    *gin.Engine
-    ListenRetry     int
+// Middleware names with this prefix refer to auth providers, e.g. "auth:jwt"
+const authMiddlewarePrefix = "auth:"
+
+type VascListener struct {
+    Key             string
     ListenAddr      string
-    ReadTimeout     time.Duration
-    WriteTimeout    time.Duration
+    ListenRetry     int
+    EnableH2C       bool
     HttpServer     *http.Server
-    Done            chan struct{}
+    listener        net.Listener
+}
+
+type VascWebServer struct {
+    ProjectName       string
+    Config           *global.WebServerConfig
+    ServiceCore      *gin.Engine
+    Listeners       []*VascListener
+    Middlewares     []string
+    MiddlewareConfig *global.MiddlewareConfig
+    Auth             *auth.VascAuth
+    Redis            *vredis.VascRedis
+    LocalCache       *localcache.CacheManager
+    Tenant           *tenant.VascTenant
+    HttpClient       *httpclient.VascHttpClient
+    Resilience       *resilience.VascResilience
+    Hub              *stream.Hub
+    Done              chan struct{}
+    Reloader          func() error
+    handler          *engineHandler
+    reloadMutex       sync.Mutex
+    limiters          map[string]*routeLimiter
+    nextLimiters      map[string]*routeLimiter
+    proxies         []*proxy.VascProxy
+    nextProxies     []*proxy.VascProxy
+}
+
+// A local rate limiter is kept across reloads as long as the route keeps the same limit,
+// otherwise every reload would hand all clients a fresh quota.
+type routeLimiter struct {
+    config            global.RateLimitConfig
+    limiter           ratelimit.Limiter
+}
+
+// Shared by all listeners so that a reloaded engine takes effect everywhere at once
+type engineHandler struct {
+    engine            atomic.Value
+}
+
+func (this *engineHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    this.engine.Load().(*gin.Engine).ServeHTTP(w, r)
 }
 
-func (this *VascWebServer) LoadConfig(config *global.WebServerConfig, projectName string) error {
+func (this *VascWebServer) LoadConfig(config *global.WebServerConfig, redisPoolList *vredis.VascRedis, dbList *database.VascDataBase, projectName string) error {
     this.ProjectName = projectName
+    this.Redis       = redisPoolList
+    
+    if config.Auth!=nil {
+        this.Auth = new(auth.VascAuth)
+        if err := this.Auth.LoadConfig(config.Auth, redisPoolList, dbList, projectName); err!=nil {
+            return err
+        }
+    }
+    
+    hub, err := stream.NewHub(config.Stream, redisPoolList, projectName)
+    if err!=nil {
+        return err
+    }
+    this.Hub = hub
     
     gin.SetMode(gin.ReleaseMode)
     
-    engine := gin.New()
     if config.EnableLogger {
         logWriter, err := syslog.New(syslog.LOG_INFO|syslog.LOG_LOCAL6, projectName + "/_gin")
         if err != nil {
@@ -38,7 +111,54 @@ func (this *VascWebServer) LoadConfig(config *global.WebServerConfig, projectNam
         }
         gin.DefaultWriter = logWriter
         gin.DisableConsoleColor()
-        
+    }
+    
+    verror.Configure(config.ErrorResponse)
+    
+    this.Config           = config
+    this.ServiceCore      = this.newEngine()
+    this.handler          = new(engineHandler)
+    this.handler.engine.Store(this.ServiceCore)
+    this.ProjectName      = projectName
+    this.Middlewares      = config.Middlewares
+    this.MiddlewareConfig = config.Middleware
+    this.Done             = make(chan struct{})
+    
+    listenerList := config.ListenerList
+    if len(listenerList) == 0 {
+        // Compatible with the single listener configuration
+        listenerList = []global.ListenerConfig{{
+            ListenAddr  : config.ListenAddr,
+            ListenRetry : config.ListenRetry,
+        }}
+    }
+    
+    this.Listeners = make([]*VascListener, 0, len(listenerList))
+    for _, value := range listenerList {
+        if value.ReadTimeout == 0 {
+            value.ReadTimeout = config.ReadTimeout
+        }
+        if value.WriteTimeout == 0 {
+            value.WriteTimeout = config.WriteTimeout
+        }
+        if value.ListenRetry == 0 {
+            value.ListenRetry = config.ListenRetry
+        }
+        this.Listeners = append(this.Listeners, this.newListener(value))
+    }
+    
+    return this.InitWebserver()
+}
+
+// A bare engine carrying only the global pieces; routes are added by LoadModules or Reload.
+func (this *VascWebServer) newEngine() *gin.Engine {
+    engine := gin.New()
+    // gin trusts X-Forwarded-For from anyone by default; the real_ip middleware resolves it instead
+    _ = engine.SetTrustedProxies(nil)
+    if tracing.Enabled() {
+        engine.Use(tracing.Middleware())
+    }
+    if this.Config.EnableLogger {
         engine.Use(gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
     		return fmt.Sprintf("tid[%s] %s %s %s %s %d %s \"%s\"\n",
     		        param.Request.Header.Get("X-Vasc-Request-Tracer"),
@@ -53,202 +173,685 @@ func (this *VascWebServer) LoadConfig(config *global.WebServerConfig, projectNam
 	    }))
     }
     
-    this.ServiceCore     = engine
-    this.ProjectName     = projectName
-    this.ListenRetry     = config.ListenRetry
-    this.ListenAddr      = config.ListenAddr
-    this.ReadTimeout     = time.Duration(config.ReadTimeout)
-    this.WriteTimeout    = time.Duration(config.WriteTimeout)
-    this.Done            = make(chan struct{})
+    engine.HandleMethodNotAllowed = true
+    engine.NoRoute(verror.NotFoundHandler)
+    engine.NoMethod(verror.MethodNotAllowedHandler)
     
-    return this.InitWebserver()
+    return engine
+}
+
+func (this *VascWebServer) newListener(config global.ListenerConfig) *VascListener {
+    server := &http.Server{
+        Addr:         config.ListenAddr,
+        Handler:      this.handler,
+        ReadTimeout:  time.Duration(config.ReadTimeout)  * time.Second,
+        WriteTimeout: time.Duration(config.WriteTimeout) * time.Second,
+        IdleTimeout:  time.Duration(config.IdleTimeout)  * time.Second,
+    }
+    
+    if config.EnableH2C {
+        // Serve HTTP/2 with prior knowledge on the plain connection as well as HTTP/1.x
+        protocols := new(http.Protocols)
+        protocols.SetHTTP1(true)
+        protocols.SetUnencryptedHTTP2(true)
+        server.Protocols = protocols
+    }
+    
+    key := config.Key
+    if key == "" {
+        key = config.ListenAddr
+    }
+    
+    return &VascListener{
+        Key:         key,
+        ListenAddr:  config.ListenAddr,
+        ListenRetry: config.ListenRetry,
+        EnableH2C:   config.EnableH2C,
+        HttpServer:  server,
+    }
 }
 
 func (this *VascWebServer) Close() {
+    // Long lived connections are not covered by Shutdown
+    this.Hub.Close()
+    
     ctx, cancel := context.WithTimeout(context.Background(), 2 * time.Second)
 	defer cancel()
 
-    _ = this.HttpServer.Shutdown(ctx)
+    // All listeners share the same deadline for graceful shutdown
+    var wg sync.WaitGroup
+    for _, listener := range this.Listeners {
+        wg.Add(1)
+        go func(server *http.Server) {
+            _ = server.Shutdown(ctx)
+            wg.Done()
+        }(listener.HttpServer)
+    }
+    wg.Wait()
+    closeProxies(this.proxies)
     close(this.Done)
 }
 
 func (this *VascWebServer) InitWebserver() error {
-    this.HttpServer = &http.Server{
-        Addr:         this.ListenAddr,
-        Handler:      this.ServiceCore,
-        ReadTimeout:  this.ReadTimeout  * time.Second,
-        WriteTimeout: this.WriteTimeout * time.Second,
+    if len(this.Listeners) == 0 {
+        return errors.New("no listener configured for webserver")
+    }
+    
+    keys := make(map[string]bool)
+    for _, listener := range this.Listeners {
+        if keys[listener.Key] {
+            return errors.New("duplicated listener: " + listener.Key)
+        }
+        keys[listener.Key] = true
     }
     
     return nil
 }
 
 func (this *VascWebServer) Start() error {
-    address := []byte(this.ListenAddr)
-    if len(address) <= 4 {
-        return errors.New("Invalid protocol")
-    } else if string(address[0:5]) == "unix:" {
-        
-        // Wait a moment in case of listen error - why?
-        time.Sleep(time.Second * 3)
-        
-        location := string(address[5:])
-        _ = os.Remove(location)
-        
-        unixAddr, err := net.ResolveUnixAddr("unix", location)
-        if err != nil{
+    this.Hub.Start()
+    
+    for _, listener := range this.Listeners {
+        if err := this.startListener(listener); err != nil {
             return err
         }
-        
-        listener, err := net.ListenUnix("unix", unixAddr)
-        if err != nil{
+    }
+    
+    return nil
+}
+
+func (this *VascWebServer) startListener(vascListener *VascListener) error {
+    network, location, err := ParseListenAddr(vascListener.ListenAddr)
+    if err != nil {
+        return err
+    }
+    
+    // Prefer the socket handed over by systemd or the previous process
+    listener, err := InheritListener(vascListener.Key, network, location)
+    if err != nil {
+        return err
+    }
+    
+    if listener == nil {
+        listener, err = Listen(network, location, vascListener.ListenRetry)
+        if err != nil {
             return err
         }
-        
-        go func() {
-            if err := this.HttpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
-                fmt.Printf("listen unix sock file [%s] failed: %v\n", location, err)
-            } 
-            <-this.Done
-        }()
-    } else if string(address[0:4]) == "tcp:" {
-        this.HttpServer.Addr = string(address[4:])
-        go func() {
-            for counter:=0; counter < this.ListenRetry; counter++ {
-                if err := this.HttpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-                    fmt.Printf("listen[%d] %s failed: %v\n", counter, this.ListenAddr, err)
-                    time.Sleep(time.Second)
-                } else {
-                    <-this.Done
-                    break
-                }
-                
-            }
-        }()
-    } else {
-        return errors.New("Invalid listen address")
     }
     
+    if network == "tcp" {
+        vascListener.HttpServer.Addr = location
+    }
+    vascListener.listener = listener
+    
+    go func() {
+        if err := vascListener.HttpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+            fmt.Printf("serve %s failed: %v\n", vascListener.ListenAddr, err)
+        }
+        <-this.Done
+    }()
+    
     return nil
 }
 
+// Split a listen address of the form tcp:<host:port> or unix:<path> into network and location.
+func ParseListenAddr(listenAddr string) (string, string, error) {
+    if len(listenAddr) <= 4 {
+        return "", "", errors.New("Invalid protocol")
+    } else if strings.HasPrefix(listenAddr, "unix:") {
+        return "unix", listenAddr[5:], nil
+    } else if strings.HasPrefix(listenAddr, "tcp:") {
+        return "tcp", listenAddr[4:], nil
+    }
+    
+    return "", "", errors.New("Invalid listen address")
+}
+
+// Listen on location, retrying a tcp address up to retry times. A stale unix socket file is removed first.
+func Listen(network string, location string, retry int) (net.Listener, error) {
+    if network == "unix" {
+        if err := removeStaleSocket(location); err != nil {
+            return nil, err
+        }
+        return net.Listen("unix", location)
+    }
+    
+    var err error
+    for counter := 0; counter < retry || counter == 0; counter++ {
+        var listener net.Listener
+        if listener, err = net.Listen("tcp", location); err == nil {
+            return listener, nil
+        }
+        fmt.Printf("listen[%d] %s failed: %v\n", counter, location, err)
+        time.Sleep(time.Second)
+    }
+    
+    return nil, err
+}
+
+func removeStaleSocket(location string) error {
+    info, err := os.Stat(location)
+    if err != nil {
+        return nil
+    }
+    
+    if info.Mode() & os.ModeSocket == 0 {
+        return errors.New("cannot listen on " + location + ": not a socket file")
+    }
+    
+    // Someone is still serving on this socket - do not steal it
+    conn, err := net.DialTimeout("unix", location, time.Second)
+    if err == nil {
+        _ = conn.Close()
+        return errors.New("cannot listen on " + location + ": address already in use")
+    }
+    
+    return os.Remove(location)
+}
+
+// Routes and parents refer to a group by its name, or by its path as before names existed.
 func findGroupInfo(groups []global.VascRouteGroup, name string) *global.VascRouteGroup {
-    for _, value := range groups {
-        if value.Group==name {
-            return &value
+    for index := range groups {
+        if groups[index].Name!="" && groups[index].Name==name {
+            return &groups[index]
+        }
+    }
+    for index := range groups {
+        if groups[index].Group==name {
+            return &groups[index]
         }
     }
     return nil
 }
 
+func groupKey(group *global.VascRouteGroup) string {
+    if group.Name!="" {
+        return group.Name
+    }
+    return group.Group
+}
+
 func (this *VascWebServer) LoadModules(modules []global.VascRoute, groups []global.VascRouteGroup, app *global.VascApplication) error {
+    this.nextLimiters = make(map[string]*routeLimiter)
+    this.nextProxies  = nil
+    if err := this.loadRoutes(this.ServiceCore, modules, groups, app); err!=nil {
+        closeProxies(this.nextProxies)
+        return err
+    }
+    this.limiters = this.nextLimiters
+    this.proxies  = this.nextProxies
+    return nil
+}
+
+// The engine serving requests. ServiceCore is the one built at startup and is left alone by reloads.
+func (this *VascWebServer) Engine() *gin.Engine {
+    return this.handler.engine.Load().(*gin.Engine)
+}
+
+// Rebuild the engine from a new route table and swap it in for all listeners at once.
+// Requests in flight finish on the previous engine. Routes added to ServiceCore by hand are not carried over,
+// local rate limits of unchanged routes are.
+func (this *VascWebServer) Reload(modules []global.VascRoute, groups []global.VascRouteGroup, app *global.VascApplication) (err error) {
+    this.reloadMutex.Lock()
+    defer this.reloadMutex.Unlock()
+    
+    this.nextProxies = nil
+    // Proxies of a route table which is not taken into use are dropped
+    defer func() {
+        if err!=nil {
+            closeProxies(this.nextProxies)
+        }
+    }()
+    
+    // gin panics on conflicting routes, which must not take the running server down
+    defer func() {
+        if r := recover(); r!=nil {
+            err = fmt.Errorf("cannot build route table: %v", r)
+        }
+    }()
+    
+    engine := this.newEngine()
+    this.nextLimiters = make(map[string]*routeLimiter)
+    if err := this.loadRoutes(engine, modules, groups, app); err!=nil {
+        return err
+    }
+    
+    this.limiters = this.nextLimiters
+    this.handler.engine.Store(engine)
+    
+    // Requests in flight keep their connections, only idle ones are dropped
+    closeProxies(this.proxies)
+    this.proxies = this.nextProxies
+    
+    return nil
+}
+
+func closeProxies(proxies []*proxy.VascProxy) {
+    for _, value := range proxies {
+        value.Close()
+    }
+}
+
+func (this *VascWebServer) loadRoutes(engine *gin.Engine, modules []global.VascRoute, groups []global.VascRouteGroup, app *global.VascApplication) error {
+    // Engine-wide middlewares also run for unmatched requests, e.g. CORS preflight
+    middlewares, err := this.resolveMiddlewareList(app, this.Middlewares)
+    if err!=nil {
+        return err
+    }
+    engine.Use(middlewares...)
+    
+    if this.Config.OpenAPI!=nil && this.Config.OpenAPI.Enable {
+        if err := this.loadOpenAPI(engine, modules, groups, app); err!=nil {
+            return err
+        }
+    }
+    
+    if this.Config.Health!=nil && this.Config.Health.Enable {
+        if err := this.loadHealth(engine, app); err!=nil {
+            return err
+        }
+    }
+    
+    if this.Config.Reload!=nil && this.Config.Reload.Enable {
+        if err := this.loadReload(engine, app); err!=nil {
+            return err
+        }
+    }
+    
     if modules==nil {
         return nil
     }
     
-    groupMap := make(map[string][]global.VascRoute)
-    other  := make([]global.VascRoute, 0)
+    groupMap := make(map[string]*gin.RouterGroup)
     
     for i := 0; i < len(modules); i++ {
+        if modules[i].Disable {
+            continue
+        }
+        
         timeout     := modules[i].Timeout
         handlerName := modules[i].HandlerName
-        handlerFunc := app.FuncMap[handlerName]
-        if handlerFunc!=nil {
-            switch handlerFunc.(type) {
-                case func(*portal.Portal):
-                    modules[i].RouteHandler = portal.MakeGinRouteWithContext(this.ProjectName, handlerName, handlerFunc.(func(*portal.Portal)), timeout)
-                case func(*gin.Context):
-                    modules[i].RouteHandler = handlerFunc.(func(*gin.Context))
-                default:
-                    modules[i].RouteHandler = InvalidHandler
+        if modules[i].Method=="WS" || modules[i].Method=="SSE" {
+            modules[i].RouteHandler = this.resolveStreamHandler(app, modules[i].Method, handlerName)
+        } else if modules[i].Method=="PROXY" {
+            vascProxy, err := proxy.New(modules[i].Proxy, this.ProjectName)
+            if err!=nil {
+                return errors.New("cannot load proxy route " + modules[i].Route + ": " + err.Error())
             }
+            this.nextProxies = append(this.nextProxies, vascProxy)
+            modules[i].RouteHandler = vascProxy.Handler
         } else {
-            modules[i].RouteHandler = ErrorHandler
+            modules[i].RouteHandler = this.resolveHandler(app, handlerName, timeout)
         }
         
+        router := &engine.RouterGroup
         if modules[i].Group!="" {
-            head := groupMap[modules[i].Group]
-            if head==nil {
-                head = make([]global.VascRoute, 0)
+            groupCore, err := this.buildGroup(engine, groupMap, groups, modules[i].Group, app, nil)
+            if err!=nil {
+                return err
             }
-            head = append(head, modules[i])
-            groupMap[modules[i].Group] = head
-        } else {
-            other = append(other, modules[i])
-        }
-    }
-    
-    for groupName, group := range groupMap {
-        groupCore := this.ServiceCore.Group(groupName)
-        groupInfo := findGroupInfo(groups, groupName)
-        if groupInfo!=nil {
-            groupMiddleware := app.FuncMap[groupInfo.MiddlewareName]
-            if groupMiddleware!=nil {
-                switch groupMiddleware.(type) {
-                    case func(*portal.Portal):
-                        groupCore.Use(portal.MakeGinRouteWithContext(this.ProjectName, groupInfo.MiddlewareName, groupMiddleware.(func(*portal.Portal)), 0))
-                    case func(*gin.Context):
-                        groupCore.Use(groupMiddleware.(func(*gin.Context)))
-                    default:
-                        groupCore.Use(InvalidHandler)
-                }
-            } else {
-                groupCore.Use(DefaultMiddleware)
+            router = groupCore
+        }
+        
+        middlewares, err := this.routeMiddlewares(app, router.BasePath(), &modules[i])
+        if err!=nil {
+            return err
+        }
+        
+        if modules[i].Method=="FILE" && modules[i].Static!=nil {
+            root, err := staticFileSystem(app, &modules[i])
+            if err!=nil {
+                return err
             }
+            registerStatic(router, modules[i], middlewares, root)
+            continue
         }
         
-        for _, route := range group {
-            switch route.Method {
-                case "GET":
-                    groupCore.GET(route.Route, route.RouteHandler)
-                case "POST":
-                    groupCore.POST(route.Route, route.RouteHandler)
-                case "OPTIONS":
-                    groupCore.OPTIONS(route.Route, route.RouteHandler)
-                case "PUT":
-                    groupCore.PUT(route.Route, route.RouteHandler)
-                case "DELETE":
-                    groupCore.DELETE(route.Route, route.RouteHandler)
-                case "PATCH":
-                    groupCore.PATCH(route.Route, route.RouteHandler)
-                case "HEAD":
-                    groupCore.HEAD(route.Route, route.RouteHandler)
-                case "ANY":
-                    groupCore.Any(route.Route, route.RouteHandler)
-                case "FILE":
-                    groupCore.StaticFS(route.Route, http.Dir(route.LocalFilePath))
-                default:
-                    continue
+        registerRoute(router, modules[i], middlewares)
+    }
+
+    return nil
+}
+
+// Serve the OpenAPI document of the route table, and the docs UI unless it is disabled.
+func (this *VascWebServer) loadOpenAPI(engine *gin.Engine, modules []global.VascRoute, groups []global.VascRouteGroup, app *global.VascApplication) error {
+    config := this.Config.OpenAPI
+    
+    middlewares, err := this.resolveMiddlewareList(app, withAuth(config.Auth, nil))
+    if err!=nil {
+        return err
+    }
+    
+    document := openapi.Generate(this.Config, modules, groups, app.FuncMap, this.ProjectName)
+    specHandler, err := openapi.SpecHandler(document)
+    if err!=nil {
+        return err
+    }
+    
+    specPath := config.Path
+    if specPath=="" {
+        specPath = openapi.DefaultPath
+    }
+    engine.GET(specPath, append(middlewares, specHandler)...)
+    
+    if config.DisableDocs {
+        return nil
+    }
+    
+    docsPath := config.DocsPath
+    if docsPath=="" {
+        docsPath = openapi.DefaultDocsPath
+    }
+    
+    // Swagger UI is served from the binary so that the docs work without access to a CDN
+    assets := config.DocsAssets
+    if assets=="" {
+        assets = strings.TrimSuffix(docsPath, "/") + openapi.DocsAssetsPath
+        engine.GET(assets + "/*filepath", append(middlewares, openapi.AssetsHandler())...)
+    }
+    
+    docsHandler, err := openapi.DocsHandler(document.Info.Title, specPath, assets)
+    if err!=nil {
+        return err
+    }
+    engine.GET(docsPath, append(middlewares, docsHandler)...)
+    
+    return nil
+}
+
+// Middlewares of a single route: authentication, tenant, rate limit, the configured list, then the response cache.
+func (this *VascWebServer) routeMiddlewares(app *global.VascApplication, basePath string, route *global.VascRoute) ([]gin.HandlerFunc, error) {
+    result := make([]gin.HandlerFunc, 0)
+    
+    if route.Auth!="" {
+        middleware, err := this.resolveMiddleware(app, authMiddlewarePrefix + route.Auth)
+        if err!=nil {
+            return nil, err
+        }
+        result = append(result, middleware)
+    }
+    
+    // After authentication so that the tenant can be taken from a claim
+    if this.Tenant!=nil {
+        result = append(result, this.tenantMiddleware)
+    }
+    
+    if route.RateLimit!=nil {
+        middleware, err := this.rateLimitMiddleware(app, basePath, route)
+        if err!=nil {
+            return nil, err
+        }
+        result = append(result, middleware)
+    }
+    
+    list, err := this.resolveMiddlewareList(app, route.Middlewares)
+    if err!=nil {
+        return nil, err
+    }
+    result = append(result, list...)
+    
+    // Last, so that a cached response is only served to requests the other middlewares let through
+    if route.Cache!=nil {
+        middleware, err := this.cacheMiddleware(basePath, route)
+        if err!=nil {
+            return nil, err
+        }
+        result = append(result, middleware)
+    }
+    
+    return result, nil
+}
+
+// The cache is named after the full route path unless a name is configured.
+func (this *VascWebServer) cacheMiddleware(basePath string, route *global.VascRoute) (gin.HandlerFunc, error) {
+    name := route.Method + " " + route.Route
+    if route.Method=="FILE" || route.Method=="WS" || route.Method=="SSE" {
+        return nil, errors.New("response cache is not supported for " + name)
+    }
+    
+    cache, err := responsecache.New(route.Cache, path.Join(basePath, route.Route), this.LocalCache, this.Redis, this.ProjectName)
+    if err!=nil {
+        return nil, errors.New("cannot create response cache for " + name + ": " + err.Error())
+    }
+    cache.Identity = identitySubject
+    
+    return cache.Middleware, nil
+}
+
+// Responses are cached per caller and per tenant.
+func identitySubject(c *gin.Context) string {
+    subject := ""
+    if identity := portal.GinIdentity(c); identity != nil {
+        subject = identity.Provider + ":" + identity.Subject
+    }
+    if tenantID, exists := portal.GetGin(c, portal.TenantAttribute); exists {
+        subject = tenantID + "|" + subject
+    }
+    return subject
+}
+
+func (this *VascWebServer) tenantMiddleware(c *gin.Context) {
+    var claims map[string]interface{}
+    if identity := portal.GinIdentity(c); identity != nil {
+        claims = identity.Claims
+    }
+    
+    tenantID, err := this.Tenant.Resolve(c.Request, claims)
+    if err != nil {
+        verror.Render(c, verror.Forbidden(err.Error()))
+        return
+    }
+    if tenantID == "" {
+        if this.Tenant.Config.Required {
+            verror.Render(c, verror.BadRequest("tenant is required"))
+        }
+        return
+    }
+    if !this.Tenant.Exists(tenantID) {
+        verror.Render(c, verror.BadRequest("unknown tenant: " + tenantID))
+        return
+    }
+    
+    portal.SetGin(c, portal.TenantAttribute, tenantID)
+}
+
+func (this *VascWebServer) rateLimitMiddleware(app *global.VascApplication, basePath string, route *global.VascRoute) (gin.HandlerFunc, error) {
+    name := route.Method + " " + route.Route
+    
+    // A key extractor can also be provided by the application as func(*gin.Context) string
+    extractor, err := ratelimit.KeyExtractor(route.RateLimit.KeyBy)
+    if err!=nil {
+        handler, ok := app.FuncMap[route.RateLimit.KeyBy].(func(*gin.Context) string)
+        if !ok {
+            return nil, errors.New("invalid rate limit key for " + name + ": " + route.RateLimit.KeyBy)
+        }
+        extractor = handler
+    }
+    
+    // Routes of different groups may share a relative path, their counters must not
+    fullPath   := path.Join(basePath, route.Route)
+    limiterKey := route.Method + " " + fullPath
+    current    := this.limiters[limiterKey]
+    if current==nil || current.config!=*route.RateLimit {
+        keyPrefix := fmt.Sprintf("VASC:%s:RATELIMIT:%s:%s:", this.ProjectName, route.Method, fullPath)
+        limiter, err := ratelimit.NewLimiter(route.RateLimit, this.Redis, keyPrefix)
+        if err!=nil {
+            return nil, errors.New("cannot create rate limit for " + name + ": " + err.Error())
+        }
+        current = &routeLimiter{config: *route.RateLimit, limiter: limiter}
+    }
+    this.nextLimiters[limiterKey] = current
+    
+    return ratelimit.Middleware(current.limiter, extractor, name), nil
+}
+
+// Create the router group and all of its ancestors. Middlewares of a parent group are inherited by children.
+func (this *VascWebServer) buildGroup(engine *gin.Engine, groupMap map[string]*gin.RouterGroup, groups []global.VascRouteGroup, name string, app *global.VascApplication, visiting map[string]bool) (*gin.RouterGroup, error) {
+    if result := groupMap[name]; result!=nil {
+        return result, nil
+    }
+    
+    groupInfo := findGroupInfo(groups, name)
+    if groupInfo==nil {
+        // An undeclared group is a bare path prefix
+        result := engine.Group(name)
+        groupMap[name] = result
+        return result, nil
+    }
+    
+    // The same group may be referred to by name and by path
+    key := groupKey(groupInfo)
+    if result := groupMap[key]; result!=nil {
+        groupMap[name] = result
+        return result, nil
+    }
+    
+    if visiting==nil {
+        visiting = make(map[string]bool)
+    }
+    if visiting[key] {
+        return nil, errors.New("circular route group: " + key)
+    }
+    visiting[key] = true
+    
+    parent := &engine.RouterGroup
+    if groupInfo.Parent!="" {
+        parentGroup, err := this.buildGroup(engine, groupMap, groups, groupInfo.Parent, app, visiting)
+        if err!=nil {
+            return nil, err
+        }
+        parent = parentGroup
+    }
+    
+    middlewares := make([]gin.HandlerFunc, 0)
+    if groupInfo.MiddlewareName!="" {
+        middleware, err := this.resolveMiddleware(app, groupInfo.MiddlewareName)
+        if err!=nil {
+            return nil, errors.New("cannot load middleware of route group " + key + ": " + err.Error())
+        }
+        middlewares = append(middlewares, middleware)
+    }
+    
+    list, err := this.resolveMiddlewareList(app, withAuth(groupInfo.Auth, groupInfo.Middlewares))
+    if err!=nil {
+        return nil, err
+    }
+    middlewares = append(middlewares, list...)
+    
+    result := parent.Group(groupInfo.Group, middlewares...)
+    groupMap[key]  = result
+    groupMap[name] = result
+    
+    return result, nil
+}
+
+func (this *VascWebServer) resolveHandler(app *global.VascApplication, handlerName string, timeout int) gin.HandlerFunc {
+    handlerFunc := app.FuncMap[handlerName]
+    if handlerFunc==nil {
+        return ErrorHandler
+    }
+    
+    switch handlerFunc.(type) {
+        case func(*portal.Portal):
+            return portal.MakeGinRouteWithContext(this.ProjectName, handlerName, handlerFunc.(func(*portal.Portal)), timeout)
+        case func(*gin.Context):
+            return handlerFunc.(func(*gin.Context))
+        default:
+            if typedHandler, ok := portal.ParseTypedHandler(handlerFunc); ok {
+                return portal.MakeTypedGinRoute(this.ProjectName, handlerName, typedHandler, timeout)
             }
+            return InvalidHandler
+    }
+}
+
+// WS and SSE handlers take a Portal and use its Stream() for the connection.
+func (this *VascWebServer) resolveStreamHandler(app *global.VascApplication, method string, handlerName string) gin.HandlerFunc {
+    handlerFunc := app.FuncMap[handlerName]
+    if handlerFunc==nil {
+        return ErrorHandler
+    }
+    
+    handler, ok := handlerFunc.(func(*portal.Portal))
+    if !ok {
+        return InvalidHandler
+    }
+    
+    if method=="WS" {
+        return stream.WebSocketRoute(this.ProjectName, handlerName, handler, this.Hub)
+    }
+    return stream.EventStreamRoute(this.ProjectName, handlerName, handler, this.Hub)
+}
+
+// Authentication runs ahead of the other middlewares of a group so that they can rely on the identity
+func withAuth(provider string, middlewares []string) []string {
+    if provider=="" {
+        return middlewares
+    }
+    return append([]string{authMiddlewarePrefix + provider}, middlewares...)
+}
+
+func (this *VascWebServer) resolveMiddleware(app *global.VascApplication, name string) (gin.HandlerFunc, error) {
+    if strings.HasPrefix(name, authMiddlewarePrefix) {
+        if this.Auth==nil {
+            return nil, errors.New("auth is not configured for middleware: " + name)
         }
+        return this.Auth.Middleware(name[len(authMiddlewarePrefix):])
     }
     
-    for _, routeItem := range other {
-        switch routeItem.Method {
-            case "GET":
-                this.ServiceCore.GET(routeItem.Route, routeItem.RouteHandler)
-            case "POST":
-                this.ServiceCore.POST(routeItem.Route, routeItem.RouteHandler)
-            case "OPTIONS":
-                this.ServiceCore.OPTIONS(routeItem.Route, routeItem.RouteHandler)
-            case "PUT":
-                this.ServiceCore.PUT(routeItem.Route, routeItem.RouteHandler)
-            case "DELETE":
-                this.ServiceCore.DELETE(routeItem.Route, routeItem.RouteHandler)
-            case "PATCH":
-                this.ServiceCore.PATCH(routeItem.Route, routeItem.RouteHandler)
-            case "HEAD":
-                this.ServiceCore.HEAD(routeItem.Route, routeItem.RouteHandler)
-            case "ANY":
-                this.ServiceCore.Any(routeItem.Route, routeItem.RouteHandler)
-            case "FILE":
-                this.ServiceCore.StaticFS(routeItem.Route, http.Dir(routeItem.LocalFilePath))
-            default:
-                continue
+    middleware := app.FuncMap[name]
+    if middleware==nil {
+        if vmiddleware.Exists(name) {
+            return vmiddleware.New(name, this.MiddlewareConfig)
         }
+        return nil, errors.New("cannot find middleware: " + name)
+    }
+    
+    switch middleware.(type) {
+        case func(*portal.Portal):
+            return portal.MakeGinRouteWithContext(this.ProjectName, name, middleware.(func(*portal.Portal)), 0), nil
+        case func(*gin.Context):
+            return middleware.(func(*gin.Context)), nil
+        default:
+            return nil, errors.New("invalid middleware prototype: " + name)
     }
+}
 
-    return nil
+func (this *VascWebServer) resolveMiddlewareList(app *global.VascApplication, names []string) ([]gin.HandlerFunc, error) {
+    result := make([]gin.HandlerFunc, 0, len(names))
+    for _, name := range names {
+        middleware, err := this.resolveMiddleware(app, name)
+        if err!=nil {
+            return nil, err
+        }
+        result = append(result, middleware)
+    }
+    return result, nil
+}
+
+func registerRoute(router *gin.RouterGroup, route global.VascRoute, middlewares []gin.HandlerFunc) {
+    handlers := append(middlewares, route.RouteHandler)
+    switch route.Method {
+        case "GET":
+            router.GET(route.Route, handlers...)
+        case "POST":
+            router.POST(route.Route, handlers...)
+        case "OPTIONS":
+            router.OPTIONS(route.Route, handlers...)
+        case "PUT":
+            router.PUT(route.Route, handlers...)
+        case "DELETE":
+            router.DELETE(route.Route, handlers...)
+        case "PATCH":
+            router.PATCH(route.Route, handlers...)
+        case "HEAD":
+            router.HEAD(route.Route, handlers...)
+        case "ANY", "PROXY":
+            router.Any(route.Route, handlers...)
+        case "WS", "SSE":
+            router.GET(route.Route, handlers...)
+        case "FILE":
+            router.Group("", middlewares...).StaticFS(route.Route, http.Dir(route.LocalFilePath))
+    }
 }
 
 func DefaultMiddleware(c *gin.Context) {
@@ -256,9 +859,9 @@ func DefaultMiddleware(c *gin.Context) {
 }
 
 func ErrorHandler(c *gin.Context) {
-    c.JSON(403, gin.H{"error": gin.H{"code": 501, "message": "Empty handler"}})
+    verror.Render(c, verror.New(http.StatusNotImplemented, http.StatusNotImplemented, "Empty handler"))
 }
 
 func InvalidHandler(c *gin.Context) {
-    c.JSON(403, gin.H{"error": gin.H{"code": 501, "message": "Invalid handler prototype"}})
+    verror.Render(c, verror.New(http.StatusNotImplemented, http.StatusNotImplemented, "Invalid handler prototype"))
 }